@@ -0,0 +1,126 @@
+package id3
+
+import (
+	"encoding/binary"
+	"hash"
+	"hash/crc32"
+	"reflect"
+)
+
+// A tagSnapshot records the state of a tag when it was last decoded or
+// encoded, so that alterations can be detected.
+type tagSnapshot struct {
+	padding int
+	frames  []frameSnapshot
+}
+
+// A frameSnapshot records a frame and a checksum of its contents.
+type frameSnapshot struct {
+	frame Frame
+	sum   uint32
+}
+
+// snapshot records the current state of the tag.
+func (t *Tag) snapshot() {
+	s := &tagSnapshot{
+		padding: t.Padding,
+		frames:  make([]frameSnapshot, len(t.Frames)),
+	}
+	for i, f := range t.Frames {
+		s.frames[i] = frameSnapshot{frame: f, sum: frameChecksum(f)}
+	}
+	t.snap = s
+}
+
+// Altered returns true if the tag has been altered since it was last read
+// or written. Adding, removing, reordering or modifying frames and
+// changing the amount of padding are all alterations. A tag that was
+// neither read nor written is never considered altered.
+func (t *Tag) Altered() bool {
+	s := t.snap
+	switch {
+	case s == nil:
+		return false
+	case s.padding != t.Padding || len(s.frames) != len(t.Frames):
+		return true
+	}
+	for i, f := range t.Frames {
+		if s.frames[i].frame != f || s.frames[i].sum != frameChecksum(f) {
+			return true
+		}
+	}
+	return false
+}
+
+// DiscardOnFileAlteration removes all frames flagged with
+// FrameFlagDiscardOnFileAlteration from the tag and returns them. Call it
+// after altering the file's audio data (e.g., stripping or re-encoding
+// it), since such frames typically describe the audio data (e.g., AENC,
+// ASPI, MLLT and ETCO frames). It isn't required when the audio is
+// replaced entirely. The removed frames are also recorded in the tag's
+// Discarded list.
+func (t *Tag) DiscardOnFileAlteration() []Frame {
+	t.Frames, t.Discarded = partitionFrames(t.Frames, func(f Frame) bool {
+		return (headerOf(f).Flags & FrameFlagDiscardOnFileAlteration) != 0
+	})
+	return t.Discarded
+}
+
+// partitionFrames separates the frames to be discarded from the frames
+// to be kept. It returns new slices.
+func partitionFrames(frames []Frame, discard func(f Frame) bool) (kept, discarded []Frame) {
+	kept = make([]Frame, 0, len(frames))
+	for _, f := range frames {
+		if discard(f) {
+			discarded = append(discarded, f)
+		} else {
+			kept = append(kept, f)
+		}
+	}
+	return kept, discarded
+}
+
+// frameChecksum returns a checksum of the contents of a frame, including
+// its header.
+func frameChecksum(f Frame) uint32 {
+	h := crc32.NewIEEE()
+	checksumValue(h, reflect.ValueOf(f).Elem())
+	return h.Sum32()
+}
+
+func checksumValue(h hash.Hash32, v reflect.Value) {
+	var b [8]byte
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type() == reflect.TypeOf(FrameHeader{}) {
+			// The sizes are computed by the encoder, so only the fields
+			// set by the caller are included.
+			hdr := v.Interface().(FrameHeader)
+			hdr.Size, hdr.DataLength = 0, 0
+			v = reflect.ValueOf(hdr)
+		}
+		for i, n := 0, v.NumField(); i < n; i++ {
+			checksumValue(h, v.Field(i))
+		}
+
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		binary.BigEndian.PutUint64(b[:], v.Uint())
+		h.Write(b[:])
+
+	case reflect.String:
+		binary.BigEndian.PutUint64(b[:], uint64(v.Len()))
+		h.Write(b[:])
+		h.Write([]byte(v.String()))
+
+	case reflect.Slice:
+		binary.BigEndian.PutUint64(b[:], uint64(v.Len()))
+		h.Write(b[:])
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			h.Write(v.Bytes())
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			checksumValue(h, v.Index(i))
+		}
+	}
+}
@@ -0,0 +1,371 @@
+package id3
+
+import (
+	"reflect"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+// A Codepage identifies a legacy single- or double-byte character set.
+// Many tagging tools store text in the local codepage of the user's system
+// while marking the frame as ISO-8859-1. Use DetectCodepage to guess the
+// codepage actually used by such a tag, and RepairEncoding to convert its
+// text to Unicode.
+type Codepage uint8
+
+// All supported codepages.
+const (
+	CodepageISO88591    Codepage = iota // ISO-8859-1 (Latin-1)
+	CodepageWindows1251                 // Windows-1251 (Cyrillic)
+	CodepageShiftJIS                    // Shift-JIS (Japanese)
+	CodepageGBK                         // GBK (Simplified Chinese)
+	CodepageBig5                        // Big5 (Traditional Chinese)
+)
+
+var codepageNames = []string{
+	CodepageISO88591:    "ISO-8859-1",
+	CodepageWindows1251: "Windows-1251",
+	CodepageShiftJIS:    "Shift-JIS",
+	CodepageGBK:         "GBK",
+	CodepageBig5:        "Big5",
+}
+
+// String returns the name of the codepage.
+func (c Codepage) String() string {
+	if int(c) < len(codepageNames) {
+		return codepageNames[c]
+	}
+	return "Unknown"
+}
+
+// encoding returns the text encoding used to decode the codepage.
+func (c Codepage) encoding() encoding.Encoding {
+	switch c {
+	case CodepageISO88591:
+		return charmap.ISO8859_1
+	case CodepageWindows1251:
+		return charmap.Windows1251
+	case CodepageShiftJIS:
+		return japanese.ShiftJIS
+	case CodepageGBK:
+		return simplifiedchinese.GBK
+	case CodepageBig5:
+		return traditionalchinese.Big5
+	default:
+		return nil
+	}
+}
+
+// A Repair describes a change made (or, in a dry run, proposed) by
+// RepairEncoding to a single text field.
+type Repair struct {
+	Frame    Frame  // The frame containing the field
+	Field    string // The name of the field (e.g., "Text[0]")
+	Original string // The text as decoded from ISO-8859-1
+	Repaired string // The text as decoded from the codepage
+}
+
+// DetectCodepage guesses the codepage actually used by the text of the
+// tag's ISO-8859-1 frames. It decodes the text using each supported
+// codepage and scores the result using statistical heuristics based on
+// the scripts and characters that appear. It returns CodepageISO88591 if
+// the text appears to be genuine ISO-8859-1 or contains no bytes outside
+// the ASCII range.
+func DetectCodepage(t *Tag) Codepage {
+	var sample []byte
+	visitLegacyText(t, func(f Frame, name string, s reflect.Value, b []byte) {
+		sample = append(sample, b...)
+		sample = append(sample, ' ')
+	})
+
+	high := 0
+	for _, b := range sample {
+		if b >= 0x80 {
+			high++
+		}
+	}
+	if high == 0 {
+		return CodepageISO88591
+	}
+
+	best, bestScore := CodepageISO88591, scoreLatin1(latin1Runes(sample))
+	for _, c := range []Codepage{CodepageWindows1251, CodepageShiftJIS, CodepageGBK, CodepageBig5} {
+		s, ok := decodeCodepage(c, sample)
+		if !ok {
+			continue
+		}
+
+		var score float64
+		runes := []rune(s)
+		switch c {
+		case CodepageWindows1251:
+			score = scoreCyrillic(runes)
+		case CodepageShiftJIS:
+			score = scoreJapanese(runes)
+		case CodepageGBK, CodepageBig5:
+			score = scoreChinese(runes)
+		}
+		if score > bestScore {
+			best, bestScore = c, score
+		}
+	}
+
+	// Require a reasonable score per non-ASCII byte before overriding the
+	// encoding declared by the frames.
+	if best != CodepageISO88591 && bestScore < 0.5*float64(high) {
+		return CodepageISO88591
+	}
+	return best
+}
+
+// RepairEncoding re-decodes the text of the tag's ISO-8859-1 frames using
+// the requested codepage and changes the frames' encodings so the repaired
+// text is stored as Unicode: UTF-8 for v2.4 tags and UTF-16 for earlier
+// versions. It returns a description of each field that changed. If any
+// field can't be decoded using the codepage, RepairEncoding returns
+// ErrInvalidText and leaves the tag unchanged. If a field to be repaired
+// belongs to a read-only frame, it returns a ReadOnlyError and leaves the
+// tag unchanged, unless the EditForce option is given.
+func RepairEncoding(t *Tag, cp Codepage, opts ...EditOption) ([]Repair, error) {
+	return repairEncoding(t, cp, false, opts)
+}
+
+// RepairEncodingDryRun is like RepairEncoding, but it only reports the
+// changes that would be made without modifying the tag.
+func RepairEncodingDryRun(t *Tag, cp Codepage, opts ...EditOption) ([]Repair, error) {
+	return repairEncoding(t, cp, true, opts)
+}
+
+func repairEncoding(t *Tag, cp Codepage, dryRun bool, opts []EditOption) ([]Repair, error) {
+	if cp.encoding() == nil {
+		return nil, ErrUnknownCodepage
+	}
+
+	var repairs []Repair
+	var values []reflect.Value
+	var err error
+	visitLegacyText(t, func(f Frame, name string, s reflect.Value, b []byte) {
+		repaired, ok := decodeCodepage(cp, b)
+		switch {
+		case err != nil:
+		case !ok:
+			err = ErrInvalidText
+		case repaired != s.String():
+			repairs = append(repairs, Repair{
+				Frame:    f,
+				Field:    name,
+				Original: s.String(),
+				Repaired: repaired,
+			})
+			values = append(values, s)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range repairs {
+		if err := checkWritable(r.Frame, opts); err != nil {
+			return nil, err
+		}
+	}
+	if dryRun {
+		return repairs, nil
+	}
+
+	enc := Encoding(EncodingUTF16BOM)
+	if t.Version >= Version2_4 {
+		enc = EncodingUTF8
+	}
+	for i, r := range repairs {
+		values[i].SetString(r.Repaired)
+		reflect.ValueOf(r.Frame).Elem().FieldByName("Encoding").SetUint(uint64(enc))
+	}
+	return repairs, nil
+}
+
+// visitLegacyText calls fn for each text field of the tag's ISO-8859-1
+// frames, passing the original bytes of the field. Fields containing
+// characters outside the ISO-8859-1 range have already been converted to
+// Unicode and are skipped.
+func visitLegacyText(t *Tag, fn func(f Frame, name string, s reflect.Value, b []byte)) {
+	for _, f := range t.Frames {
+		v := reflect.ValueOf(f)
+		if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+			continue
+		}
+		v = v.Elem()
+
+		enc := v.FieldByName("Encoding")
+		if !enc.IsValid() || enc.Kind() != reflect.Uint8 || Encoding(enc.Uint()) != EncodingISO88591 {
+			continue
+		}
+
+		visitTextFields(v, "", func(name string, s reflect.Value) {
+			if b, ok := latin1Bytes(s.String()); ok {
+				fn(f, name, s, b)
+			}
+		})
+	}
+}
+
+// latin1Bytes returns the ISO-8859-1 encoding of s, or false if s contains
+// characters that ISO-8859-1 can't represent.
+func latin1Bytes(s string) ([]byte, bool) {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xff {
+			return nil, false
+		}
+		b = append(b, byte(r))
+	}
+	return b, true
+}
+
+// latin1Runes returns the runes obtained by decoding b as ISO-8859-1.
+func latin1Runes(b []byte) []rune {
+	runes := make([]rune, len(b))
+	for i, ch := range b {
+		runes[i] = rune(ch)
+	}
+	return runes
+}
+
+// decodeCodepage decodes b using the codepage. It returns false if b
+// contains byte sequences that aren't valid in the codepage.
+func decodeCodepage(c Codepage, b []byte) (string, bool) {
+	if c == CodepageISO88591 {
+		return string(latin1Runes(b)), true
+	}
+	s, err := c.encoding().NewDecoder().String(string(b))
+	if err != nil || strings.ContainsRune(s, utf8.RuneError) {
+		return "", false
+	}
+	return s, true
+}
+
+// isASCIILetter returns true if r is an ASCII letter.
+func isASCIILetter(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+// neighbors returns the runes preceding and following the rune at
+// offset i, or zero at the ends of the slice.
+func neighbors(runes []rune, i int) (prev, next rune) {
+	if i > 0 {
+		prev = runes[i-1]
+	}
+	if i+1 < len(runes) {
+		next = runes[i+1]
+	}
+	return prev, next
+}
+
+// scoreLatin1 scores text decoded as ISO-8859-1. Accented letters in
+// Western European text usually appear alone within otherwise ASCII
+// words, while text in other codepages produces long runs of non-ASCII
+// characters. C1 control codes never appear in genuine ISO-8859-1 text.
+func scoreLatin1(runes []rune) float64 {
+	var score float64
+	for i, r := range runes {
+		switch {
+		case r < 0x80:
+		case r < 0xa0:
+			return -1
+		case unicode.IsLetter(r):
+			prev, next := neighbors(runes, i)
+			if isASCIILetter(prev) || isASCIILetter(next) {
+				score++
+			}
+		}
+	}
+	return score
+}
+
+// scoreCyrillic scores text decoded as Windows-1251. Cyrillic letters
+// earn a point each, but mixing scripts or letter cases within a word
+// suggests the text isn't Cyrillic.
+func scoreCyrillic(runes []rune) float64 {
+	var score float64
+	for i, r := range runes {
+		if r < 0x80 || !unicode.Is(unicode.Cyrillic, r) {
+			continue
+		}
+		prev, next := neighbors(runes, i)
+		switch {
+		case isASCIILetter(prev) || isASCIILetter(next):
+			score--
+		case unicode.IsLower(prev) && unicode.IsUpper(r):
+			score--
+		default:
+			score++
+		}
+	}
+	return score
+}
+
+// scoreJapanese scores text decoded as Shift-JIS. Kana are strong
+// evidence of Japanese text and kanji weaker evidence. Halfwidth katakana
+// are rare in practice, but bytes from other codepages frequently decode
+// to them.
+func scoreJapanese(runes []rune) float64 {
+	var score float64
+	for _, r := range runes {
+		switch {
+		case r < 0x80:
+		case unicode.Is(unicode.Hiragana, r) || (r >= 0x30a0 && r <= 0x30ff):
+			score += 2
+		case r >= 0xff61 && r <= 0xff9f:
+			score--
+		case unicode.Is(unicode.Han, r):
+			score += hanScore(r)
+		}
+	}
+	return score
+}
+
+// scoreChinese scores text decoded as GBK or Big5. Each two-byte sequence
+// in these codepages decodes to some Han character, so only commonly used
+// characters are strong evidence.
+func scoreChinese(runes []rune) float64 {
+	var score float64
+	for _, r := range runes {
+		switch {
+		case r < 0x80:
+		case unicode.Is(unicode.Han, r):
+			score += hanScore(r)
+		default:
+			score--
+		}
+	}
+	return score
+}
+
+// hanScore scores a single Han character.
+func hanScore(r rune) float64 {
+	if commonHan[r] {
+		return 2
+	}
+	return 0.5
+}
+
+// commonHan holds frequently used Chinese and Japanese characters, in both
+// simplified and traditional forms, along with characters common in song
+// titles and artist names.
+var commonHan = func() map[rune]bool {
+	const chars = "" +
+		"的一是不了人我在有他这為这个們中来上大为和国地到以说时要就出会可也你对生能而子那得于着下自之年过发后作里用道行所然家种事成方多经么去法学如都同现当没动面起看定天分还进好小部其些主样理心她本前开但因只从想实日军者意无力它与长把机十民第公此已工使情明性知全三又关点正业外将两高间由问很最重并物手应战向头文体政美相见被利什二等产或新己制身果加西斯月话合回特代内信表化老给世位次度门任常先海通教儿原东声提立及比员解水名真论处走义各入几口认条平系气题活尔更别打女变四神总何电数安少报才结反受目太量再感建务做接必场件计管期市直德资命山金指克许统区保至队形社便空决治展马科司五基眼书非则听白却界达光放强即像难且权思王象完设式色路记南品住告类求据程北边死张该交规万取拉格望觉术领共确传师观清今切院让识候带导争运笑飞风步改收根干造言联持组每济车亲极林服快办议往元英士证近失转夫令准布始怎呢存未远叫台单影具罗字爱击流备兵连调深商算质团集百需价花党华城石级整府离况亚请技际约示复病息究线似官火断精满支视消越器容照须九增研写称企八功吗包片史委乎查轻易早曾除农找装广显吧阿李标谈吃图念六引历首医局突专费号尼急衣乐歌曲音梦夜星雨雪春秋冬夏恋泪唱舞灯伤寂寞永远幸福温柔快乐朋友故乡回忆青春孤独黑红蓝绿黄" +
+		"們這來個為說國會對時過發見從現問動實點長開關書東車門間機電話愛聽學樂夢風雲淚戀憶鄉鳥語聲與還後當經進種將麼無頭們給親見讓體隨歡傷寫電話飛燈紅藍綠黃張陳劉楊趙孫馬羅鄭謝許鄧馮韓蕭葉蔣蘇盧鍾譚陸賈韋鄒閻龍賀顧龔萬錢嚴賴倫輯專" +
+		"王周吴徐朱胡郭何高梁宋唐曹曾彭蔡潘田董袁余杜魏程吕丁沈任姚傅姜崔廖范汪戴邱方侯熊孟秦江薛尹段雷黎史陶毛郝邵洪武莫孔杰菲伦辑"
+	m := make(map[rune]bool, utf8.RuneCountInString(chars))
+	for _, r := range chars {
+		m[r] = true
+	}
+	return m
+}()
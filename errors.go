@@ -2,14 +2,20 @@ package id3
 
 import (
 	"errors"
+	"fmt"
 )
 
 // Possible errors returned by this package.
 var (
 	ErrFailedCRC               = errors.New("tag failed CRC check")
+	ErrFrameConsumed           = errors.New("frame payload already read")
+	ErrFrameIndex              = errors.New("frame index out of range")
+	ErrFrameNotFound           = errors.New("frame not found in tag")
+	ErrFrameTooLarge           = errors.New("frame exceeds maximum size")
 	ErrIncompleteFrame         = errors.New("frame truncated prematurely")
 	ErrInvalidBits             = errors.New("invalid bits value, should be 8 or 16")
 	ErrInvalidBPM              = errors.New("invalid BPM value, must be less than 511")
+	ErrInvalidCompression      = errors.New("invalid compressed frame data")
 	ErrInvalidEncodedString    = errors.New("invalid encoded string")
 	ErrInvalidEncoding         = errors.New("invalid text encoding")
 	ErrInvalidEncryptMethod    = errors.New("invalid encrypt method, must be between 0x80 and 0xf0")
@@ -18,21 +24,161 @@ var (
 	ErrInvalidFrame            = errors.New("invalid frame structure")
 	ErrInvalidFrameFlags       = errors.New("invalid frame flags")
 	ErrInvalidFrameHeader      = errors.New("invalid frame header")
+	ErrInvalidFrameSize        = errors.New("frame size is not sync-safe")
+	ErrInvalidFrameStruct      = errors.New("frame is not a pointer to a struct starting with a FrameHeader")
 	ErrInvalidGroupID          = errors.New("invalid group id, must be between 0x80 and 0xf0")
 	ErrInvalidHeader           = errors.New("invalid tag header")
 	ErrInvalidHeaderFlags      = errors.New("invalid header flags")
 	ErrInvalidLyricContentType = errors.New("invalid lyric content type")
+	ErrInvalidNumber           = errors.New("invalid track or disc number")
+	ErrInvalidPadding          = errors.New("padding contains non-zero bytes")
+	ErrInvalidPayloadDef       = errors.New("invalid frame payload definition")
 	ErrInvalidPictureType      = errors.New("invalid picture type")
 	ErrInvalidSync             = errors.New("invalid sync code")
 	ErrInvalidTag              = errors.New("invalid id3 tag")
+	ErrInvalidTagSize          = errors.New("tag size excludes extended header")
 	ErrInvalidText             = errors.New("invalid text string encountered")
 	ErrInvalidTimeStampFormat  = errors.New("invalid time stamp format")
+	ErrInvalidTimestamp        = errors.New("invalid timestamp")
 	ErrInvalidVersion          = errors.New("invalid id3 version")
+	ErrLimitExceeded           = errors.New("decode limit exceeded")
+	ErrLossyEncoding           = errors.New("text cannot be represented in ISO-8859-1")
+	ErrReadOnly                = errors.New("frame is read-only")
+	ErrRestrictedImageFormat   = errors.New("image format not allowed by tag restrictions")
+	ErrRestrictedImageSize     = errors.New("image size not allowed by tag restrictions")
+	ErrRestrictedTagSize       = errors.New("tag size not allowed by tag restrictions")
+	ErrUnknownCodepage         = errors.New("unknown codepage")
 	ErrUnknownFrameType        = errors.New("unknown frame type")
+	ErrUnsupportedFrame        = errors.New("frame type not supported by id3 version")
 
 	errInsufficientBuffer = errors.New("insufficient buffer")
-	errInvalidPayloadDef  = errors.New("invalid frame payload definition")
+	errInvalidUint32Size  = errors.New("invalid uint32 size")
 	errPaddingEncountered = errors.New("padding encountered")
 	errUnimplemented      = errors.New("code path unimplemented")
-	errUnknownFieldType   = errors.New("unknown field type")
 )
+
+// A LimitError is returned when decoding a tag would exceed one of the
+// DecodeLimits requested in the DecodeOptions. It wraps ErrLimitExceeded.
+type LimitError struct {
+	Limit string // Name of the DecodeLimits field that was exceeded
+	Max   int    // Value of the limit
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("exceeded decode limit %s of %d", e.Limit, e.Max)
+}
+
+// Unwrap returns ErrLimitExceeded.
+func (e *LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// A LossyEncodingError is returned when encoding a tag with Latin1Strict
+// if a string that must be stored as ISO-8859-1 contains a character that
+// ISO-8859-1 can't represent. It wraps ErrLossyEncoding.
+type LossyEncodingError struct {
+	FrameID string // ID of the frame containing the string
+	Field   string // Name of the frame field containing the string
+	Rune    rune   // The first unrepresentable character
+}
+
+func (e *LossyEncodingError) Error() string {
+	return fmt.Sprintf("character %q (%U) cannot be represented in ISO-8859-1", e.Rune, e.Rune)
+}
+
+// Unwrap returns ErrLossyEncoding.
+func (e *LossyEncodingError) Unwrap() error {
+	return ErrLossyEncoding
+}
+
+// A ReadOnlyError is returned when an editing function refuses to modify or
+// remove a frame flagged with FrameFlagReadOnly. It wraps ErrReadOnly.
+type ReadOnlyError struct {
+	FrameID string // ID of the read-only frame, if known
+	Frame   Frame  // The read-only frame
+}
+
+func (e *ReadOnlyError) Error() string {
+	if e.FrameID == "" {
+		return ErrReadOnly.Error()
+	}
+	return fmt.Sprintf("%s frame is read-only", e.FrameID)
+}
+
+// Unwrap returns ErrReadOnly.
+func (e *ReadOnlyError) Unwrap() error {
+	return ErrReadOnly
+}
+
+// A DecodeError describes an error encountered while decoding a frame. It
+// wraps one of the package's error values, so it may be tested using
+// errors.Is.
+type DecodeError struct {
+	Err     error   // The underlying error
+	Offset  int     // Offset of the frame from the start of the tag
+	FrameID string  // ID of the frame, if known
+	Field   string  // Name of the frame field, if known
+	Version Version // Version of the tag
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("v2.%d tag offset %d: %s", e.Version, e.Offset, frameContext(e.Err, e.FrameID, e.Field))
+}
+
+// Unwrap returns the underlying error.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// An EncodeError describes an error encountered while encoding a frame.
+// It wraps one of the package's error values, so it may be tested using
+// errors.Is.
+type EncodeError struct {
+	Err     error   // The underlying error
+	Offset  int     // Offset of the frame from the start of the tag
+	FrameID string  // ID of the frame, if known
+	Field   string  // Name of the frame field, if known
+	Version Version // Version of the tag
+}
+
+func (e *EncodeError) Error() string {
+	return fmt.Sprintf("v2.%d tag offset %d: %s", e.Version, e.Offset, frameContext(e.Err, e.FrameID, e.Field))
+}
+
+// Unwrap returns the underlying error.
+func (e *EncodeError) Unwrap() error {
+	return e.Err
+}
+
+// frameDecodeError returns err as a DecodeError describing the frame in
+// which it occurred. If err is already a DecodeError, it is returned.
+func frameDecodeError(err error, frameID string) *DecodeError {
+	if de, ok := err.(*DecodeError); ok {
+		return de
+	}
+	return &DecodeError{Err: err, FrameID: frameID}
+}
+
+// frameEncodeError returns err as an EncodeError describing the frame in
+// which it occurred, filling in the frame's location.
+func frameEncodeError(err error, f Frame, offset int, v Version) *EncodeError {
+	ee, ok := err.(*EncodeError)
+	if !ok {
+		ee = &EncodeError{Err: err, FrameID: headerOf(f).FrameID}
+	}
+	ee.Offset, ee.Version = offset, v
+	return ee
+}
+
+// frameContext describes an error along with the frame and field in
+// which it occurred.
+func frameContext(err error, frameID, field string) string {
+	switch {
+	case frameID == "":
+		return err.Error()
+	case field == "":
+		return fmt.Sprintf("%s frame: %v", frameID, err)
+	default:
+		return fmt.Sprintf("%s frame field %s: %v", frameID, field, err)
+	}
+}
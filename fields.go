@@ -0,0 +1,447 @@
+package id3
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The functions in this file scan and output the values of individual
+// frame fields. They are shared by the reflector and by the generated
+// scan and output methods of the standard frame types, so that both
+// encode frames identically.
+
+// readUint8 consumes a byte, checking it against the bounds of the named
+// field.
+func (rf *reflector) readUint8(r *reader, name string) uint8 {
+	value := r.ConsumeByte()
+	if r.err != nil {
+		return 0
+	}
+
+	bounds, hasBounds := rf.vdata.bounds[name]
+	if hasBounds && (value < uint8(bounds.min) || value > uint8(bounds.max)) {
+		r.err = bounds.err
+		return 0
+	}
+	return value
+}
+
+// readUint16 consumes a 2-byte big-endian integer.
+func readUint16(r *reader) uint16 {
+	b := r.ConsumeBytes(2)
+	return uint16(b[0])<<8 | uint16(b[1])
+}
+
+// readBPM consumes a tempo in beats per minute, which is stored in a
+// second byte when it is 255 or more.
+func readBPM(r *reader) uint16 {
+	value := uint16(r.ConsumeByte())
+	if value == 0xff {
+		value += uint16(r.ConsumeByte())
+	}
+	return value
+}
+
+// readCounter consumes a counter, which fills the remainder of the frame.
+func readCounter(r *reader) uint64 {
+	var value uint64
+	for _, b := range r.ConsumeAll() {
+		value = (value << 8) | uint64(b)
+	}
+	return value
+}
+
+// readIndexOffsets consumes the remainder of the frame as the offsets of
+// an audio seek point index, whose fractions have the requested number of
+// bits.
+func (rf *reflector) readIndexOffsets(r *reader, length, bits uint32) []uint32 {
+	ff := r.ConsumeAll()
+	if r.err != nil {
+		return nil
+	}
+	if bits == 16 {
+		r.err = checkLimit("MaxEntries", r.limits().MaxEntries, len(ff)/2)
+	} else {
+		r.err = checkLimit("MaxEntries", r.limits().MaxEntries, len(ff))
+	}
+	if r.err != nil {
+		return nil
+	}
+
+	var offsets []uint32
+	switch bits {
+	case 8:
+		offsets = make([]uint32, 0, len(ff))
+		for _, f := range ff {
+			offsets = append(offsets, indexOffset(uint32(f), length, bits))
+		}
+
+	case 16:
+		if len(ff)%2 != 0 {
+			r.err = ErrInvalidFrame
+			return nil
+		}
+		offsets = make([]uint32, 0, len(ff)/2)
+		for ii := 0; ii < len(ff); ii += 2 {
+			frac := uint32(ff[ii])<<8 | uint32(ff[ii+1])
+			offsets = append(offsets, indexOffset(frac, length, bits))
+		}
+
+	default:
+		r.err = ErrInvalidBits
+		return nil
+	}
+	return offsets
+}
+
+// indexOffset converts a fraction stored in an audio seek point index,
+// which has the requested number of bits, into an offset within the
+// indexed data. The offset is rounded to the nearest byte.
+func indexOffset(frac, length, bits uint32) uint32 {
+	offset := (uint64(frac)*uint64(length) + (1 << (bits - 1))) >> bits
+	if offset > uint64(length) {
+		offset = uint64(length)
+	}
+	return uint32(offset)
+}
+
+// indexFraction converts an offset within the indexed data into the
+// fraction stored in an audio seek point index, which has the requested
+// number of bits. It is the inverse of indexOffset.
+func indexFraction(offset, length, bits uint32) uint32 {
+	if length == 0 {
+		return 0
+	}
+	max := uint64(1)<<bits - 1
+	frac := (uint64(offset) << bits) / uint64(length)
+
+	// When the data is longer than the index has fractions, the truncated
+	// fraction may convert back to a smaller offset.
+	if frac < max && indexOffset(uint32(frac), length, bits) != offset {
+		frac++
+	}
+	if frac > max {
+		frac = max
+	}
+	return uint32(frac)
+}
+
+// readStrings consumes the remainder of the frame as a list of strings,
+// applying the decoder's multi-value policy and sanitization.
+func (rf *reflector) readStrings(r *reader, enc Encoding, state *state) []string {
+	ss := r.ConsumeStrings(enc)
+	if r.err != nil {
+		return nil
+	}
+
+	if rf.version < Version2_4 {
+		ss = rf.splitValues(ss, r.opts, state)
+	}
+	if r.opts != nil {
+		ss = sanitizeStrings(ss, r.opts.Sanitize)
+	}
+	if r.err = checkLimit("MaxStrings", r.limits().MaxStrings, len(ss)); r.err != nil {
+		return nil
+	}
+	return ss
+}
+
+// splitValues applies the decoder's multi-value policy to the strings of
+// a v2.2 or v2.3 text frame. These versions don't allow null-separated
+// values, but tags in the wild sometimes contain them anyway, so all
+// non-empty values are kept. If the frame typically holds a list, its
+// values are further split using the configured separators.
+func (rf *reflector) splitValues(ss []string, opts *DecodeOptions, state *state) []string {
+	values := make([]string, 0, len(ss))
+	for _, s := range ss {
+		if s != "" || len(values) == 0 {
+			values = append(values, s)
+		}
+	}
+
+	typ := rf.vdata.frameTypes.LookupFrameType(state.frameID)
+	if opts == nil || len(opts.MultiValueSeparators) == 0 || !multiValueFrameTypes[typ] {
+		return values
+	}
+
+	for _, sep := range opts.MultiValueSeparators {
+		if sep == "" {
+			continue
+		}
+		split := make([]string, 0, len(values))
+		for _, v := range values {
+			for _, s := range strings.Split(v, sep) {
+				if s = strings.TrimSpace(s); s != "" {
+					split = append(split, s)
+				}
+			}
+		}
+		values = split
+	}
+	return values
+}
+
+// readString consumes a string of text using the frame's encoding.
+func readString(r *reader, enc Encoding) string {
+	str := r.ConsumeNextString(enc)
+	if r.err != nil {
+		return ""
+	}
+
+	if r.opts != nil {
+		str = sanitizeString(str, r.opts.Sanitize)
+	}
+	return str
+}
+
+// readWesternString consumes a string that is always encoded using
+// ISO-8859-1.
+func readWesternString(r *reader) string {
+	str := r.ConsumeNextString(EncodingISO88591)
+	if r.err != nil {
+		return ""
+	}
+	return str
+}
+
+// writeUint8 stores a byte, checking it against the encoding bounds of the
+// named field.
+func (rf *reflector) writeUint8(w *writer, name string, value uint8) {
+	if w.err != nil {
+		return
+	}
+
+	bounds, hasBounds := rf.vdata.encodeBounds[name]
+	if !hasBounds {
+		bounds, hasBounds = rf.vdata.bounds[name]
+	}
+	if hasBounds && (value < uint8(bounds.min) || value > uint8(bounds.max)) {
+		w.err = bounds.err
+		return
+	}
+	w.StoreByte(value)
+}
+
+// writeUint16 stores a 2-byte big-endian integer.
+func writeUint16(w *writer, v uint16) {
+	w.StoreBytes([]byte{byte(v >> 8), byte(v)})
+}
+
+// writeBPM stores a tempo in beats per minute, using a second byte when
+// it is 255 or more.
+func writeBPM(w *writer, v uint16) {
+	if w.err != nil {
+		return
+	}
+
+	if v > 2*0xff {
+		w.err = ErrInvalidBPM
+		return
+	}
+	if v < 0xff {
+		w.StoreByte(uint8(v))
+	} else {
+		w.StoreByte(0xff)
+		w.StoreByte(uint8(v - 0xff))
+	}
+}
+
+// writeUint32 stores a 4-byte big-endian integer.
+func writeUint32(w *writer, v uint32) {
+	w.StoreBytes([]byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)})
+}
+
+// writeCounter stores a counter using as many bytes as it requires, but
+// at least 4.
+func writeCounter(w *writer, v uint64) {
+	b := make([]byte, 0, 8)
+	for v != 0 {
+		b = append(b, byte(v&0xff))
+		v = v >> 8
+	}
+	for len(b) < 4 {
+		b = append(b, 0)
+	}
+	for i := len(b) - 1; i >= 0; i-- {
+		w.StoreByte(b[i])
+	}
+}
+
+// writeIndexOffsets stores the offsets of an audio seek point index as
+// fractions with the requested number of bits.
+func (rf *reflector) writeIndexOffsets(w *writer, offsets []uint32, length, bits uint32) {
+	if w.err != nil {
+		return
+	}
+
+	switch bits {
+	case 8:
+		for _, offset := range offsets {
+			w.StoreByte(byte(indexFraction(offset, length, bits)))
+		}
+
+	case 16:
+		for _, offset := range offsets {
+			frac := indexFraction(offset, length, bits)
+			w.StoreBytes([]byte{byte(frac >> 8), byte(frac)})
+		}
+
+	default:
+		w.err = ErrInvalidBits
+	}
+}
+
+// writeStrings stores a list of strings using the encoding selected for
+// the frame, applying the encoder's sanitization, restrictions and
+// multi-value policy.
+func (rf *reflector) writeStrings(w *writer, ss []string, state *state) {
+	if w.err != nil {
+		return
+	}
+
+	enc := state.encoding
+	if w.opts != nil {
+		ss = sanitizeStrings(ss, w.opts.Sanitize)
+	}
+	if w.restrict != nil {
+		restricted := make([]string, len(ss))
+		for i, s := range ss {
+			restricted[i] = w.restrict.truncateText(s)
+		}
+		ss = restricted
+	}
+
+	if enc == EncodingISO88591 {
+		latin1 := make([]string, len(ss))
+		for i, s := range ss {
+			latin1[i] = rf.latin1String(w, s, i, state)
+			if w.err != nil {
+				return
+			}
+		}
+		ss = latin1
+	}
+
+	// Versions prior to v2.4 don't allow null-separated values, so
+	// multiple values are joined into a single string.
+	if rf.version < Version2_4 {
+		for _, s := range ss {
+			if strings.IndexByte(s, 0) >= 0 {
+				w.err = ErrInvalidText
+				return
+			}
+		}
+		if len(ss) > 1 {
+			ss = []string{strings.Join(ss, w.opts.MultiValueSeparator)}
+		}
+	}
+
+	w.StoreStrings(ss, enc)
+}
+
+// writeString stores a string of text using the encoding selected for the
+// frame. The string is null-terminated if term is true.
+func (rf *reflector) writeString(w *writer, s string, term bool, state *state) {
+	if w.err != nil {
+		return
+	}
+
+	enc := state.encoding
+	if w.opts != nil {
+		s = sanitizeString(s, w.opts.Sanitize)
+	}
+	if w.restrict != nil {
+		s = w.restrict.truncateText(s)
+	}
+
+	if enc == EncodingISO88591 {
+		s = rf.latin1String(w, s, -1, state)
+		if w.err != nil {
+			return
+		}
+	}
+	w.StoreString(s, enc, term)
+}
+
+// writeWesternString stores a string that is always encoded using
+// ISO-8859-1. The string is null-terminated if term is true.
+func (rf *reflector) writeWesternString(w *writer, s string, term bool, state *state) {
+	if w.err != nil {
+		return
+	}
+
+	s = rf.latin1String(w, s, -1, state)
+	if w.err != nil {
+		return
+	}
+	w.StoreString(s, EncodingISO88591, term)
+}
+
+// latin1String converts a string that must be output using ISO-8859-1
+// according to the encoder's Latin1Mode. In strict mode, unrepresentable
+// characters cause a LossyEncodingError. If index isn't negative, the
+// string is an element of the current field.
+func (rf *reflector) latin1String(w *writer, s string, index int, state *state) string {
+	var mode Latin1Mode
+	if w.opts != nil {
+		mode = w.opts.Latin1
+	}
+
+	s, r, ok := toLatin1(s, mode)
+	if !ok {
+		field := state.field
+		if index >= 0 {
+			field = fmt.Sprintf("%s[%d]", field, index)
+		}
+		w.err = &LossyEncodingError{FrameID: state.frameID, Field: field, Rune: r}
+	}
+	return s
+}
+
+// selectOutputEncoding selects the text encoding used to output a frame,
+// given the encoding requested by the frame's Encoding field. The latin1
+// function reports whether all of the frame's text can be represented in
+// ISO-8859-1.
+func (rf *reflector) selectOutputEncoding(w *writer, enc Encoding, latin1 func() bool, state *state) {
+	state.encoding = rf.selectEncoding(enc, latin1, w.opts)
+	if w.restrict != nil {
+		state.encoding = w.restrict.textEncoding(state.encoding)
+	}
+}
+
+// selectEncoding chooses the text encoding used to output a frame, given
+// the encoding requested by the frame's Encoding field and the encoder's
+// policy.
+func (rf *reflector) selectEncoding(enc Encoding, latin1 func() bool, opts *EncodeOptions) Encoding {
+	var policy EncodingPolicy
+	var unicode Encoding
+	if opts != nil {
+		policy, unicode = opts.TextEncoding, opts.UnicodeEncoding
+	}
+
+	bounds, hasBounds := rf.vdata.encodeBounds["Encoding"]
+	if !hasBounds {
+		bounds = rf.vdata.bounds["Encoding"]
+	}
+	legal := int(enc) >= bounds.min && int(enc) <= bounds.max
+
+	switch policy {
+	case EncodingPolicyPreserve:
+		return enc
+	case EncodingPolicyLegalize:
+		if legal && (enc != EncodingISO88591 || latin1()) {
+			return enc
+		}
+	}
+
+	switch {
+	case latin1():
+		return EncodingISO88591
+	case rf.version < Version2_4:
+		return EncodingUTF16BOM
+	case unicode != EncodingISO88591:
+		return unicode
+	default:
+		return EncodingUTF8
+	}
+}
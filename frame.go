@@ -2,6 +2,10 @@ package id3
 
 import "reflect"
 
+// The scan and output methods of the frame types are generated from their
+// struct definitions.
+//go:generate go run ./internal/framegen
+
 // A FrameHeader holds the data described by a frame header.
 type FrameHeader struct {
 	FrameType     FrameType  // Frame type
@@ -11,6 +15,7 @@ type FrameHeader struct {
 	GroupID       uint8      // Optional group identifier
 	EncryptMethod uint8      // Optional encryption method identifier
 	DataLength    uint32     // Optional data length (if FrameFlagHasDataLength is set)
+	ByteOrder     ByteOrder  // Byte order of UTF-16 text with a byte order mark
 }
 
 // SetFlag sets the requested frame flag on or off.
@@ -61,7 +66,8 @@ func (h *FrameHeader) SetEncryptMethod(method uint8) error {
 }
 
 // A WesternString is a string that is always saved into the tag using
-// ISO 8559-1 encoding.
+// ISO 8559-1 encoding. Characters that ISO 8559-1 can't represent are
+// handled according to EncodeOptions.Latin1.
 type WesternString string
 
 // FrameFlags describe flags that may appear within a FrameHeader. Not all
@@ -208,12 +214,51 @@ const (
 type Frame interface {
 }
 
-// HeaderOf returns a pointer to the frame's header data.
+// HeaderOf returns a pointer to the frame's header data. It panics if f
+// isn't a pointer to a frame struct. Use HeaderOfChecked for frames that
+// may not be valid, such as custom frame types.
 func HeaderOf(f Frame) *FrameHeader {
-	var h *FrameHeader
-	source := reflect.ValueOf(f).Elem().Field(0).Addr()
-	target := reflect.ValueOf(&h).Elem()
-	target.Set(source)
+	h, err := HeaderOfChecked(f)
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+// HeaderOfChecked returns a pointer to the frame's header data. It returns
+// ErrInvalidFrameStruct if f isn't a non-nil pointer to a struct whose
+// first field is an exported FrameHeader.
+func HeaderOfChecked(f Frame) (*FrameHeader, error) {
+	if gf := asGeneratedFrame(f); gf != nil {
+		if h := gf.header(); h != nil {
+			return h, nil
+		}
+		return nil, ErrInvalidFrameStruct
+	}
+
+	v := reflect.ValueOf(f)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil, ErrInvalidFrameStruct
+	}
+
+	v = v.Elem()
+	if v.NumField() == 0 {
+		return nil, ErrInvalidFrameStruct
+	}
+	field := v.Type().Field(0)
+	if field.Type != reflect.TypeOf(FrameHeader{}) || field.PkgPath != "" {
+		return nil, ErrInvalidFrameStruct
+	}
+	return v.Field(0).Addr().Interface().(*FrameHeader), nil
+}
+
+// headerOf returns a pointer to the frame's header data, or to an unknown
+// frame's header if f isn't a valid frame.
+func headerOf(f Frame) *FrameHeader {
+	h, err := HeaderOfChecked(f)
+	if err != nil {
+		return &FrameHeader{FrameType: FrameTypeUnknown}
+	}
 	return h
 }
 
@@ -607,7 +652,8 @@ func NewFrameTermsOfUse(language, text string) *FrameTermsOfUse {
 // FrameText may contain the payload of any type of text frame
 // except for a custom text frame.  In v2.4, each text frame
 // may contain one or more text strings.  In all other versions, only one
-// text string may appear.
+// text string may appear, so multiple strings are joined together using
+// a separator when encoded (see EncodeOptions and DecodeOptions).
 type FrameText struct {
 	Header   FrameHeader
 	Encoding Encoding
@@ -796,6 +842,20 @@ var frameList = []struct {
 	{FrameTypeURLRadioStation, reflect.TypeOf(FrameURL{})},
 }
 
+// multiValueFrameTypes holds the text frame types whose values typically
+// hold lists of names.
+var multiValueFrameTypes = map[FrameType]bool{
+	FrameTypeTextArtist:            true,
+	FrameTypeTextAlbumArtist:       true,
+	FrameTypeTextConductor:         true,
+	FrameTypeTextRemixer:           true,
+	FrameTypeTextOriginalPerformer: true,
+	FrameTypeTextLyricist:          true,
+	FrameTypeTextOriginalLyricist:  true,
+	FrameTypeTextComposer:          true,
+	FrameTypeTextLanguage:          true,
+}
+
 type frameTypeMap struct {
 	FrameTypeToFrameID   map[FrameType]string
 	FrameIDToFrameType   map[string]FrameType
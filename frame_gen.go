@@ -0,0 +1,1042 @@
+// Code generated by framegen; DO NOT EDIT.
+
+package id3
+
+import (
+	"reflect"
+	"strconv"
+)
+
+func (f *FrameAttachedPicture) header() *FrameHeader {
+	if f == nil {
+		return nil
+	}
+	return &f.Header
+}
+
+func (f *FrameAttachedPicture) scan(r *reader, rf *reflector, state *state) {
+	state.field = "Encoding"
+	f.Encoding = Encoding(rf.readUint8(r, "Encoding"))
+	if r.err != nil {
+		return
+	}
+
+	state.field = "MimeType"
+	f.MimeType = WesternString(readWesternString(r))
+	if r.err != nil {
+		return
+	}
+
+	state.field = "PictureType"
+	f.PictureType = PictureType(rf.readUint8(r, "PictureType"))
+	if r.err != nil {
+		return
+	}
+
+	state.field = "Description"
+	f.Description = readString(r, f.Encoding)
+	if r.err != nil {
+		return
+	}
+
+	state.field = "Data"
+	f.Data = r.ConsumeAll()
+}
+
+func (f *FrameAttachedPicture) output(w *writer, rf *reflector, state *state) {
+	rf.selectOutputEncoding(w, f.Encoding, f.textIsLatin1, state)
+
+	state.field = "Encoding"
+	rf.writeUint8(w, "Encoding", uint8(state.encoding))
+	if w.err != nil {
+		return
+	}
+
+	state.field = "MimeType"
+	rf.writeWesternString(w, string(f.MimeType), true, state)
+	if w.err != nil {
+		return
+	}
+
+	state.field = "PictureType"
+	rf.writeUint8(w, "PictureType", uint8(f.PictureType))
+	if w.err != nil {
+		return
+	}
+
+	state.field = "Description"
+	rf.writeString(w, f.Description, true, state)
+	if w.err != nil {
+		return
+	}
+
+	state.field = "Data"
+	w.StoreBytes(f.Data)
+}
+
+func (f *FrameAttachedPicture) textIsLatin1() bool {
+	if !isLatin1(f.Description) {
+		return false
+	}
+	return true
+}
+
+func (f *FrameAudioEncryption) header() *FrameHeader {
+	if f == nil {
+		return nil
+	}
+	return &f.Header
+}
+
+func (f *FrameAudioEncryption) scan(r *reader, rf *reflector, state *state) {
+	state.field = "Owner"
+	f.Owner = WesternString(readWesternString(r))
+	if r.err != nil {
+		return
+	}
+
+	state.field = "PreviewStart"
+	f.PreviewStart = readUint16(r)
+	if r.err != nil {
+		return
+	}
+
+	state.field = "PreviewLength"
+	f.PreviewLength = readUint16(r)
+	if r.err != nil {
+		return
+	}
+
+	state.field = "Data"
+	f.Data = r.ConsumeAll()
+}
+
+func (f *FrameAudioEncryption) output(w *writer, rf *reflector, state *state) {
+	state.field = "Owner"
+	rf.writeWesternString(w, string(f.Owner), true, state)
+	if w.err != nil {
+		return
+	}
+
+	state.field = "PreviewStart"
+	writeUint16(w, f.PreviewStart)
+	if w.err != nil {
+		return
+	}
+
+	state.field = "PreviewLength"
+	writeUint16(w, f.PreviewLength)
+	if w.err != nil {
+		return
+	}
+
+	state.field = "Data"
+	w.StoreBytes(f.Data)
+}
+
+func (f *FrameAudioSeekPointIndex) header() *FrameHeader {
+	if f == nil {
+		return nil
+	}
+	return &f.Header
+}
+
+func (f *FrameAudioSeekPointIndex) scan(r *reader, rf *reflector, state *state) {
+	state.field = "IndexedDataStart"
+	f.IndexedDataStart = r.ConsumeUint32()
+	if r.err != nil {
+		return
+	}
+
+	state.field = "IndexedDataLength"
+	f.IndexedDataLength = r.ConsumeUint32()
+	if r.err != nil {
+		return
+	}
+
+	state.field = "IndexPoints"
+	f.IndexPoints = readUint16(r)
+	if r.err != nil {
+		return
+	}
+
+	state.field = "BitsPerIndex"
+	f.BitsPerIndex = rf.readUint8(r, "BitsPerIndex")
+	if r.err != nil {
+		return
+	}
+
+	state.field = "IndexOffsets"
+	f.IndexOffsets = rf.readIndexOffsets(r, uint32(f.IndexedDataLength), uint32(f.BitsPerIndex))
+}
+
+func (f *FrameAudioSeekPointIndex) output(w *writer, rf *reflector, state *state) {
+	state.field = "IndexedDataStart"
+	writeUint32(w, f.IndexedDataStart)
+	if w.err != nil {
+		return
+	}
+
+	state.field = "IndexedDataLength"
+	writeUint32(w, f.IndexedDataLength)
+	if w.err != nil {
+		return
+	}
+
+	state.field = "IndexPoints"
+	writeUint16(w, f.IndexPoints)
+	if w.err != nil {
+		return
+	}
+
+	state.field = "BitsPerIndex"
+	rf.writeUint8(w, "BitsPerIndex", f.BitsPerIndex)
+	if w.err != nil {
+		return
+	}
+
+	state.field = "IndexOffsets"
+	rf.writeIndexOffsets(w, f.IndexOffsets, uint32(f.IndexedDataLength), uint32(f.BitsPerIndex))
+}
+
+func (f *FrameComment) header() *FrameHeader {
+	if f == nil {
+		return nil
+	}
+	return &f.Header
+}
+
+func (f *FrameComment) scan(r *reader, rf *reflector, state *state) {
+	state.field = "Encoding"
+	f.Encoding = Encoding(rf.readUint8(r, "Encoding"))
+	if r.err != nil {
+		return
+	}
+
+	state.field = "Language"
+	f.Language = r.ConsumeFixedLengthString(3, EncodingISO88591)
+	if r.err != nil {
+		return
+	}
+
+	state.field = "Description"
+	f.Description = readString(r, f.Encoding)
+	if r.err != nil {
+		return
+	}
+
+	state.field = "Text"
+	f.Text = readString(r, f.Encoding)
+}
+
+func (f *FrameComment) output(w *writer, rf *reflector, state *state) {
+	rf.selectOutputEncoding(w, f.Encoding, f.textIsLatin1, state)
+
+	state.field = "Encoding"
+	rf.writeUint8(w, "Encoding", uint8(state.encoding))
+	if w.err != nil {
+		return
+	}
+
+	state.field = "Language"
+	w.StoreFixedLengthString(f.Language, 3, EncodingISO88591)
+	if w.err != nil {
+		return
+	}
+
+	state.field = "Description"
+	rf.writeString(w, f.Description, true, state)
+	if w.err != nil {
+		return
+	}
+
+	state.field = "Text"
+	rf.writeString(w, f.Text, false, state)
+}
+
+func (f *FrameComment) textIsLatin1() bool {
+	if !isLatin1(f.Description) {
+		return false
+	}
+	if !isLatin1(f.Text) {
+		return false
+	}
+	return true
+}
+
+func (f *FrameEncryptionMethodRegistration) header() *FrameHeader {
+	if f == nil {
+		return nil
+	}
+	return &f.Header
+}
+
+func (f *FrameEncryptionMethodRegistration) scan(r *reader, rf *reflector, state *state) {
+	state.field = "Owner"
+	f.Owner = WesternString(readWesternString(r))
+	if r.err != nil {
+		return
+	}
+
+	state.field = "EncryptMethod"
+	f.EncryptMethod = rf.readUint8(r, "EncryptMethod")
+	if r.err != nil {
+		return
+	}
+
+	state.field = "Data"
+	f.Data = r.ConsumeAll()
+}
+
+func (f *FrameEncryptionMethodRegistration) output(w *writer, rf *reflector, state *state) {
+	state.field = "Owner"
+	rf.writeWesternString(w, string(f.Owner), true, state)
+	if w.err != nil {
+		return
+	}
+
+	state.field = "EncryptMethod"
+	rf.writeUint8(w, "EncryptMethod", f.EncryptMethod)
+	if w.err != nil {
+		return
+	}
+
+	state.field = "Data"
+	w.StoreBytes(f.Data)
+}
+
+func (f *FrameGroupID) header() *FrameHeader {
+	if f == nil {
+		return nil
+	}
+	return &f.Header
+}
+
+func (f *FrameGroupID) scan(r *reader, rf *reflector, state *state) {
+	state.field = "Owner"
+	f.Owner = WesternString(readWesternString(r))
+	if r.err != nil {
+		return
+	}
+
+	state.field = "GroupID"
+	f.GroupID = rf.readUint8(r, "GroupID")
+	if r.err != nil {
+		return
+	}
+
+	state.field = "Data"
+	f.Data = r.ConsumeAll()
+}
+
+func (f *FrameGroupID) output(w *writer, rf *reflector, state *state) {
+	state.field = "Owner"
+	rf.writeWesternString(w, string(f.Owner), true, state)
+	if w.err != nil {
+		return
+	}
+
+	state.field = "GroupID"
+	rf.writeUint8(w, "GroupID", f.GroupID)
+	if w.err != nil {
+		return
+	}
+
+	state.field = "Data"
+	w.StoreBytes(f.Data)
+}
+
+func (f *FrameLyricsSync) header() *FrameHeader {
+	if f == nil {
+		return nil
+	}
+	return &f.Header
+}
+
+func (f *FrameLyricsSync) scan(r *reader, rf *reflector, state *state) {
+	state.field = "Encoding"
+	f.Encoding = Encoding(rf.readUint8(r, "Encoding"))
+	if r.err != nil {
+		return
+	}
+
+	state.field = "Language"
+	f.Language = r.ConsumeFixedLengthString(3, EncodingISO88591)
+	if r.err != nil {
+		return
+	}
+
+	state.field = "TimeStampFormat"
+	f.TimeStampFormat = TimeStampFormat(rf.readUint8(r, "TimeStampFormat"))
+	if r.err != nil {
+		return
+	}
+
+	state.field = "LyricContentType"
+	f.LyricContentType = LyricContentType(rf.readUint8(r, "LyricContentType"))
+	if r.err != nil {
+		return
+	}
+
+	state.field = "Descriptor"
+	f.Descriptor = readString(r, f.Encoding)
+	if r.err != nil {
+		return
+	}
+
+	state.field = "Sync"
+	f.Sync = make([]LyricsSync, 0)
+	for i0 := 0; r.Len() > 0; i0++ {
+		if r.err = checkLimit("MaxEntries", r.limits().MaxEntries, i0+1); r.err != nil {
+			return
+		}
+
+		n0 := r.Len()
+		p0 := "Sync[" + strconv.Itoa(i0) + "]."
+		var e0 LyricsSync
+		state.field = p0 + "Text"
+		e0.Text = readString(r, f.Encoding)
+		if r.err != nil {
+			return
+		}
+
+		state.field = p0 + "TimeStamp"
+		e0.TimeStamp = r.ConsumeUint32()
+		if r.err != nil {
+			return
+		}
+
+		// An element that consumes no data would repeat forever.
+		if r.Len() == n0 {
+			r.err = ErrInvalidPayloadDef
+			return
+		}
+
+		f.Sync = append(f.Sync, e0)
+	}
+}
+
+func (f *FrameLyricsSync) output(w *writer, rf *reflector, state *state) {
+	rf.selectOutputEncoding(w, f.Encoding, f.textIsLatin1, state)
+
+	state.field = "Encoding"
+	rf.writeUint8(w, "Encoding", uint8(state.encoding))
+	if w.err != nil {
+		return
+	}
+
+	state.field = "Language"
+	w.StoreFixedLengthString(f.Language, 3, EncodingISO88591)
+	if w.err != nil {
+		return
+	}
+
+	state.field = "TimeStampFormat"
+	rf.writeUint8(w, "TimeStampFormat", uint8(f.TimeStampFormat))
+	if w.err != nil {
+		return
+	}
+
+	state.field = "LyricContentType"
+	rf.writeUint8(w, "LyricContentType", uint8(f.LyricContentType))
+	if w.err != nil {
+		return
+	}
+
+	state.field = "Descriptor"
+	rf.writeString(w, f.Descriptor, true, state)
+	if w.err != nil {
+		return
+	}
+
+	state.field = "Sync"
+	for i0 := range f.Sync {
+		e0 := &f.Sync[i0]
+		p0 := "Sync[" + strconv.Itoa(i0) + "]."
+		state.field = p0 + "Text"
+		rf.writeString(w, e0.Text, true, state)
+		if w.err != nil {
+			return
+		}
+
+		state.field = p0 + "TimeStamp"
+		writeUint32(w, e0.TimeStamp)
+		if w.err != nil {
+			return
+		}
+	}
+}
+
+func (f *FrameLyricsSync) textIsLatin1() bool {
+	if !isLatin1(f.Descriptor) {
+		return false
+	}
+	for i0 := range f.Sync {
+		e0 := &f.Sync[i0]
+		if !isLatin1(e0.Text) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *FrameLyricsUnsync) header() *FrameHeader {
+	if f == nil {
+		return nil
+	}
+	return &f.Header
+}
+
+func (f *FrameLyricsUnsync) scan(r *reader, rf *reflector, state *state) {
+	state.field = "Encoding"
+	f.Encoding = Encoding(rf.readUint8(r, "Encoding"))
+	if r.err != nil {
+		return
+	}
+
+	state.field = "Language"
+	f.Language = r.ConsumeFixedLengthString(3, EncodingISO88591)
+	if r.err != nil {
+		return
+	}
+
+	state.field = "Descriptor"
+	f.Descriptor = readString(r, f.Encoding)
+	if r.err != nil {
+		return
+	}
+
+	state.field = "Text"
+	f.Text = readString(r, f.Encoding)
+}
+
+func (f *FrameLyricsUnsync) output(w *writer, rf *reflector, state *state) {
+	rf.selectOutputEncoding(w, f.Encoding, f.textIsLatin1, state)
+
+	state.field = "Encoding"
+	rf.writeUint8(w, "Encoding", uint8(state.encoding))
+	if w.err != nil {
+		return
+	}
+
+	state.field = "Language"
+	w.StoreFixedLengthString(f.Language, 3, EncodingISO88591)
+	if w.err != nil {
+		return
+	}
+
+	state.field = "Descriptor"
+	rf.writeString(w, f.Descriptor, true, state)
+	if w.err != nil {
+		return
+	}
+
+	state.field = "Text"
+	rf.writeString(w, f.Text, false, state)
+}
+
+func (f *FrameLyricsUnsync) textIsLatin1() bool {
+	if !isLatin1(f.Descriptor) {
+		return false
+	}
+	if !isLatin1(f.Text) {
+		return false
+	}
+	return true
+}
+
+func (f *FramePrivate) header() *FrameHeader {
+	if f == nil {
+		return nil
+	}
+	return &f.Header
+}
+
+func (f *FramePrivate) scan(r *reader, rf *reflector, state *state) {
+	state.field = "Owner"
+	f.Owner = WesternString(readWesternString(r))
+	if r.err != nil {
+		return
+	}
+
+	state.field = "Data"
+	f.Data = r.ConsumeAll()
+}
+
+func (f *FramePrivate) output(w *writer, rf *reflector, state *state) {
+	state.field = "Owner"
+	rf.writeWesternString(w, string(f.Owner), true, state)
+	if w.err != nil {
+		return
+	}
+
+	state.field = "Data"
+	w.StoreBytes(f.Data)
+}
+
+func (f *FramePlayCount) header() *FrameHeader {
+	if f == nil {
+		return nil
+	}
+	return &f.Header
+}
+
+func (f *FramePlayCount) scan(r *reader, rf *reflector, state *state) {
+	state.field = "Counter"
+	f.Counter = readCounter(r)
+}
+
+func (f *FramePlayCount) output(w *writer, rf *reflector, state *state) {
+	state.field = "Counter"
+	writeCounter(w, f.Counter)
+}
+
+func (f *FramePopularimeter) header() *FrameHeader {
+	if f == nil {
+		return nil
+	}
+	return &f.Header
+}
+
+func (f *FramePopularimeter) scan(r *reader, rf *reflector, state *state) {
+	state.field = "Email"
+	f.Email = WesternString(readWesternString(r))
+	if r.err != nil {
+		return
+	}
+
+	state.field = "Rating"
+	f.Rating = rf.readUint8(r, "Rating")
+	if r.err != nil {
+		return
+	}
+
+	state.field = "Counter"
+	f.Counter = readCounter(r)
+}
+
+func (f *FramePopularimeter) output(w *writer, rf *reflector, state *state) {
+	state.field = "Email"
+	rf.writeWesternString(w, string(f.Email), true, state)
+	if w.err != nil {
+		return
+	}
+
+	state.field = "Rating"
+	rf.writeUint8(w, "Rating", f.Rating)
+	if w.err != nil {
+		return
+	}
+
+	state.field = "Counter"
+	writeCounter(w, f.Counter)
+}
+
+func (f *FrameSyncTempoCodes) header() *FrameHeader {
+	if f == nil {
+		return nil
+	}
+	return &f.Header
+}
+
+func (f *FrameSyncTempoCodes) scan(r *reader, rf *reflector, state *state) {
+	state.field = "TimeStampFormat"
+	f.TimeStampFormat = TimeStampFormat(rf.readUint8(r, "TimeStampFormat"))
+	if r.err != nil {
+		return
+	}
+
+	state.field = "Sync"
+	f.Sync = make([]TempoSync, 0)
+	for i0 := 0; r.Len() > 0; i0++ {
+		if r.err = checkLimit("MaxEntries", r.limits().MaxEntries, i0+1); r.err != nil {
+			return
+		}
+
+		n0 := r.Len()
+		p0 := "Sync[" + strconv.Itoa(i0) + "]."
+		var e0 TempoSync
+		state.field = p0 + "BPM"
+		e0.BPM = readBPM(r)
+		if r.err != nil {
+			return
+		}
+
+		state.field = p0 + "TimeStamp"
+		e0.TimeStamp = r.ConsumeUint32()
+		if r.err != nil {
+			return
+		}
+
+		// An element that consumes no data would repeat forever.
+		if r.Len() == n0 {
+			r.err = ErrInvalidPayloadDef
+			return
+		}
+
+		f.Sync = append(f.Sync, e0)
+	}
+}
+
+func (f *FrameSyncTempoCodes) output(w *writer, rf *reflector, state *state) {
+	state.field = "TimeStampFormat"
+	rf.writeUint8(w, "TimeStampFormat", uint8(f.TimeStampFormat))
+	if w.err != nil {
+		return
+	}
+
+	state.field = "Sync"
+	for i0 := range f.Sync {
+		e0 := &f.Sync[i0]
+		p0 := "Sync[" + strconv.Itoa(i0) + "]."
+		state.field = p0 + "BPM"
+		writeBPM(w, e0.BPM)
+		if w.err != nil {
+			return
+		}
+
+		state.field = p0 + "TimeStamp"
+		writeUint32(w, e0.TimeStamp)
+		if w.err != nil {
+			return
+		}
+	}
+}
+
+func (f *FrameTermsOfUse) header() *FrameHeader {
+	if f == nil {
+		return nil
+	}
+	return &f.Header
+}
+
+func (f *FrameTermsOfUse) scan(r *reader, rf *reflector, state *state) {
+	state.field = "Encoding"
+	f.Encoding = Encoding(rf.readUint8(r, "Encoding"))
+	if r.err != nil {
+		return
+	}
+
+	state.field = "Language"
+	f.Language = r.ConsumeFixedLengthString(3, EncodingISO88591)
+	if r.err != nil {
+		return
+	}
+
+	state.field = "Text"
+	f.Text = readString(r, f.Encoding)
+}
+
+func (f *FrameTermsOfUse) output(w *writer, rf *reflector, state *state) {
+	rf.selectOutputEncoding(w, f.Encoding, f.textIsLatin1, state)
+
+	state.field = "Encoding"
+	rf.writeUint8(w, "Encoding", uint8(state.encoding))
+	if w.err != nil {
+		return
+	}
+
+	state.field = "Language"
+	w.StoreFixedLengthString(f.Language, 3, EncodingISO88591)
+	if w.err != nil {
+		return
+	}
+
+	state.field = "Text"
+	rf.writeString(w, f.Text, false, state)
+}
+
+func (f *FrameTermsOfUse) textIsLatin1() bool {
+	if !isLatin1(f.Text) {
+		return false
+	}
+	return true
+}
+
+func (f *FrameText) header() *FrameHeader {
+	if f == nil {
+		return nil
+	}
+	return &f.Header
+}
+
+func (f *FrameText) scan(r *reader, rf *reflector, state *state) {
+	state.field = "Encoding"
+	f.Encoding = Encoding(rf.readUint8(r, "Encoding"))
+	if r.err != nil {
+		return
+	}
+
+	state.field = "Text"
+	f.Text = rf.readStrings(r, f.Encoding, state)
+}
+
+func (f *FrameText) output(w *writer, rf *reflector, state *state) {
+	rf.selectOutputEncoding(w, f.Encoding, f.textIsLatin1, state)
+
+	state.field = "Encoding"
+	rf.writeUint8(w, "Encoding", uint8(state.encoding))
+	if w.err != nil {
+		return
+	}
+
+	state.field = "Text"
+	rf.writeStrings(w, f.Text, state)
+}
+
+func (f *FrameText) textIsLatin1() bool {
+	for _, s := range f.Text {
+		if !isLatin1(s) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *FrameTextCustom) header() *FrameHeader {
+	if f == nil {
+		return nil
+	}
+	return &f.Header
+}
+
+func (f *FrameTextCustom) scan(r *reader, rf *reflector, state *state) {
+	state.field = "Encoding"
+	f.Encoding = Encoding(rf.readUint8(r, "Encoding"))
+	if r.err != nil {
+		return
+	}
+
+	state.field = "Description"
+	f.Description = readString(r, f.Encoding)
+	if r.err != nil {
+		return
+	}
+
+	state.field = "Text"
+	f.Text = readString(r, f.Encoding)
+}
+
+func (f *FrameTextCustom) output(w *writer, rf *reflector, state *state) {
+	rf.selectOutputEncoding(w, f.Encoding, f.textIsLatin1, state)
+
+	state.field = "Encoding"
+	rf.writeUint8(w, "Encoding", uint8(state.encoding))
+	if w.err != nil {
+		return
+	}
+
+	state.field = "Description"
+	rf.writeString(w, f.Description, true, state)
+	if w.err != nil {
+		return
+	}
+
+	state.field = "Text"
+	rf.writeString(w, f.Text, false, state)
+}
+
+func (f *FrameTextCustom) textIsLatin1() bool {
+	if !isLatin1(f.Description) {
+		return false
+	}
+	if !isLatin1(f.Text) {
+		return false
+	}
+	return true
+}
+
+func (f *FrameUnknown) header() *FrameHeader {
+	if f == nil {
+		return nil
+	}
+	return &f.Header
+}
+
+func (f *FrameUnknown) scan(r *reader, rf *reflector, state *state) {
+	state.field = "FrameID"
+	f.FrameID = state.frameID
+	if r.err != nil {
+		return
+	}
+
+	state.field = "Data"
+	f.Data = r.ConsumeAll()
+}
+
+func (f *FrameUnknown) output(w *writer, rf *reflector, state *state) {
+	state.field = "FrameID"
+	state.frameID = f.FrameID
+	if w.err != nil {
+		return
+	}
+
+	state.field = "Data"
+	w.StoreBytes(f.Data)
+}
+
+func (f *FrameURL) header() *FrameHeader {
+	if f == nil {
+		return nil
+	}
+	return &f.Header
+}
+
+func (f *FrameURL) scan(r *reader, rf *reflector, state *state) {
+	state.field = "URL"
+	f.URL = WesternString(readWesternString(r))
+}
+
+func (f *FrameURL) output(w *writer, rf *reflector, state *state) {
+	state.field = "URL"
+	rf.writeWesternString(w, string(f.URL), false, state)
+}
+
+func (f *FrameURLCustom) header() *FrameHeader {
+	if f == nil {
+		return nil
+	}
+	return &f.Header
+}
+
+func (f *FrameURLCustom) scan(r *reader, rf *reflector, state *state) {
+	state.field = "Encoding"
+	f.Encoding = Encoding(rf.readUint8(r, "Encoding"))
+	if r.err != nil {
+		return
+	}
+
+	state.field = "Description"
+	f.Description = readString(r, f.Encoding)
+	if r.err != nil {
+		return
+	}
+
+	state.field = "URL"
+	f.URL = WesternString(readWesternString(r))
+}
+
+func (f *FrameURLCustom) output(w *writer, rf *reflector, state *state) {
+	rf.selectOutputEncoding(w, f.Encoding, f.textIsLatin1, state)
+
+	state.field = "Encoding"
+	rf.writeUint8(w, "Encoding", uint8(state.encoding))
+	if w.err != nil {
+		return
+	}
+
+	state.field = "Description"
+	rf.writeString(w, f.Description, true, state)
+	if w.err != nil {
+		return
+	}
+
+	state.field = "URL"
+	rf.writeWesternString(w, string(f.URL), false, state)
+}
+
+func (f *FrameURLCustom) textIsLatin1() bool {
+	if !isLatin1(f.Description) {
+		return false
+	}
+	return true
+}
+
+func (f *FrameUniqueFileID) header() *FrameHeader {
+	if f == nil {
+		return nil
+	}
+	return &f.Header
+}
+
+func (f *FrameUniqueFileID) scan(r *reader, rf *reflector, state *state) {
+	state.field = "Owner"
+	f.Owner = WesternString(readWesternString(r))
+	if r.err != nil {
+		return
+	}
+
+	state.field = "Identifier"
+	f.Identifier = WesternString(readWesternString(r))
+}
+
+func (f *FrameUniqueFileID) output(w *writer, rf *reflector, state *state) {
+	state.field = "Owner"
+	rf.writeWesternString(w, string(f.Owner), true, state)
+	if w.err != nil {
+		return
+	}
+
+	state.field = "Identifier"
+	rf.writeWesternString(w, string(f.Identifier), false, state)
+}
+
+// generatedFrames holds a constructor for each frame type with generated
+// scan and output methods.
+var generatedFrames = map[reflect.Type]func() generatedFrame{
+	reflect.TypeOf(FrameAttachedPicture{}):              func() generatedFrame { return new(FrameAttachedPicture) },
+	reflect.TypeOf(FrameAudioEncryption{}):              func() generatedFrame { return new(FrameAudioEncryption) },
+	reflect.TypeOf(FrameAudioSeekPointIndex{}):          func() generatedFrame { return new(FrameAudioSeekPointIndex) },
+	reflect.TypeOf(FrameComment{}):                      func() generatedFrame { return new(FrameComment) },
+	reflect.TypeOf(FrameEncryptionMethodRegistration{}): func() generatedFrame { return new(FrameEncryptionMethodRegistration) },
+	reflect.TypeOf(FrameGroupID{}):                      func() generatedFrame { return new(FrameGroupID) },
+	reflect.TypeOf(FrameLyricsSync{}):                   func() generatedFrame { return new(FrameLyricsSync) },
+	reflect.TypeOf(FrameLyricsUnsync{}):                 func() generatedFrame { return new(FrameLyricsUnsync) },
+	reflect.TypeOf(FramePrivate{}):                      func() generatedFrame { return new(FramePrivate) },
+	reflect.TypeOf(FramePlayCount{}):                    func() generatedFrame { return new(FramePlayCount) },
+	reflect.TypeOf(FramePopularimeter{}):                func() generatedFrame { return new(FramePopularimeter) },
+	reflect.TypeOf(FrameSyncTempoCodes{}):               func() generatedFrame { return new(FrameSyncTempoCodes) },
+	reflect.TypeOf(FrameTermsOfUse{}):                   func() generatedFrame { return new(FrameTermsOfUse) },
+	reflect.TypeOf(FrameText{}):                         func() generatedFrame { return new(FrameText) },
+	reflect.TypeOf(FrameTextCustom{}):                   func() generatedFrame { return new(FrameTextCustom) },
+	reflect.TypeOf(FrameUnknown{}):                      func() generatedFrame { return new(FrameUnknown) },
+	reflect.TypeOf(FrameURL{}):                          func() generatedFrame { return new(FrameURL) },
+	reflect.TypeOf(FrameURLCustom{}):                    func() generatedFrame { return new(FrameURLCustom) },
+	reflect.TypeOf(FrameUniqueFileID{}):                 func() generatedFrame { return new(FrameUniqueFileID) },
+}
+
+// asGeneratedFrame returns f if its type has generated scan and output
+// methods, or nil otherwise.
+func asGeneratedFrame(f Frame) generatedFrame {
+	switch f := f.(type) {
+	case *FrameAttachedPicture:
+		return f
+	case *FrameAudioEncryption:
+		return f
+	case *FrameAudioSeekPointIndex:
+		return f
+	case *FrameComment:
+		return f
+	case *FrameEncryptionMethodRegistration:
+		return f
+	case *FrameGroupID:
+		return f
+	case *FrameLyricsSync:
+		return f
+	case *FrameLyricsUnsync:
+		return f
+	case *FramePrivate:
+		return f
+	case *FramePlayCount:
+		return f
+	case *FramePopularimeter:
+		return f
+	case *FrameSyncTempoCodes:
+		return f
+	case *FrameTermsOfUse:
+		return f
+	case *FrameText:
+		return f
+	case *FrameTextCustom:
+		return f
+	case *FrameUnknown:
+		return f
+	case *FrameURL:
+		return f
+	case *FrameURLCustom:
+		return f
+	case *FrameUniqueFileID:
+		return f
+	}
+	return nil
+}
@@ -0,0 +1,466 @@
+package id3
+
+import (
+	"bytes"
+	"io"
+)
+
+// DefaultMaxFrameSize is the size of the largest frame payload a
+// FrameScanner holds in memory when ScanOptions.MaxFrameSize is zero.
+const DefaultMaxFrameSize = 16 << 20
+
+// ScanOptions control the behavior of a FrameScanner.
+type ScanOptions struct {
+	DecodeOptions
+
+	// MaxFrameSize is the size in bytes of the largest frame payload the
+	// scanner will hold in memory. Larger frames can only be read as a
+	// stream with Payload. If zero, DefaultMaxFrameSize is used.
+	//
+	// Unlike DecodeOptions.Limits.MaxFrameSize, which is enforced by Next
+	// and stops the scan at the first frame exceeding it, MaxFrameSize
+	// only bounds the frames Frame decodes.
+	MaxFrameSize int
+}
+
+// A FrameScanner reads the frames of an ID3 tag from a stream one at a
+// time, without holding the entire tag in memory. Successive calls to Next
+// step through the frames of the tag. The current frame may be decoded
+// with Frame, or its payload read as a stream with Payload, which is
+// useful for frames holding large binary data like pictures or embedded
+// objects. Frames that aren't read are skipped.
+//
+// A FrameScanner does not validate the tag's CRC. When it finishes, the
+// stream is positioned at the first byte following the tag.
+type FrameScanner struct {
+	Version  Version  // ID3 codec version (2.3 or 2.4)
+	Flags    TagFlags // Flags
+	Size     int      // Size not including the header
+	Warnings []error  // Problems tolerated while decoding in lenient mode
+
+	opts    ScanOptions
+	r       io.Reader
+	codec   versionCodec
+	vdata   *versionData
+	tag     *io.LimitedReader // remaining raw tag data
+	body    *lookahead        // tag data after removing unsync codes
+	pos     int64             // offset of the next byte of body
+	exSize  int64             // size of the extended header
+	grown   bool              // true if the tag was extended by exSize
+	hdr     []byte            // raw header of the current frame
+	header  FrameHeader       // header of the current frame
+	offset  int64             // offset of the current frame
+	plain   bool              // true if the frame's size is a plain integer
+	payload *io.LimitedReader // unread payload of the current frame
+	data    []byte            // payload of the current frame, if read
+	frame   Frame             // current frame, if decoded
+	decoded bool              // true once the frame's warnings are recorded
+	frames  int               // number of frames scanned
+	done    bool
+	err     error
+}
+
+// NewFrameScanner reads the header of the ID3 tag at the start of r and
+// returns a FrameScanner for its frames.
+func NewFrameScanner(r io.Reader) (*FrameScanner, error) {
+	return NewFrameScannerWithOptions(r, ScanOptions{})
+}
+
+// NewFrameScannerWithOptions reads the header of the ID3 tag at the start
+// of r and returns a FrameScanner for its frames, which uses the requested
+// options.
+func NewFrameScannerWithOptions(r io.Reader, opts ScanOptions) (*FrameScanner, error) {
+	if opts.MaxFrameSize == 0 {
+		opts.MaxFrameSize = DefaultMaxFrameSize
+	}
+
+	hdr := make([]byte, 10)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	v, size, err := PeekTag(hdr)
+	if err != nil {
+		return nil, ErrInvalidTag
+	}
+
+	codec, err := newCodec(v)
+	if err != nil {
+		return nil, err
+	}
+	vdata := versionDataOf(v)
+	if vdata == nil {
+		return nil, errUnimplemented
+	}
+
+	s := &FrameScanner{
+		Version: v,
+		Flags:   TagFlags(vdata.headerFlags.Decode(uint32(hdr[5]))),
+		Size:    size - 10,
+		opts:    opts,
+		r:       r,
+		codec:   codec,
+		vdata:   vdata,
+	}
+	s.tag = &io.LimitedReader{R: r, N: int64(s.Size)}
+	s.body = &lookahead{r: s.tag}
+	if (s.Flags & TagFlagUnsync) != 0 {
+		s.body.r = &unsyncReader{r: s.tag}
+	}
+
+	if err := s.skipExtendedHeader(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// skipExtendedHeader consumes the extended header of the tag, whose size
+// includes the size field.
+func (s *FrameScanner) skipExtendedHeader() error {
+	if (s.Flags & TagFlagExtended) == 0 {
+		return nil
+	}
+
+	b := make([]byte, 4)
+	if _, err := io.ReadFull(s.body, b); err != nil {
+		return ErrInvalidHeader
+	}
+	var n uint32
+	var err error
+	if s.Version == Version2_3 {
+		n, err = decodeUint32(b)
+	} else {
+		n, err = decodeSyncSafeUint32(b)
+	}
+	if err != nil || n < 4 {
+		return ErrInvalidHeader
+	}
+	if _, err := io.CopyN(io.Discard, s.body, int64(n)-4); err != nil {
+		return ErrInvalidHeader
+	}
+	s.pos, s.exSize = int64(n), int64(n)
+	return nil
+}
+
+// Next advances the scanner to the next frame of the tag, skipping any
+// unread portion of the current frame. It returns false when there are no
+// more frames or an error occurs. After Next returns false, Err returns
+// the error, if any. A frame whose payload exceeds the MaxFrameSize decode
+// limit produces an error wrapping a LimitError.
+//
+// In lenient mode, Next tolerates the same problems as Tag.ReadFrom and
+// records them in the scanner's Warnings. A frame that can't be located
+// ends the scan without an error.
+func (s *FrameScanner) Next() bool {
+	if s.done {
+		return false
+	}
+
+	if s.payload != nil {
+		if _, err := io.Copy(io.Discard, &payloadReader{s}); err != nil {
+			return s.stop(s.frameError(ErrIncompleteFrame))
+		}
+	}
+	s.payload, s.data, s.frame, s.decoded = nil, nil, nil, false
+
+	// Running out of data, or a frame ID starting with a zero byte,
+	// indicates padding.
+	s.offset = s.pos + 10
+	b := make([]byte, 10)
+	n, err := io.ReadFull(s.body, b)
+	switch {
+	case err != nil && err != io.EOF && err != io.ErrUnexpectedEOF:
+		return s.fail(err)
+	case n == 0:
+		return s.fail(nil)
+	case b[0] == 0 || (s.opts.Lenient && (n < 4 || !validFrameID(b[:4]))):
+		return s.padding(b[:n])
+	}
+	s.pos += int64(n)
+
+	var id string
+	if n >= 4 {
+		id = string(b[:4])
+	}
+
+	// Some encoders exclude the extended header from the tag size,
+	// truncating the last frame. Extend the tag and read the rest.
+	if n < 10 && s.grow() {
+		m, err := io.ReadFull(s.body, b[n:])
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return s.fail(err)
+		}
+		n += m
+		s.pos += int64(m)
+	}
+	if n < 10 {
+		return s.stop(&DecodeError{Err: ErrIncompleteFrame, Offset: int(s.offset), FrameID: id, Version: s.Version})
+	}
+
+	var peekErr error
+	size, plain, err := frameSize(s.Version, b[4:8], s.opts.Lenient, func(off, n int) []byte {
+		// Look no further ahead than the largest frame Frame decodes.
+		if off+n > s.opts.MaxFrameSize+4 {
+			return nil
+		}
+		p, err := s.body.Peek(off + n)
+		if err != nil {
+			peekErr = err
+		}
+		return window(p, off, n)
+	})
+	if peekErr != nil {
+		return s.fail(peekErr)
+	}
+	if err == nil && int64(size) > int64(s.Size) {
+		err = ErrInvalidFrameHeader
+	}
+	if err != nil {
+		return s.stop(&DecodeError{Err: err, Offset: int(s.offset), FrameID: id, Version: s.Version})
+	}
+
+	if err := checkLimit("MaxFrameSize", s.opts.Limits.MaxFrameSize, size); err != nil {
+		return s.fail(&DecodeError{Err: err, Offset: int(s.offset), FrameID: id, Version: s.Version})
+	}
+	if plain {
+		s.Warnings = append(s.Warnings, &DecodeError{Err: ErrInvalidFrameSize, Offset: int(s.offset), FrameID: id, Version: s.Version})
+	}
+
+	s.frames++
+	if err := checkLimit("MaxFrames", s.opts.Limits.MaxFrames, s.frames); err != nil {
+		return s.fail(err)
+	}
+
+	s.hdr = b
+	s.header = FrameHeader{
+		FrameType: s.vdata.frameTypes.LookupFrameType(id),
+		FrameID:   id,
+		Size:      size,
+		Flags:     FrameFlags(s.vdata.frameFlags.Decode(uint32(b[8])<<8 | uint32(b[9]))),
+	}
+	s.plain = plain
+	s.payload = &io.LimitedReader{R: s.body, N: int64(size)}
+	return true
+}
+
+// padding consumes the padding at the end of the tag, whose first bytes b
+// have been read, and stops the scanner. In lenient mode, padding
+// containing non-zero bytes is recorded as a warning.
+func (s *FrameScanner) padding(b []byte) bool {
+	if s.opts.Lenient {
+		z := &zeroWriter{nonZero: !isZero(b)}
+		if _, err := io.Copy(z, s.body); err != nil {
+			return s.fail(err)
+		}
+		if z.nonZero {
+			s.Warnings = append(s.Warnings, &DecodeError{Err: ErrInvalidPadding, Offset: int(s.offset), Version: s.Version})
+		}
+	}
+	return s.fail(nil)
+}
+
+// grow extends the tag by the size of its extended header, for tags whose
+// size excludes it. It does so at most once, and only in lenient mode.
+func (s *FrameScanner) grow() bool {
+	if !s.opts.Lenient || s.exSize == 0 || s.grown {
+		return false
+	}
+	s.grown = true
+	s.tag.N += s.exSize
+	s.Size += int(s.exSize)
+	s.Warnings = append(s.Warnings, ErrInvalidTagSize)
+	return true
+}
+
+// stop stops the scanner at a frame that can't be located or read. In
+// lenient mode, the error is recorded as a warning instead, unless it
+// reports an exceeded decode limit.
+func (s *FrameScanner) stop(de *DecodeError) bool {
+	if s.opts.Lenient && !isLimitError(de) {
+		s.Warnings = append(s.Warnings, de)
+		return s.fail(nil)
+	}
+	return s.fail(de)
+}
+
+// fail stops the scanner, discarding the rest of the tag so that the
+// stream is positioned after it. It records err unless it is nil.
+func (s *FrameScanner) fail(err error) bool {
+	s.done = true
+	s.payload, s.data, s.frame = nil, nil, nil
+	if err == nil {
+		if _, err = io.Copy(io.Discard, s.tag); err == nil && s.tag.N > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+	}
+	if err == nil && (s.Flags&TagFlagFooter) != 0 {
+		if _, err = io.CopyN(io.Discard, s.r, 10); err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+	}
+	s.err = err
+	return false
+}
+
+// frameError returns err as a DecodeError describing the current frame.
+func (s *FrameScanner) frameError(err error) *DecodeError {
+	de := frameDecodeError(err, s.header.FrameID)
+	de.Offset, de.Version = int(s.offset), s.Version
+	return de
+}
+
+// Header returns the header of the current frame. The header's Size field
+// holds the size of the frame's payload as stored in the tag.
+func (s *FrameScanner) Header() FrameHeader {
+	return s.header
+}
+
+// Offset returns the offset of the current frame from the start of the
+// tag. For a tag using unsynchronization, the offset is counted after
+// removing the unsync codes.
+func (s *FrameScanner) Offset() int64 {
+	return s.offset
+}
+
+// Frame reads and decodes the current frame. It returns an error
+// wrapping ErrFrameTooLarge if the frame's payload exceeds the maximum
+// frame size, and ErrFrameConsumed if the payload has already been read
+// with Payload.
+func (s *FrameScanner) Frame() (Frame, error) {
+	if s.frame != nil {
+		return s.frame, nil
+	}
+	if s.payload == nil {
+		return nil, io.EOF
+	}
+	if s.data == nil {
+		if s.header.Size > s.opts.MaxFrameSize {
+			return nil, s.frameError(ErrFrameTooLarge)
+		}
+		if s.payload.N < int64(s.header.Size) {
+			return nil, s.frameError(ErrFrameConsumed)
+		}
+		s.data = make([]byte, 10+s.header.Size)
+		copy(s.data, s.hdr)
+		if _, err := io.ReadFull(&payloadReader{s}, s.data[10:]); err != nil {
+			err = s.frameError(ErrIncompleteFrame)
+			s.fail(err)
+			return nil, err
+		}
+
+		// The frame's size was already located, so store it sync-safe
+		// to avoid warning about it again.
+		if s.plain {
+			encodeSyncSafeUint32(s.data[4:8], uint32(s.header.Size))
+		}
+	}
+
+	r := newReader(nil, &s.opts.DecodeOptions)
+	r.ReplaceBuffer(s.data)
+	t := &Tag{Version: s.Version, Flags: s.Flags}
+
+	var f Frame
+	err := s.codec.DecodeFrame(t, &f, r)
+	if !s.decoded {
+		for _, w := range t.Warnings {
+			if de, ok := w.(*DecodeError); ok {
+				de.Offset, de.Version = int(s.offset), s.Version
+			}
+		}
+		s.Warnings = append(s.Warnings, t.Warnings...)
+		s.decoded = true
+	}
+	if err != nil {
+		return nil, s.frameError(err)
+	}
+	s.frame = f
+	return f, nil
+}
+
+// Payload returns a reader for the payload of the current frame as stored
+// in the tag, without its frame header and without decoding it. For a tag
+// using unsynchronization, the unsync codes are removed. The reader is
+// valid until the next call to Next.
+func (s *FrameScanner) Payload() io.Reader {
+	if s.payload == nil {
+		return bytes.NewReader(nil)
+	}
+	if s.data != nil {
+		return bytes.NewReader(s.data[10:])
+	}
+	return &payloadReader{s}
+}
+
+// A payloadReader reads the payload of a FrameScanner's current frame,
+// keeping track of the scanner's position.
+type payloadReader struct {
+	s *FrameScanner
+}
+
+func (p *payloadReader) Read(b []byte) (int, error) {
+	n, err := p.s.payload.Read(b)
+	p.s.pos += int64(n)
+	if err == io.EOF && p.s.payload.N > 0 {
+		// The tag may end early if its size excludes the extended
+		// header.
+		if p.s.grow() {
+			return n, nil
+		}
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// A lookahead reads from a stream while allowing data to be examined
+// before it is consumed.
+type lookahead struct {
+	r   io.Reader
+	buf []byte // data read from r but not yet consumed
+}
+
+func (l *lookahead) Read(b []byte) (int, error) {
+	if len(l.buf) > 0 {
+		n := copy(b, l.buf)
+		l.buf = l.buf[n:]
+		return n, nil
+	}
+	return l.r.Read(b)
+}
+
+// Peek returns up to the next n bytes of the stream without consuming
+// them. It returns fewer bytes only at the end of the stream or if an
+// error occurs.
+func (l *lookahead) Peek(n int) ([]byte, error) {
+	if m := n - len(l.buf); m > 0 {
+		b := make([]byte, m)
+		k, err := io.ReadFull(l.r, b)
+		l.buf = append(l.buf, b[:k]...)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return l.buf, err
+		}
+	}
+	if n > len(l.buf) {
+		n = len(l.buf)
+	}
+	return l.buf[:n], nil
+}
+
+// A zeroWriter discards the data written to it, recording whether any of
+// it is non-zero.
+type zeroWriter struct {
+	nonZero bool
+}
+
+func (z *zeroWriter) Write(b []byte) (int, error) {
+	if !isZero(b) {
+		z.nonZero = true
+	}
+	return len(b), nil
+}
+
+// Err returns the first error encountered by the scanner.
+func (s *FrameScanner) Err() error {
+	return s.err
+}
@@ -0,0 +1,136 @@
+package id3
+
+import (
+	"bytes"
+	"testing"
+	"unicode/utf8"
+)
+
+// fuzzSeeds returns hand-built tags of the requested version used to seed
+// the fuzz targets, in addition to the corpus in testdata/fuzz.
+func fuzzSeeds(v Version) [][]byte {
+	var seeds [][]byte
+	for _, flags := range []TagFlags{0, TagFlagUnsync, TagFlagHasCRC} {
+		tag := NewTag(v, flags)
+		tag.Frames = append(tag.Frames,
+			NewFrameText(FrameTypeTextSongTitle, "Title"),
+			NewFrameComment("eng", "desc", "Comment"),
+			NewFrameAttachedPicture("image/jpeg", "", PictureTypeCoverFront, []byte{0xff, 0xd8, 0xff, 0x00}),
+			NewFrameTextCustom("key", "value"),
+			NewFramePopularimeter("a@b.c", 255, 12),
+		)
+		tag.Padding = 8
+
+		buf := bytes.NewBuffer([]byte{})
+		if _, err := tag.WriteTo(buf); err == nil {
+			seeds = append(seeds, buf.Bytes())
+		}
+	}
+	return seeds
+}
+
+// fuzzDecode decodes data as a tag of the requested version, in both
+// strict and lenient modes, checking only that decoding doesn't panic.
+func fuzzDecode(f *testing.F, v Version) {
+	for _, seed := range fuzzSeeds(v) {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if len(data) < 10 {
+			return
+		}
+		data = append([]byte{'I', 'D', '3', byte(v)}, data[4:]...)
+
+		for _, lenient := range []bool{false, true} {
+			opts := DecodeOptions{Lenient: lenient, Limits: DefaultDecodeLimits}
+			var tag Tag
+			tag.ReadFromWithOptions(bytes.NewReader(data), opts)
+		}
+	})
+}
+
+func FuzzReadFrom22(f *testing.F) {
+	fuzzDecode(f, Version2_2)
+}
+
+func FuzzReadFrom23(f *testing.F) {
+	fuzzDecode(f, Version2_3)
+}
+
+func FuzzReadFrom24(f *testing.F) {
+	fuzzDecode(f, Version2_4)
+}
+
+// FuzzRoundTrip checks that a decoded tag is encoded stably: once a tag has
+// been decoded and re-encoded, decoding and re-encoding it again must
+// produce the same bytes. Tags are decoded strictly, since lenient decoding
+// may keep frames as unknown frames that decode differently once
+// re-encoded.
+func FuzzRoundTrip(f *testing.F) {
+	for _, v := range []Version{Version2_3, Version2_4} {
+		for _, seed := range fuzzSeeds(v) {
+			f.Add(seed)
+		}
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		opts := DecodeOptions{Limits: DefaultDecodeLimits}
+
+		var tag1 Tag
+		if _, err := tag1.ReadFromWithOptions(bytes.NewReader(data), opts); err != nil {
+			return
+		}
+		buf1 := bytes.NewBuffer([]byte{})
+		if _, err := tag1.WriteTo(buf1); err != nil {
+			return
+		}
+
+		var tag2 Tag
+		if _, err := tag2.ReadFromWithOptions(bytes.NewReader(buf1.Bytes()), opts); err != nil {
+			t.Fatalf("re-encoded tag failed to decode: %v", err)
+		}
+		buf2 := bytes.NewBuffer([]byte{})
+		if _, err := tag2.WriteTo(buf2); err != nil {
+			t.Fatalf("decoded tag failed to re-encode: %v", err)
+		}
+
+		if !bytes.Equal(buf1.Bytes(), buf2.Bytes()) {
+			t.Errorf("re-encoded tag is unstable:\n  first  %x\n  second %x", buf1.Bytes(), buf2.Bytes())
+		}
+	})
+}
+
+// FuzzText checks that the string codecs don't panic on arbitrary input,
+// and that strings survive an encode/decode round trip through each
+// encoding able to represent them.
+func FuzzText(f *testing.F) {
+	f.Add([]byte("abc\x00def"), "abc")
+	f.Add([]byte{0xff, 0xfe, 'a', 0, 0, 0}, "caf\u00e9")
+	f.Add([]byte{0xfe, 0xff, 0xd8, 0x3d, 0xde, 0x00, 0, 0}, "\U0001f600")
+	f.Add([]byte{0xd8, 0x00, 'a'}, "a\x00b")
+	f.Fuzz(func(t *testing.T, data []byte, s string) {
+		for enc := EncodingISO88591; enc <= EncodingUTF8+1; enc++ {
+			for _, c := range []textCodec{{}, {lenient: true}} {
+				c.decodeString(data, enc)
+				c.decodeStrings(data, enc)
+				c.decodeNextString(data, enc)
+			}
+		}
+
+		if !utf8.ValidString(s) || bytes.IndexByte([]byte(s), 0) >= 0 {
+			return
+		}
+		for enc := EncodingISO88591; enc <= EncodingUTF8; enc++ {
+			if enc == EncodingISO88591 && !isLatin1(s) {
+				continue
+			}
+			b, err := encodeString(s, enc)
+			if err != nil {
+				t.Fatalf("encoding %d: %v", enc, err)
+			}
+			s2, err := decodeString(b, enc)
+			if err != nil || s2 != s {
+				t.Errorf("encoding %d:\n  got %q, error %v, expected %q", enc, s2, err, s)
+			}
+		}
+	})
+}
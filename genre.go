@@ -0,0 +1,317 @@
+package id3
+
+import (
+	"strconv"
+	"strings"
+)
+
+// A Genre describes a single genre entry stored within a TCON (content
+// type) text frame. An entry may refer to one of the ID3v1 genres by
+// number, to one of the special RX (remix) or CR (cover) keywords, or to
+// neither. It may also carry free-form text, which either refines the
+// referenced genre or, if there is no reference, names the genre directly.
+type Genre struct {
+	ID   int    // ID3v1 genre index, GenreRemix, GenreCover, or GenreNone
+	Name string // Refinement or free-text genre name
+}
+
+// Special values for a Genre's ID.
+const (
+	GenreNone  = -1 // No numeric genre reference
+	GenreRemix = -2 // The "RX" keyword
+	GenreCover = -3 // The "CR" keyword
+)
+
+// genres holds the ID3v1 genre table, including the Winamp extensions.
+var genres = [192]string{
+	"Blues", "Classic Rock", "Country", "Dance", "Disco", "Funk", "Grunge",
+	"Hip-Hop", "Jazz", "Metal", "New Age", "Oldies", "Other", "Pop", "R&B",
+	"Rap", "Reggae", "Rock", "Techno", "Industrial", "Alternative", "Ska",
+	"Death Metal", "Pranks", "Soundtrack", "Euro-Techno", "Ambient",
+	"Trip-Hop", "Vocal", "Jazz+Funk", "Fusion", "Trance", "Classical",
+	"Instrumental", "Acid", "House", "Game", "Sound Clip", "Gospel", "Noise",
+	"AlternRock", "Bass", "Soul", "Punk", "Space", "Meditative",
+	"Instrumental Pop", "Instrumental Rock", "Ethnic", "Gothic", "Darkwave",
+	"Techno-Industrial", "Electronic", "Pop-Folk", "Eurodance", "Dream",
+	"Southern Rock", "Comedy", "Cult", "Gangsta", "Top 40", "Christian Rap",
+	"Pop/Funk", "Jungle", "Native American", "Cabaret", "New Wave",
+	"Psychadelic", "Rave", "Showtunes", "Trailer", "Lo-Fi", "Tribal",
+	"Acid Punk", "Acid Jazz", "Polka", "Retro", "Musical", "Rock & Roll",
+	"Hard Rock", "Folk", "Folk-Rock", "National Folk", "Swing",
+	"Fast Fusion", "Bebob", "Latin", "Revival", "Celtic", "Bluegrass",
+	"Avantgarde", "Gothic Rock", "Progressive Rock", "Psychedelic Rock",
+	"Symphonic Rock", "Slow Rock", "Big Band", "Chorus", "Easy Listening",
+	"Acoustic", "Humour", "Speech", "Chanson", "Opera", "Chamber Music",
+	"Sonata", "Symphony", "Booty Bass", "Primus", "Porn Groove", "Satire",
+	"Slow Jam", "Club", "Tango", "Samba", "Folklore", "Ballad",
+	"Power Ballad", "Rhythmic Soul", "Freestyle", "Duet", "Punk Rock",
+	"Drum Solo", "A capella", "Euro-House", "Dance Hall", "Goa",
+	"Drum & Bass", "Club-House", "Hardcore Techno", "Terror", "Indie",
+	"BritPop", "Negerpunk", "Polsk Punk", "Beat", "Christian Gangsta Rap",
+	"Heavy Metal", "Black Metal", "Crossover", "Contemporary Christian",
+	"Christian Rock", "Merengue", "Salsa", "Thrash Metal", "Anime", "Jpop",
+	"Synthpop", "Abstract", "Art Rock", "Baroque", "Bhangra", "Big Beat",
+	"Breakbeat", "Chillout", "Downtempo", "Dub", "EBM", "Eclectic",
+	"Electro", "Electroclash", "Emo", "Experimental", "Garage", "Global",
+	"IDM", "Illbient", "Industro-Goth", "Jam Band", "Krautrock", "Leftfield",
+	"Lounge", "Math Rock", "New Romantic", "Nu-Breakz", "Post-Punk",
+	"Post-Rock", "Psytrance", "Shoegaze", "Space Rock", "Trop Rock",
+	"World Music", "Neoclassical", "Audiobook", "Audio Theatre",
+	"Neue Deutsche Welle", "Podcast", "Indie Rock", "G-Funk", "Dubstep",
+	"Garage Rock", "Psybient",
+}
+
+// genreIDs maps lower-cased genre names to their ID3v1 genre index.
+var genreIDs = func() map[string]int {
+	m := make(map[string]int, len(genres)+2)
+	for i, name := range genres {
+		m[strings.ToLower(name)] = i
+	}
+	return m
+}()
+
+// GenreName returns the canonical name of a genre ID. The ID may be an
+// ID3v1 genre index, GenreRemix or GenreCover. If the ID is unknown,
+// GenreName returns the empty string.
+func GenreName(id int) string {
+	switch {
+	case id == GenreRemix:
+		return "Remix"
+	case id == GenreCover:
+		return "Cover"
+	case id >= 0 && id < len(genres):
+		return genres[id]
+	default:
+		return ""
+	}
+}
+
+// LookupGenre returns the ID3v1 genre index whose name matches the
+// requested name, ignoring case. It also recognizes the names "Remix" and
+// "Cover". If no genre matches, LookupGenre returns GenreNone and false.
+func LookupGenre(name string) (id int, ok bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	switch name {
+	case "remix":
+		return GenreRemix, true
+	case "cover":
+		return GenreCover, true
+	}
+	if id, ok := genreIDs[name]; ok {
+		return id, true
+	}
+	return GenreNone, false
+}
+
+// String returns the genre's canonical name. Numeric references and the
+// RX and CR keywords resolve to their names. A refinement that differs from
+// the referenced genre's name is appended in parentheses.
+func (g Genre) String() string {
+	name := GenreName(g.ID)
+	switch {
+	case name == "":
+		return g.Name
+	case g.Name == "" || strings.EqualFold(g.Name, name):
+		return name
+	default:
+		return name + " (" + g.Name + ")"
+	}
+}
+
+// ParseGenres parses the text strings of a TCON frame into a list of genre
+// entries. It accepts the v2.2/v2.3 syntax, in which numeric references
+// and keywords appear in parentheses and may be followed by a refinement
+// (e.g., "(13)(31)Remix" or "((Mostly) Harmless"), as well as the v2.4
+// syntax, in which each string holds a number, a keyword, or free text.
+// Because many v2.4 tags in the wild use the older syntax, both syntaxes
+// are accepted for all versions.
+func ParseGenres(ss []string) []Genre {
+	var gg []Genre
+	for _, s := range ss {
+		s = strings.TrimSpace(s)
+		switch {
+		case s == "":
+			continue
+		case s == "RX":
+			gg = append(gg, Genre{ID: GenreRemix})
+		case s == "CR":
+			gg = append(gg, Genre{ID: GenreCover})
+		case isDigits(s):
+			id, err := strconv.Atoi(s)
+			if err != nil || id > 255 {
+				gg = append(gg, Genre{ID: GenreNone, Name: s})
+				continue
+			}
+			gg = append(gg, Genre{ID: id})
+		default:
+			gg = append(gg, parseGenreRefs(s)...)
+		}
+	}
+	return gg
+}
+
+// parseGenreRefs parses a string containing v2.3-style genre references
+// and refinements.
+func parseGenreRefs(s string) []Genre {
+	var gg []Genre
+	for len(s) > 0 {
+		if id, n := parseGenreRef(s); n > 0 {
+			gg = append(gg, Genre{ID: id})
+			s = s[n:]
+			continue
+		}
+
+		// Collect text until the next genre reference. A "((" sequence
+		// escapes a literal open parenthesis.
+		var text []byte
+		for len(s) > 0 {
+			if strings.HasPrefix(s, "((") {
+				text = append(text, '(')
+				s = s[2:]
+				continue
+			}
+			if _, n := parseGenreRef(s); n > 0 {
+				break
+			}
+			text = append(text, s[0])
+			s = s[1:]
+		}
+
+		name := strings.TrimSpace(string(text))
+		switch {
+		case name == "":
+		case len(gg) > 0 && gg[len(gg)-1].Name == "":
+			gg[len(gg)-1].Name = name
+		default:
+			gg = append(gg, Genre{ID: GenreNone, Name: name})
+		}
+	}
+	return gg
+}
+
+// parseGenreRef attempts to parse a parenthesized genre reference like
+// "(13)", "(RX)" or "(CR)" at the start of s. It returns the genre ID and
+// the number of bytes consumed, or zero bytes if s doesn't start with a
+// reference.
+func parseGenreRef(s string) (id int, n int) {
+	if len(s) < 3 || s[0] != '(' || s[1] == '(' {
+		return GenreNone, 0
+	}
+	end := strings.IndexByte(s, ')')
+	if end < 0 {
+		return GenreNone, 0
+	}
+
+	ref := s[1:end]
+	switch {
+	case ref == "RX":
+		return GenreRemix, end + 1
+	case ref == "CR":
+		return GenreCover, end + 1
+	case isDigits(ref):
+		id, err := strconv.Atoi(ref)
+		if err != nil || id > 255 {
+			return GenreNone, 0
+		}
+		return id, end + 1
+	default:
+		return GenreNone, 0
+	}
+}
+
+// FormatGenres formats a list of genre entries into the text strings of a
+// TCON frame for the requested ID3 version. For v2.2 and v2.3, a string
+// using parenthesized references is produced (e.g., "(13)(31)Remix").
+// Because free-text names can't be separated within such a string, each
+// free-text name following another name begins a new string. For v2.4,
+// each reference and each refinement is stored as a separate string (e.g.,
+// "13", "31", "Remix").
+func FormatGenres(v Version, gg []Genre) []string {
+	if v >= Version2_4 {
+		ss := make([]string, 0, len(gg))
+		for _, g := range gg {
+			switch {
+			case g.ID == GenreRemix:
+				ss = append(ss, "RX")
+			case g.ID == GenreCover:
+				ss = append(ss, "CR")
+			case g.ID >= 0:
+				ss = append(ss, strconv.Itoa(g.ID))
+			}
+			if g.Name != "" {
+				ss = append(ss, g.Name)
+			}
+		}
+		return ss
+	}
+
+	if len(gg) == 0 {
+		return nil
+	}
+
+	var ss []string
+	var b strings.Builder
+	hasName := false
+	for _, g := range gg {
+		if g.ID == GenreNone && hasName {
+			ss = append(ss, b.String())
+			b.Reset()
+		}
+		hasName = g.Name != ""
+
+		switch {
+		case g.ID == GenreRemix:
+			b.WriteString("(RX)")
+		case g.ID == GenreCover:
+			b.WriteString("(CR)")
+		case g.ID >= 0:
+			b.WriteString("(" + strconv.Itoa(g.ID) + ")")
+		}
+		if strings.HasPrefix(g.Name, "(") {
+			b.WriteByte('(')
+		}
+		b.WriteString(g.Name)
+	}
+	return append(ss, b.String())
+}
+
+// NormalizeGenres parses the text strings of a TCON frame and resolves
+// every entry to a canonical genre name. Numeric references and the RX and
+// CR keywords are replaced by their names, free-text names matching a
+// known genre take on the table's capitalization, refinements that merely
+// repeat the referenced genre are dropped, and duplicates are removed.
+func NormalizeGenres(ss []string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if id, ok := LookupGenre(name); ok {
+			name = GenreName(id)
+		}
+		key := strings.ToLower(name)
+		if name == "" || seen[key] {
+			return
+		}
+		seen[key] = true
+		names = append(names, name)
+	}
+
+	for _, g := range ParseGenres(ss) {
+		add(GenreName(g.ID))
+		add(g.Name)
+	}
+	return names
+}
+
+// isDigits returns true if s is non-empty and consists only of ASCII
+// digits.
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,5 @@
+module github.com/beevik/id3
+
+go 1.25.0
+
+require golang.org/x/text v0.40.0
@@ -2,8 +2,16 @@ package id3
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestHeader(t *testing.T) {
@@ -122,6 +130,69 @@ func TestSyncUint32(t *testing.T) {
 	}
 }
 
+func TestFrameSize(t *testing.T) {
+	var cases = []struct {
+		version Version
+		size    []byte
+	}{
+		{Version2_3, []byte{0x00, 0x00, 0x00, 0xc8}},
+		{Version2_4, []byte{0x00, 0x00, 0x01, 0x48}},
+	}
+
+	for i, c := range cases {
+		title := strings.Repeat("x", 199)
+		tag := NewTag(c.version, 0)
+		f := NewFrameText(FrameTypeTextSongTitle, title)
+		f.Encoding = EncodingISO88591
+		tag.Frames = append(tag.Frames, f)
+
+		buf := bytes.NewBuffer([]byte{})
+		if _, err := tag.WriteTo(buf); err != nil {
+			t.Errorf("case %d:\n  got error '%v'\n", i, err)
+			continue
+		}
+		if size := buf.Bytes()[14:18]; !bytes.Equal(size, c.size) {
+			t.Errorf("case %d:\n  got size %x, expected %x\n", i, size, c.size)
+		}
+
+		tag = &Tag{}
+		if _, err := tag.ReadFrom(buf); err != nil {
+			t.Errorf("case %d:\n  got error '%v'\n", i, err)
+			continue
+		}
+		if s, _ := tag.text(FrameTypeTextSongTitle); s != title {
+			t.Errorf("case %d:\n  got '%s', expected '%s'\n", i, s, title)
+		}
+	}
+}
+
+func TestDecodeFrameType(t *testing.T) {
+	for _, v := range []Version{Version2_3, Version2_4} {
+		tag := NewTag(v, 0)
+		tag.Frames = append(tag.Frames,
+			NewFrameText(FrameTypeTextSongTitle, "Title"),
+			NewFrameComment("eng", "", "Comment"),
+			NewFramePlayCount(1),
+		)
+
+		buf := bytes.NewBuffer([]byte{})
+		if _, err := tag.WriteTo(buf); err != nil {
+			t.Fatal(err)
+		}
+		tag = &Tag{}
+		if _, err := tag.ReadFrom(buf); err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []FrameType{FrameTypeTextSongTitle, FrameTypeComment, FrameTypePlayCount}
+		for i, f := range tag.Frames {
+			if typ := HeaderOf(f).FrameType; typ != expected[i] {
+				t.Errorf("v2.%d: case %d:\n  got frame type %d, expected %d\n", v, i, typ, expected[i])
+			}
+		}
+	}
+}
+
 func TestUnsync(t *testing.T) {
 	var cases = []struct {
 		synced   []byte
@@ -135,8 +206,9 @@ func TestUnsync(t *testing.T) {
 		{[]byte{0xff, 0xf0}, []byte{0xff, 0x00, 0xf0}},
 		{[]byte{0xff, 0xff}, []byte{0xff, 0x00, 0xff}},
 		{[]byte{0xff, 0x00}, []byte{0xff, 0x00, 0x00}},
-		{[]byte{0xff, 0xff, 0xff}, []byte{0xff, 0x00, 0xff, 0xff}},
-		{[]byte{0xff, 0xff, 0xff, 0xff}, []byte{0xff, 0x00, 0xff, 0xff, 0x00, 0xff}},
+		{[]byte{0xff, 0xff, 0xff}, []byte{0xff, 0x00, 0xff, 0x00, 0xff}},
+		{[]byte{0xff, 0xff, 0xff, 0xff}, []byte{0xff, 0x00, 0xff, 0x00, 0xff, 0x00, 0xff}},
+		{[]byte{0xff, 0xff, 0x00}, []byte{0xff, 0x00, 0xff, 0x00, 0x00}},
 		{[]byte{0x00, 0x01, 0x02, 0x03}, []byte{0x00, 0x01, 0x02, 0x03}},
 		{[]byte{0xff, 0xfe, 0xff, 0xfe, 0xff, 0xfe}, []byte{0xff, 0x00, 0xfe, 0xff, 0x00, 0xfe, 0xff, 0x00, 0xfe}},
 	}
@@ -561,3 +633,1962 @@ func TestUFID(t *testing.T) {
 	f := NewFrameUniqueFileID("owner", "b28f6045-9958-44b5-9da8-34703f5ffa13")
 	serialize(t, f)
 }
+
+func TestRemoveFrames(t *testing.T) {
+	tag := NewTag(Version2_4, 0)
+	tag.Frames = append(tag.Frames,
+		NewFrameText(FrameTypeTextSongTitle, "Title 1"),
+		NewFrameText(FrameTypeTextArtist, "Artist"),
+		NewFrameText(FrameTypeTextSongTitle, "Title 2"),
+		NewFrameText(FrameTypeTextSongTitle, "Title 3"),
+		NewFrameText(FrameTypeTextAlbumName, "Album"),
+	)
+
+	tag.RemoveFrames(FrameTypeTextSongTitle)
+
+	var texts []string
+	for _, f := range tag.Frames {
+		ft, ok := f.(*FrameText)
+		if !ok {
+			t.Fatalf("got frame of type %T, expected *FrameText", f)
+		}
+		texts = append(texts, ft.Text[0])
+	}
+	if expected := []string{"Artist", "Album"}; !reflect.DeepEqual(texts, expected) {
+		t.Errorf("got frames %q, expected %q", texts, expected)
+	}
+}
+
+func TestGenres(t *testing.T) {
+	var cases = []struct {
+		input      []string
+		genres     []Genre
+		normalized []string
+	}{
+		{[]string{"(13)"}, []Genre{{13, ""}}, []string{"Pop"}},
+		{[]string{"(13)(31)Remix"}, []Genre{{13, ""}, {31, "Remix"}}, []string{"Pop", "Trance", "Remix"}},
+		{[]string{"(4)Eurodisco"}, []Genre{{4, "Eurodisco"}}, []string{"Disco", "Eurodisco"}},
+		{[]string{"(17)Rock"}, []Genre{{17, "Rock"}}, []string{"Rock"}},
+		{[]string{"((Mostly) Harmless"}, []Genre{{GenreNone, "(Mostly) Harmless"}}, []string{"(Mostly) Harmless"}},
+		{[]string{"(RX)(CR)"}, []Genre{{GenreRemix, ""}, {GenreCover, ""}}, []string{"Remix", "Cover"}},
+		{[]string{"Rock (Live)"}, []Genre{{GenreNone, "Rock (Live)"}}, []string{"Rock (Live)"}},
+		{[]string{"13", "31", "RX", "hip-hop"}, []Genre{{13, ""}, {31, ""}, {GenreRemix, ""}, {GenreNone, "hip-hop"}}, []string{"Pop", "Trance", "Remix", "Hip-Hop"}},
+		{[]string{"191", "Psybient"}, []Genre{{191, ""}, {GenreNone, "Psybient"}}, []string{"Psybient"}},
+	}
+
+	for i, c := range cases {
+		gg := ParseGenres(c.input)
+		if !reflect.DeepEqual(gg, c.genres) {
+			t.Errorf("case %d:\n  got %v, expected %v\n", i, gg, c.genres)
+		}
+		n := NormalizeGenres(c.input)
+		if !reflect.DeepEqual(n, c.normalized) {
+			t.Errorf("case %d:\n  normalized to %q, expected %q\n", i, n, c.normalized)
+		}
+		for _, v := range []Version{Version2_3, Version2_4} {
+			if rt := NormalizeGenres(FormatGenres(v, gg)); !reflect.DeepEqual(rt, c.normalized) {
+				t.Errorf("case %d:\n  v2.%d round trip got %q, expected %q\n", i, v, rt, c.normalized)
+			}
+		}
+	}
+
+	// Free-text names can't be separated within a v2.3 genre string, so
+	// each one following another name starts a new string.
+	var formatCases = []struct {
+		genres []Genre
+		output []string
+	}{
+		{nil, nil},
+		{[]Genre{{13, ""}, {31, "Remix"}}, []string{"(13)(31)Remix"}},
+		{[]Genre{{GenreNone, "Rock"}, {GenreNone, "Pop"}}, []string{"Rock", "Pop"}},
+		{[]Genre{{17, "Rock"}, {GenreNone, "Indie"}, {GenreRemix, ""}}, []string{"(17)Rock", "Indie(RX)"}},
+	}
+	for i, c := range formatCases {
+		if ss := FormatGenres(Version2_3, c.genres); !reflect.DeepEqual(ss, c.output) {
+			t.Errorf("format case %d:\n  got %q, expected %q\n", i, ss, c.output)
+		}
+	}
+
+	if len(genres) != 192 || GenreName(191) != "Psybient" || GenreName(192) != "" {
+		t.Error("Genre table incorrect")
+	}
+}
+
+func TestTrackNumber(t *testing.T) {
+	var cases = []struct {
+		input string
+		n     int
+		total int
+		ok    bool
+	}{
+		{"3", 3, 0, true},
+		{"3/12", 3, 12, true},
+		{"03/12", 3, 12, true},
+		{" 3 / 12 ", 3, 12, true},
+		{"007", 7, 0, true},
+		{"3/12 (bonus)", 3, 12, true},
+		{"3a", 3, 0, true},
+		{"3/", 3, 0, true},
+		{"/12", 0, 0, false},
+		{"A1", 0, 0, false},
+		{"", 0, 0, false},
+	}
+
+	for i, c := range cases {
+		tag := NewTag(Version2_4, 0)
+		tag.Frames = append(tag.Frames, NewFrameText(FrameTypeTextTrackNumber, c.input))
+		n, total, ok := tag.TrackNumber()
+		if n != c.n || total != c.total || ok != c.ok {
+			t.Errorf("case %d:\n  got (%d, %d, %v), expected (%d, %d, %v)\n",
+				i, n, total, ok, c.n, c.total, c.ok)
+		}
+	}
+
+	var formats = []struct {
+		n, total int
+		padding  NumberPadding
+		output   string
+	}{
+		{3, 12, NumberPaddingNone, "3/12"},
+		{3, 0, NumberPaddingNone, "3"},
+		{3, 12, NumberPaddingToTotal, "03/12"},
+		{3, 100, NumberPaddingToTotal, "003/100"},
+		{3, 0, NumberPaddingToTotal, "3"},
+		{3, 0, NumberPaddingTwoDigits, "03"},
+		{3, 9, NumberPaddingTwoDigits, "03/09"},
+	}
+
+	for i, c := range formats {
+		tag := NewTag(Version2_3, 0)
+		if err := tag.SetDiscNumberPadded(c.n, c.total, c.padding); err != nil {
+			t.Errorf("case %d:\n  got error '%v'\n", i, err)
+		}
+
+		buf := bytes.NewBuffer([]byte{})
+		if _, err := tag.WriteTo(buf); err != nil {
+			t.Error(err)
+		}
+		tag = &Tag{}
+		if _, err := tag.ReadFrom(buf); err != nil {
+			t.Error(err)
+		}
+
+		if s, _ := tag.text(FrameTypeTextPartOfSet); s != c.output {
+			t.Errorf("case %d:\n  got '%s', expected '%s'\n", i, s, c.output)
+		}
+		if n, total, _ := tag.DiscNumber(); n != c.n || total != c.total {
+			t.Errorf("case %d:\n  got (%d, %d), expected (%d, %d)\n", i, n, total, c.n, c.total)
+		}
+	}
+
+	tag := NewTag(Version2_4, 0)
+	tag.SetTrackNumber(1, 2)
+	tag.SetTrackNumber(0, 0)
+	if len(tag.Frames) != 0 {
+		t.Error("SetTrackNumber(0, 0) failed to remove frame")
+	}
+	if err := tag.SetTrackNumber(-1, 0); err != ErrInvalidNumber {
+		t.Errorf("got error '%v', expected '%v'", err, ErrInvalidNumber)
+	}
+}
+
+func TestTimestamp(t *testing.T) {
+	var cases = []struct {
+		input string
+		ts    Timestamp
+		err   error
+	}{
+		{"2004", Timestamp{Year: 2004, Precision: PrecisionYear}, nil},
+		{"2004-02", Timestamp{Year: 2004, Month: 2, Precision: PrecisionMonth}, nil},
+		{"2004-02-29", Timestamp{Year: 2004, Month: 2, Day: 29, Precision: PrecisionDay}, nil},
+		{"2004-02-29T13", Timestamp{2004, 2, 29, 13, 0, 0, PrecisionHour}, nil},
+		{"2004-02-29T13:05", Timestamp{2004, 2, 29, 13, 5, 0, PrecisionMinute}, nil},
+		{"2004-02-29T13:05:59", Timestamp{2004, 2, 29, 13, 5, 59, PrecisionSecond}, nil},
+		{" 2004 ", Timestamp{Year: 2004, Precision: PrecisionYear}, nil},
+		{"2003-02-29", Timestamp{}, ErrInvalidTimestamp},
+		{"2004-13", Timestamp{}, ErrInvalidTimestamp},
+		{"2004-1-1", Timestamp{}, ErrInvalidTimestamp},
+		{"2004-02-29 13:05", Timestamp{}, ErrInvalidTimestamp},
+		{"2004-02-29T24", Timestamp{}, ErrInvalidTimestamp},
+		{"04", Timestamp{}, ErrInvalidTimestamp},
+		{"", Timestamp{}, ErrInvalidTimestamp},
+	}
+
+	for i, c := range cases {
+		ts, err := ParseTimestamp(c.input)
+		if err != c.err {
+			t.Errorf("case %d:\n  got error '%v', expected '%v'\n", i, err, c.err)
+			continue
+		}
+		if ts != c.ts {
+			t.Errorf("case %d:\n  got %+v, expected %+v\n", i, ts, c.ts)
+		}
+		if err == nil && ts.String() != strings.TrimSpace(c.input) {
+			t.Errorf("case %d:\n  formatted as '%s'\n", i, ts.String())
+		}
+	}
+
+	tm := time.Date(2011, 7, 4, 18, 30, 15, 0, time.UTC)
+	if ts := NewTimestamp(tm, PrecisionDay); ts.String() != "2011-07-04" || !ts.Time().Equal(time.Date(2011, 7, 4, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("NewTimestamp failed: %v", ts)
+	}
+
+	var versions = []struct {
+		version  Version
+		expected string
+	}{
+		{Version2_3, "2011-07-04T18:30"},
+		{Version2_4, "2011-07-04T18:30:15"},
+	}
+
+	for _, v := range versions {
+		tag := NewTag(v.version, 0)
+		if err := tag.SetRecordingTime(NewTimestamp(tm, PrecisionSecond)); err != nil {
+			t.Error(err)
+		}
+		if err := tag.SetOriginalReleaseTime(NewTimestamp(tm, PrecisionMonth)); err != nil {
+			t.Error(err)
+		}
+
+		buf := bytes.NewBuffer([]byte{})
+		if _, err := tag.WriteTo(buf); err != nil {
+			t.Error(err)
+		}
+		tag = &Tag{}
+		if _, err := tag.ReadFrom(buf); err != nil {
+			t.Error(err)
+		}
+
+		if ts, ok := tag.RecordingTime(); !ok || ts.String() != v.expected {
+			t.Errorf("v2.%d recording time: got '%v', expected '%s'", v.version, ts, v.expected)
+		}
+		if ts, ok := tag.OriginalReleaseTime(); !ok || ts.Year != 2011 {
+			t.Errorf("v2.%d original release time: got '%v'", v.version, ts)
+		}
+	}
+
+	tag := NewTag(Version2_3, 0)
+	if err := tag.SetTaggingTime(NewTimestamp(tm, PrecisionSecond)); err != ErrUnsupportedFrame {
+		t.Errorf("got error '%v', expected '%v'", err, ErrUnsupportedFrame)
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	yes, no := true, false
+	m := &Metadata{
+		Title:       "Yellow Submarine",
+		Artists:     []string{"The Beatles"},
+		Album:       "Revolver",
+		AlbumArtist: "The Beatles",
+		Year:        1966,
+		Track:       6,
+		TrackTotal:  14,
+		Disc:        1,
+		DiscTotal:   1,
+		Genres:      []string{"Rock", "Pop"},
+		Comment:     "comment",
+		Lyrics:      "In the town where I was born",
+		Compilation: &yes,
+		BPM:         112,
+		Composer:    "Lennon-McCartney",
+		Pictures: []Picture{
+			{"image/jpeg", PictureTypeCoverFront, "front", make([]byte, 1024)},
+		},
+	}
+
+	for _, v := range []Version{Version2_3, Version2_4} {
+		tag := NewTag(v, 0)
+		if err := tag.ApplyMetadata(m, MetadataOptions{NumberPadding: NumberPaddingToTotal}); err != nil {
+			t.Error(err)
+		}
+
+		buf := bytes.NewBuffer([]byte{})
+		if _, err := tag.WriteTo(buf); err != nil {
+			t.Error(err)
+		}
+		tag = &Tag{}
+		if _, err := tag.ReadFrom(buf); err != nil {
+			t.Error(err)
+		}
+
+		if m2 := tag.Metadata(); !reflect.DeepEqual(m, m2) {
+			t.Errorf("v2.%d metadata mismatch:\n  got %+v\n  expected %+v\n", v, m2, m)
+		}
+		if s, _ := tag.text(FrameTypeTextTrackNumber); s != "06/14" {
+			t.Errorf("v2.%d track number stored as '%s'", v, s)
+		}
+
+		// Apply a partial update that leaves other fields untouched.
+		if err := tag.ApplyMetadata(&Metadata{Title: "Eleanor Rigby"}, MetadataOptions{}); err != nil {
+			t.Error(err)
+		}
+		if m2 := tag.Metadata(); m2.Title != "Eleanor Rigby" || m2.Album != m.Album || len(m2.Pictures) != 1 {
+			t.Errorf("v2.%d partial update failed: %+v", v, m2)
+		}
+
+		// Clear the compilation flag.
+		if err := tag.ApplyMetadata(&Metadata{Compilation: &no}, MetadataOptions{}); err != nil {
+			t.Error(err)
+		}
+		if m2 := tag.Metadata(); m2.Compilation == nil || *m2.Compilation {
+			t.Errorf("v2.%d compilation flag not cleared: %+v", v, m2)
+		}
+
+		// Apply an update that removes empty fields.
+		if err := tag.ApplyMetadata(&Metadata{Title: "Taxman"}, MetadataOptions{RemoveEmpty: true}); err != nil {
+			t.Error(err)
+		}
+		if m2 := tag.Metadata(); !reflect.DeepEqual(m2, &Metadata{Title: "Taxman"}) || len(tag.Frames) != 1 {
+			t.Errorf("v2.%d remove-empty update failed: %+v", v, m2)
+		}
+	}
+}
+
+func TestMultiValue(t *testing.T) {
+	var cases = []struct {
+		version    Version
+		values     []string
+		separator  string
+		separators []string
+		encoded    string
+		decoded    []string
+	}{
+		{Version2_4, []string{"A", "B"}, "", nil, "A\x00B", []string{"A", "B"}},
+		{Version2_3, []string{"A", "B"}, "", nil, "A/B", []string{"A/B"}},
+		{Version2_3, []string{"A", "B"}, "", []string{"/"}, "A/B", []string{"A", "B"}},
+		{Version2_3, []string{"A", "B", "C"}, "; ", []string{"/", ";"}, "A; B; C", []string{"A", "B", "C"}},
+		{Version2_3, []string{"AC/DC"}, "", nil, "AC/DC", []string{"AC/DC"}},
+	}
+
+	for i, c := range cases {
+		tag := NewTag(c.version, 0)
+		f := NewFrameText(FrameTypeTextArtist, "")
+		f.Encoding = EncodingISO88591
+		f.Text = c.values
+		tag.Frames = append(tag.Frames, f)
+
+		buf := bytes.NewBuffer([]byte{})
+		if _, err := tag.WriteToWithOptions(buf, EncodeOptions{MultiValueSeparator: c.separator}); err != nil {
+			t.Error(err)
+		}
+		if payload := string(buf.Bytes()[21:]); payload != c.encoded {
+			t.Errorf("case %d:\n  encoded as %q, expected %q\n", i, payload, c.encoded)
+		}
+
+		tag = &Tag{}
+		if _, err := tag.ReadFromWithOptions(buf, DecodeOptions{MultiValueSeparators: c.separators}); err != nil {
+			t.Error(err)
+		}
+		if ss := tag.FindFrame(FrameTypeTextArtist).(*FrameText).Text; !reflect.DeepEqual(ss, c.decoded) {
+			t.Errorf("case %d:\n  decoded as %q, expected %q\n", i, ss, c.decoded)
+		}
+	}
+
+	// Null-separated values found in v2.3 tags are preserved.
+	inbuf := []byte{
+		0x49, 0x44, 0x33, 0x03, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x0f, 0x54, 0x50, 0x45, 0x31, 0x00, 0x00,
+		0x00, 0x05, 0x00, 0x00, 0x00, 0x41, 0x00, 0x42,
+		0x00,
+	}
+	tag := &Tag{}
+	if _, err := tag.ReadFrom(bytes.NewBuffer(inbuf)); err != nil {
+		t.Error(err)
+	}
+	if ss := tag.FindFrame(FrameTypeTextArtist).(*FrameText).Text; !reflect.DeepEqual(ss, []string{"A", "B"}) {
+		t.Errorf("decoded as %q", ss)
+	}
+
+	// Embedded nulls are never written into v2.3 tags.
+	tag = NewTag(Version2_3, 0)
+	tag.Frames = append(tag.Frames, NewFrameText(FrameTypeTextArtist, "A\x00B"))
+	if _, err := tag.WriteTo(bytes.NewBuffer([]byte{})); !errors.Is(err, ErrInvalidText) {
+		t.Errorf("got error '%v', expected '%v'", err, ErrInvalidText)
+	}
+}
+
+func TestEncodingPolicy(t *testing.T) {
+	var cases = []struct {
+		version  Version
+		policy   EncodingPolicy
+		unicode  Encoding
+		encoding Encoding
+		text     string
+		expected Encoding
+		err      error
+	}{
+		{Version2_3, EncodingPolicyLegalize, 0, EncodingUTF8, "Björk", EncodingISO88591, nil},
+		{Version2_3, EncodingPolicyLegalize, 0, EncodingUTF8, "Сплин", EncodingUTF16BOM, nil},
+		{Version2_3, EncodingPolicyLegalize, 0, EncodingUTF16BOM, "Björk", EncodingUTF16BOM, nil},
+		{Version2_3, EncodingPolicyLegalize, 0, EncodingISO88591, "Сплин", EncodingUTF16BOM, nil},
+		{Version2_3, EncodingPolicyAuto, EncodingUTF8, EncodingUTF16BOM, "Сплин", EncodingUTF16BOM, nil},
+		{Version2_3, EncodingPolicyPreserve, 0, EncodingUTF8, "Björk", 0, ErrInvalidEncoding},
+		{Version2_3, EncodingPolicyPreserve, 0, EncodingISO88591, "Сплин", 0, ErrLossyEncoding},
+		{Version2_4, EncodingPolicyLegalize, 0, EncodingUTF8, "Björk", EncodingUTF8, nil},
+		{Version2_4, EncodingPolicyLegalize, 0, EncodingISO88591, "Сплин", EncodingUTF8, nil},
+		{Version2_4, EncodingPolicyAuto, 0, EncodingUTF8, "Björk", EncodingISO88591, nil},
+		{Version2_4, EncodingPolicyAuto, 0, EncodingISO88591, "Сплин", EncodingUTF8, nil},
+		{Version2_4, EncodingPolicyAuto, EncodingUTF16BOM, EncodingUTF8, "Сплин", EncodingUTF16BOM, nil},
+	}
+
+	for i, c := range cases {
+		tag := NewTag(c.version, 0)
+		f := NewFrameText(FrameTypeTextArtist, c.text)
+		f.Encoding = c.encoding
+		tag.Frames = append(tag.Frames, f)
+
+		buf := bytes.NewBuffer([]byte{})
+		opts := EncodeOptions{TextEncoding: c.policy, UnicodeEncoding: c.unicode}
+		_, err := tag.WriteToWithOptions(buf, opts)
+		if !errors.Is(err, c.err) {
+			t.Errorf("case %d:\n  got error '%v', expected '%v'\n", i, err, c.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		if enc := Encoding(buf.Bytes()[20]); enc != c.expected {
+			t.Errorf("case %d:\n  got encoding %d, expected %d\n", i, enc, c.expected)
+		}
+
+		tag = &Tag{}
+		if _, err := tag.ReadFrom(buf); err != nil {
+			t.Errorf("case %d:\n  got error '%v'\n", i, err)
+			continue
+		}
+		if s, _ := tag.text(FrameTypeTextArtist); s != c.text {
+			t.Errorf("case %d:\n  got '%s', expected '%s'\n", i, s, c.text)
+		}
+	}
+
+	// WesternString fields never lose data silently.
+	tag := NewTag(Version2_4, 0)
+	tag.Frames = append(tag.Frames, NewFrameURL(FrameTypeURLArtist, "http://例え.jp/"))
+	if _, err := tag.WriteTo(bytes.NewBuffer([]byte{})); !errors.Is(err, ErrLossyEncoding) {
+		t.Errorf("got error '%v', expected '%v'", err, ErrLossyEncoding)
+	}
+
+	// UTF-8 frames in v2.3 tags decode, and are legalized when encoded.
+	inbuf := []byte{
+		0x49, 0x44, 0x33, 0x03, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x10, 0x54, 0x49, 0x54, 0x32, 0x00, 0x00,
+		0x00, 0x06, 0x00, 0x00, 0x03, 0x54, 0x69, 0x74,
+		0x6c, 0x65,
+	}
+	tag = &Tag{}
+	if _, err := tag.ReadFrom(bytes.NewBuffer(inbuf)); err != nil {
+		t.Fatal(err)
+	}
+	f, ok := tag.Frames[0].(*FrameText)
+	if !ok || f.Encoding != EncodingUTF8 || f.Text[0] != "Title" {
+		t.Errorf("got frame %+v, expected UTF-8 text frame 'Title'", tag.Frames[0])
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	if _, err := tag.WriteTo(buf); err != nil {
+		t.Error(err)
+	}
+	if enc := Encoding(buf.Bytes()[20]); enc != EncodingISO88591 {
+		t.Errorf("got encoding %d, expected %d", enc, EncodingISO88591)
+	}
+}
+
+func TestUTF16(t *testing.T) {
+	var cases = []struct {
+		input   []byte
+		lenient bool
+		output  []string
+		err     error
+	}{
+		{[]byte{0xff, 0xfe, 0xa9, 0x00, 0x34, 0xd8, 0x06, 0xdf, 0x03, 0x26}, false, []string{"©𝌆☃"}, nil},
+		{[]byte{0xfe, 0xff, 0x00, 0x41, 0x00, 0x00, 0xff, 0xfe, 0x42, 0x00}, false, []string{"A", "B"}, nil},
+		{[]byte{0xff, 0xfe, 0x41, 0x00, 0x00, 0x00, 0x00, 0x42}, false, []string{"A", "B"}, nil},
+		{[]byte{0xff, 0xfe, 0x41, 0x00, 0x00, 0x00, 0x00}, false, nil, ErrInvalidText},
+		{[]byte{0xfe, 0xff, 0xd8, 0x34, 0x00, 0x41}, false, nil, ErrInvalidText},
+		{[]byte{0xfe, 0xff, 0xdf, 0x06}, false, nil, ErrInvalidText},
+		{[]byte{0xfe, 0xff, 0xd8, 0x34, 0x00, 0x41}, true, []string{"\ufffdA"}, nil},
+	}
+
+	for i, c := range cases {
+		ss, err := textCodec{lenient: c.lenient}.decodeStrings(c.input, EncodingUTF16BOM)
+		if err != c.err {
+			t.Errorf("case %d:\n  got error '%v', expected '%v'\n", i, err, c.err)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(ss, c.output) {
+			t.Errorf("case %d:\n  got %q, expected %q\n", i, ss, c.output)
+		}
+	}
+
+	// A tag written by a tool using little-endian UTF-16 round-trips
+	// byte-for-byte, even when mixed with big-endian frames.
+	le := []byte{
+		0x54, 0x49, 0x54, 0x32, 0x00, 0x00, 0x00, 0x0b,
+		0x00, 0x00, 0x01, 0xff, 0xfe, 0x1f, 0x04, 0x35,
+		0x04, 0x41, 0x04, 0x3d, 0x04,
+	}
+	be := []byte{
+		0x54, 0x50, 0x45, 0x31, 0x00, 0x00, 0x00, 0x0b,
+		0x00, 0x00, 0x01, 0xfe, 0xff, 0x04, 0x1f, 0x04,
+		0x35, 0x04, 0x41, 0x04, 0x3d,
+	}
+	hdr := []byte{0x49, 0x44, 0x33, 0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x2a}
+	inbuf := append(append(append([]byte{}, hdr...), le...), be...)
+
+	tag := &Tag{}
+	if _, err := tag.ReadFrom(bytes.NewBuffer(inbuf)); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := tag.text(FrameTypeTextSongTitle); s != "Песн" {
+		t.Errorf("got '%s', expected '%s'", s, "Песн")
+	}
+	if s, _ := tag.text(FrameTypeTextArtist); s != "Песн" {
+		t.Errorf("got '%s', expected '%s'", s, "Песн")
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	if _, err := tag.WriteTo(buf); err != nil {
+		t.Error(err)
+	}
+	if bytes.Compare(buf.Bytes(), inbuf) != 0 {
+		t.Errorf("Tag write error: Different bytes encoded")
+		hexdump(inbuf, os.Stdout)
+		hexdump(buf.Bytes(), os.Stdout)
+	}
+
+	// The encoding options override the byte order of decoded frames.
+	var orderCases = []struct {
+		order  ByteOrder
+		frames [][]byte
+	}{
+		{ByteOrderBigEndian, [][]byte{append(le[:11:11], be[11:]...), be}},
+		{ByteOrderLittleEndian, [][]byte{le, append(be[:11:11], le[11:]...)}},
+	}
+	for i, c := range orderCases {
+		expected := append(append(append([]byte{}, hdr...), c.frames[0]...), c.frames[1]...)
+		buf := bytes.NewBuffer([]byte{})
+		if _, err := tag.WriteToWithOptions(buf, EncodeOptions{UTF16ByteOrder: c.order}); err != nil {
+			t.Error(err)
+		}
+		if bytes.Compare(buf.Bytes(), expected) != 0 {
+			t.Errorf("case %d:\n  got %x, expected %x\n", i, buf.Bytes(), expected)
+		}
+	}
+}
+
+func TestCodepage(t *testing.T) {
+	var cases = []struct {
+		codepage Codepage
+		text     []string
+	}{
+		{CodepageISO88591, []string{"Björk", "Café del Mar", "Sigur Rós"}},
+		{CodepageISO88591, []string{"Radiohead", "OK Computer"}},
+		{CodepageWindows1251, []string{"Сплин", "Гранатовый альбом"}},
+		{CodepageWindows1251, []string{"Кино", "Группа крови"}},
+		{CodepageShiftJIS, []string{"宇多田ヒカル", "ファースト・ラヴ"}},
+		{CodepageGBK, []string{"王菲", "我的爱人"}},
+		{CodepageBig5, []string{"周杰倫", "我的愛人在遠方"}},
+	}
+
+	for i, c := range cases {
+		// Store each string as a tool using the legacy codepage would,
+		// i.e., as raw codepage bytes in a frame marked ISO-8859-1.
+		tag := NewTag(Version2_3, 0)
+		for j, s := range c.text {
+			b, err := c.codepage.encoding().NewEncoder().String(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			typ := []FrameType{FrameTypeTextArtist, FrameTypeTextAlbumName, FrameTypeTextSongTitle}[j]
+			f := NewFrameText(typ, string(latin1Runes([]byte(b))))
+			f.Encoding = EncodingISO88591
+			tag.Frames = append(tag.Frames, f)
+		}
+
+		if cp := DetectCodepage(tag); cp != c.codepage {
+			t.Errorf("case %d:\n  got %v, expected %v\n", i, cp, c.codepage)
+			continue
+		}
+
+		repairs, err := RepairEncodingDryRun(tag, c.codepage)
+		if err != nil {
+			t.Errorf("case %d:\n  got error '%v'\n", i, err)
+			continue
+		}
+		if s, _ := tag.text(FrameTypeTextArtist); c.codepage != CodepageISO88591 && s == c.text[0] {
+			t.Errorf("case %d:\n  dry run modified tag\n", i)
+		}
+
+		if _, err := RepairEncoding(tag, c.codepage); err != nil {
+			t.Errorf("case %d:\n  got error '%v'\n", i, err)
+			continue
+		}
+		for j, f := range tag.Frames {
+			ft := f.(*FrameText)
+			if ft.Text[0] != c.text[j] {
+				t.Errorf("case %d:\n  got '%s', expected '%s'\n", i, ft.Text[0], c.text[j])
+			}
+		}
+		if c.codepage == CodepageISO88591 {
+			if len(repairs) != 0 {
+				t.Errorf("case %d:\n  got %d repairs, expected none\n", i, len(repairs))
+			}
+			continue
+		}
+		if len(repairs) != len(c.text) {
+			t.Errorf("case %d:\n  got %d repairs, expected %d\n", i, len(repairs), len(c.text))
+		}
+
+		// The repaired tag round-trips using a Unicode encoding.
+		buf := bytes.NewBuffer([]byte{})
+		if _, err := tag.WriteTo(buf); err != nil {
+			t.Errorf("case %d:\n  got error '%v'\n", i, err)
+			continue
+		}
+		tag = &Tag{}
+		if _, err := tag.ReadFrom(buf); err != nil {
+			t.Errorf("case %d:\n  got error '%v'\n", i, err)
+			continue
+		}
+		if s, _ := tag.text(FrameTypeTextArtist); s != c.text[0] {
+			t.Errorf("case %d:\n  got '%s', expected '%s'\n", i, s, c.text[0])
+		}
+	}
+
+	// Text that isn't valid in the codepage leaves the tag untouched.
+	tag := NewTag(Version2_4, 0)
+	f := NewFrameText(FrameTypeTextArtist, "\u0098")
+	f.Encoding = EncodingISO88591
+	tag.Frames = append(tag.Frames, f)
+	if _, err := RepairEncoding(tag, CodepageWindows1251); err != ErrInvalidText {
+		t.Errorf("got error '%v', expected '%v'", err, ErrInvalidText)
+	}
+	if f.Encoding != EncodingISO88591 {
+		t.Errorf("got encoding %d, expected %d", f.Encoding, EncodingISO88591)
+	}
+
+	// Read-only frames are repaired only when forced.
+	cyrillic := string(latin1Runes([]byte{0xca, 0xe8, 0xed, 0xee}))
+	tag = NewTag(Version2_4, 0)
+	f = NewFrameText(FrameTypeTextArtist, cyrillic)
+	f.Encoding = EncodingISO88591
+	f.Header.SetFlag(FrameFlagReadOnly, true)
+	tag.Frames = append(tag.Frames, f)
+	var roErr *ReadOnlyError
+	if _, err := RepairEncoding(tag, CodepageWindows1251); !errors.As(err, &roErr) {
+		t.Errorf("got error '%v', expected a ReadOnlyError", err)
+	}
+	if f.Text[0] != cyrillic || f.Encoding != EncodingISO88591 {
+		t.Errorf("read-only frame was repaired to %q", f.Text[0])
+	}
+	if _, err := RepairEncoding(tag, CodepageWindows1251, EditForce); err != nil {
+		t.Errorf("got error '%v'", err)
+	}
+	if f.Text[0] != "Кино" || f.Encoding != EncodingUTF8 {
+		t.Errorf("got %q encoded as %v, expected %q", f.Text[0], f.Encoding, "Кино")
+	}
+}
+
+func TestLatin1(t *testing.T) {
+	var cases = []struct {
+		mode     Latin1Mode
+		url      string
+		expected string
+		err      error
+	}{
+		{Latin1Strict, "http://café.fr/", "http://café.fr/", nil},
+		{Latin1Strict, "http://łódź.pl/", "", &LossyEncodingError{"WOAR", "URL", 'ł'}},
+		{Latin1Replace, "http://łódź.pl/", "http://.ód..pl/", nil},
+		{Latin1Transliterate, "http://łódź.pl/", "http://lódz.pl/", nil},
+		{Latin1Transliterate, "\u201cŁódź\u201d \u2013 Œuvre\u2026", "\"Lódz\" - OEuvre...", nil},
+		{Latin1Transliterate, "http://例え.jp/", "http://...jp/", nil},
+	}
+
+	for i, c := range cases {
+		tag := NewTag(Version2_4, 0)
+		tag.Frames = append(tag.Frames, NewFrameURL(FrameTypeURLArtist, c.url))
+
+		buf := bytes.NewBuffer([]byte{})
+		_, err := tag.WriteToWithOptions(buf, EncodeOptions{Latin1: c.mode})
+		var lerr *LossyEncodingError
+		errors.As(err, &lerr)
+		if (err == nil) != (c.err == nil) || (c.err != nil && !reflect.DeepEqual(lerr, c.err)) {
+			t.Errorf("case %d:\n  got error '%v', expected '%v'\n", i, err, c.err)
+			continue
+		}
+		if err != nil {
+			if !errors.Is(err, ErrLossyEncoding) {
+				t.Errorf("case %d:\n  error '%v' doesn't wrap '%v'\n", i, err, ErrLossyEncoding)
+			}
+			continue
+		}
+
+		tag = &Tag{}
+		if _, err := tag.ReadFrom(buf); err != nil {
+			t.Errorf("case %d:\n  got error '%v'\n", i, err)
+			continue
+		}
+		if f, ok := tag.FindFrame(FrameTypeURLArtist).(*FrameURL); !ok || string(f.URL) != c.expected {
+			t.Errorf("case %d:\n  got '%v', expected '%s'\n", i, tag.FindFrame(FrameTypeURLArtist), c.expected)
+		}
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	var cases = []struct {
+		input  []string
+		flags  SanitizeFlags
+		output []string
+	}{
+		{[]string{"Cafe\u0301"}, SanitizeNFC, []string{"Café"}},
+		{[]string{"Cafe\u0301"}, SanitizeControls, []string{"Cafe\u0301"}},
+		{[]string{"A\ufeffB\x01C\x7f"}, SanitizeControls, []string{"ABC"}},
+		{[]string{"Line 1\r\nLine 2\t"}, SanitizeControls, []string{"Line 1\r\nLine 2\t"}},
+		{[]string{"Title \x00\x00", " Lead"}, SanitizeTrim, []string{"Title", " Lead"}},
+		{[]string{"A", "B", "A"}, SanitizeTrim, []string{"A", "B", "A"}},
+		{[]string{"A", "B", "A"}, SanitizeDuplicates, []string{"A", "B"}},
+		{[]string{"Café", "Cafe\u0301 ", "\ufeffCafé"}, SanitizeAll, []string{"Café"}},
+	}
+
+	for i, c := range cases {
+		if ss := sanitizeStrings(c.input, c.flags); !reflect.DeepEqual(ss, c.output) {
+			t.Errorf("case %d:\n  got %q, expected %q\n", i, ss, c.output)
+		}
+	}
+
+	newTag := func() *Tag {
+		artist := NewFrameText(FrameTypeTextArtist, "")
+		artist.Text = []string{"Bjo\u0308rk", "Björk ", "Sjón"}
+
+		tag := NewTag(Version2_4, 0)
+		tag.Frames = append(tag.Frames,
+			artist,
+			NewFrameComment("eng", "Note\ufeff", "Cafe\u0301\x00"),
+			NewFrameURL(FrameTypeURLArtist, "http://example.com/ "),
+		)
+		return tag
+	}
+	check := func(name string, tag *Tag) {
+		if ft := tag.textFrame(FrameTypeTextArtist); !reflect.DeepEqual(ft.Text, []string{"Björk", "Sjón"}) {
+			t.Errorf("%s:\n  got %q, expected %q\n", name, ft.Text, []string{"Björk", "Sjón"})
+		}
+		if c := tag.FindFrame(FrameTypeComment).(*FrameComment); c.Description != "Note" || c.Text != "Café" {
+			t.Errorf("%s:\n  got %q, %q, expected %q, %q\n", name, c.Description, c.Text, "Note", "Café")
+		}
+		if u := tag.FindFrame(FrameTypeURLArtist).(*FrameURL); u.URL != "http://example.com/ " {
+			t.Errorf("%s:\n  got %q, expected %q\n", name, u.URL, "http://example.com/ ")
+		}
+	}
+
+	// Sanitize the tag directly.
+	tag := newTag()
+	if err := tag.Sanitize(SanitizeAll); err != nil {
+		t.Fatal(err)
+	}
+	check("sanitize", tag)
+
+	// Read-only frames are sanitized only when forced, but unchanged
+	// read-only frames don't prevent sanitization.
+	tag = newTag()
+	HeaderOf(tag.FindFrame(FrameTypeComment)).SetFlag(FrameFlagReadOnly, true)
+	var roErr *ReadOnlyError
+	if err := tag.Sanitize(SanitizeAll); !errors.As(err, &roErr) {
+		t.Errorf("read-only:\n  got error '%v', expected a ReadOnlyError\n", err)
+	}
+	if ft := tag.textFrame(FrameTypeTextArtist); len(ft.Text) != 3 {
+		t.Errorf("read-only:\n  tag was modified\n")
+	}
+	if err := tag.Sanitize(SanitizeAll, EditForce); err != nil {
+		t.Fatal(err)
+	}
+	check("forced", tag)
+	HeaderOf(tag.FindFrame(FrameTypeTextArtist)).SetFlag(FrameFlagReadOnly, true)
+	if err := tag.Sanitize(SanitizeAll); err != nil {
+		t.Errorf("unchanged:\n  got error '%v'\n", err)
+	}
+
+	// Sanitize while decoding.
+	buf := bytes.NewBuffer([]byte{})
+	if _, err := newTag().WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	tag = &Tag{}
+	if _, err := tag.ReadFromWithOptions(buf, DecodeOptions{Sanitize: SanitizeAll}); err != nil {
+		t.Fatal(err)
+	}
+	check("decode", tag)
+
+	// Sanitize while encoding, leaving the encoded tag untouched.
+	tag = newTag()
+	buf = bytes.NewBuffer([]byte{})
+	if _, err := tag.WriteToWithOptions(buf, EncodeOptions{Sanitize: SanitizeAll}); err != nil {
+		t.Fatal(err)
+	}
+	if ft := tag.textFrame(FrameTypeTextArtist); len(ft.Text) != 3 {
+		t.Errorf("encode:\n  tag was modified\n")
+	}
+	tag = &Tag{}
+	if _, err := tag.ReadFrom(buf); err != nil {
+		t.Fatal(err)
+	}
+	check("encode", tag)
+}
+
+func TestLenient(t *testing.T) {
+	encode := func(tag *Tag) []byte {
+		buf := bytes.NewBuffer([]byte{})
+		if _, err := tag.WriteTo(buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	newTag := func(flags TagFlags, title string) *Tag {
+		tag := NewTag(Version2_4, flags)
+		title1 := NewFrameText(FrameTypeTextSongTitle, title)
+		title1.Encoding = EncodingISO88591
+		artist := NewFrameText(FrameTypeTextArtist, "Artist")
+		artist.Encoding = EncodingISO88591
+		tag.Frames = append(tag.Frames, title1, artist)
+		return tag
+	}
+
+	// Frame sizes stored as plain integers instead of sync-safe integers.
+	plain200 := encode(newTag(0, strings.Repeat("x", 199)))
+	copy(plain200[14:18], []byte{0, 0, 0, 200})
+	plain256 := encode(newTag(0, strings.Repeat("x", 255)))
+	copy(plain256[14:18], []byte{0, 0, 1, 0})
+
+	// Padding containing non-zero bytes.
+	junk := encode(newTag(0, "Title"))
+	junk = append(junk, 0, 0, 'J', 'U', 'N', 'K', 0xff)
+	encodeSyncSafeUint32(junk[6:10], uint32(len(junk)-10))
+
+	// A frame with an invalid text encoding.
+	badFrame := encode(newTag(0, "Title"))
+	badFrame[20] = 9
+
+	// A tag whose size excludes its extended header.
+	exTag := newTag(TagFlagHasRestrictions, "Title")
+	exTag.Restrictions = Restrictions{ImageSize: ImageSize256}
+	exHeader := encode(exTag)
+	size, _ := decodeSyncSafeUint32(exHeader[6:10])
+	encodeSyncSafeUint32(exHeader[6:10], size-8)
+
+	checkWarnings := func(name string, i int, got, expected []error) {
+		if len(got) != len(expected) {
+			t.Errorf("case %d:\n  %s got warnings %v, expected %v\n", i, name, got, expected)
+			return
+		}
+		for j := range expected {
+			if !errors.Is(got[j], expected[j]) {
+				t.Errorf("case %d:\n  %s got warning '%v', expected '%v'\n", i, name, got[j], expected[j])
+			}
+		}
+	}
+	checkFrames := func(name string, i int, frames []Frame, title string) {
+		if len(frames) != 2 {
+			t.Errorf("case %d:\n  %s got %d frames, expected 2\n", i, name, len(frames))
+			return
+		}
+		var s string
+		if ft, ok := frames[0].(*FrameText); ok {
+			s = ft.Text[0]
+		}
+		if s != title {
+			t.Errorf("case %d:\n  %s got title '%s', expected '%s'\n", i, name, s, title)
+		}
+		if ft, ok := frames[1].(*FrameText); !ok || ft.Text[0] != "Artist" {
+			t.Errorf("case %d:\n  %s got frame %+v, expected artist\n", i, name, frames[1])
+		}
+	}
+
+	var cases = []struct {
+		input    []byte
+		title    string
+		warnings []error
+		padding  int
+	}{
+		{plain200, strings.Repeat("x", 199), []error{ErrInvalidFrameSize}, 0},
+		{plain256, strings.Repeat("x", 255), []error{ErrInvalidFrameSize}, 0},
+		{junk, "Title", []error{ErrInvalidPadding}, 7},
+		{badFrame, "", []error{ErrInvalidEncoding}, 0},
+		{exHeader, "Title", []error{ErrInvalidTagSize}, 0},
+	}
+
+	for i, c := range cases {
+		tag := &Tag{}
+		if _, err := tag.ReadFrom(bytes.NewBuffer(c.input)); err == nil {
+			t.Errorf("case %d:\n  expected strict decode to fail\n", i)
+		}
+
+		tag = &Tag{}
+		_, err := tag.ReadFromWithOptions(bytes.NewBuffer(c.input), DecodeOptions{Lenient: true})
+		if err != nil {
+			t.Errorf("case %d:\n  got error '%v'\n", i, err)
+			continue
+		}
+		if len(tag.Warnings) != len(c.warnings) {
+			t.Errorf("case %d:\n  got warnings %v, expected %v\n", i, tag.Warnings, c.warnings)
+			continue
+		}
+		for j := range c.warnings {
+			if !errors.Is(tag.Warnings[j], c.warnings[j]) {
+				t.Errorf("case %d:\n  got warning '%v', expected '%v'\n", i, tag.Warnings[j], c.warnings[j])
+			}
+		}
+		if len(tag.Frames) != 2 {
+			t.Errorf("case %d:\n  got %d frames, expected 2\n", i, len(tag.Frames))
+			continue
+		}
+		if s, _ := tag.text(FrameTypeTextSongTitle); s != c.title {
+			t.Errorf("case %d:\n  got title '%s', expected '%s'\n", i, s, c.title)
+		}
+		if s, _ := tag.text(FrameTypeTextArtist); s != "Artist" {
+			t.Errorf("case %d:\n  got artist '%s', expected '%s'\n", i, s, "Artist")
+		}
+		if tag.Padding != c.padding {
+			t.Errorf("case %d:\n  got padding %d, expected %d\n", i, tag.Padding, c.padding)
+		}
+
+		// A TagReader tolerates the same problems.
+		tr, err := NewTagReaderWithOptions(bytes.NewReader(c.input), DecodeOptions{Lenient: true})
+		if err != nil {
+			t.Errorf("case %d:\n  got TagReader error '%v'\n", i, err)
+			continue
+		}
+		var frames []Frame
+		for j := range tr.Frames() {
+			f, err := tr.Frame(j)
+			if err != nil {
+				t.Errorf("case %d:\n  got TagReader error '%v'\n", i, err)
+			}
+			frames = append(frames, f)
+		}
+		tr.Frame(0)
+		checkWarnings("TagReader", i, tr.Warnings, c.warnings)
+		checkFrames("TagReader", i, frames, c.title)
+
+		// So does a FrameScanner.
+		opts := ScanOptions{DecodeOptions: DecodeOptions{Lenient: true}}
+		s, err := NewFrameScannerWithOptions(bytes.NewReader(c.input), opts)
+		if err != nil {
+			t.Errorf("case %d:\n  got FrameScanner error '%v'\n", i, err)
+			continue
+		}
+		frames = nil
+		for s.Next() {
+			f, err := s.Frame()
+			if err != nil {
+				t.Errorf("case %d:\n  got FrameScanner error '%v'\n", i, err)
+			}
+			s.Frame()
+			frames = append(frames, f)
+		}
+		if s.Err() != nil {
+			t.Errorf("case %d:\n  got FrameScanner error '%v'\n", i, s.Err())
+		}
+		checkWarnings("FrameScanner", i, s.Warnings, c.warnings)
+		checkFrames("FrameScanner", i, frames, c.title)
+	}
+
+	// Frames that can't be decoded are kept and re-encoded unchanged.
+	tag := &Tag{}
+	if _, err := tag.ReadFromWithOptions(bytes.NewBuffer(badFrame), DecodeOptions{Lenient: true}); err != nil {
+		t.Fatal(err)
+	}
+	if f, ok := tag.Frames[0].(*FrameUnknown); !ok || f.FrameID != "TIT2" || f.Header.FrameType != FrameTypeUnknown {
+		t.Errorf("got frame %#v, expected unknown TIT2 frame", tag.Frames[0])
+	}
+	if b := encode(tag); bytes.Compare(b, badFrame) != 0 {
+		t.Errorf("Tag write error: Different bytes encoded")
+		hexdump(badFrame, os.Stdout)
+		hexdump(b, os.Stdout)
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	tag := NewTag(Version2_4, 0)
+	tag.Frames = append(tag.Frames,
+		NewFrameText(FrameTypeTextSongTitle, "Title"),
+		NewFrameComment("eng", "", "Comment"),
+	)
+	buf := bytes.NewBuffer([]byte{})
+	if _, err := tag.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// Corrupt the comment frame's text encoding.
+	b := buf.Bytes()
+	b[36] = 9
+
+	_, err := new(Tag).ReadFrom(bytes.NewBuffer(b))
+	if err == nil {
+		t.Fatal("expected decode to fail")
+	}
+	expected := &DecodeError{
+		Err:     ErrInvalidEncoding,
+		Offset:  26,
+		FrameID: "COMM",
+		Field:   "Encoding",
+		Version: Version2_4,
+	}
+	var derr *DecodeError
+	if !errors.As(err, &derr) || !reflect.DeepEqual(derr, expected) {
+		t.Errorf("got error %#v, expected %#v", err, expected)
+	}
+	if !errors.Is(err, ErrInvalidEncoding) {
+		t.Errorf("error '%v' doesn't wrap '%v'", err, ErrInvalidEncoding)
+	}
+	if s := err.Error(); s != "v2.4 tag offset 26: COMM frame field Encoding: invalid text encoding" {
+		t.Errorf("got error string '%s'", s)
+	}
+
+	// Encoding errors identify the frame and field.
+	tag = NewTag(Version2_3, 0)
+	tag.Frames = append(tag.Frames,
+		NewFrameText(FrameTypeTextSongTitle, "Title"),
+		NewFrameText(FrameTypeTextArtist, "Artist"),
+	)
+	opts := EncodeOptions{TextEncoding: EncodingPolicyPreserve}
+	_, err = tag.WriteToWithOptions(bytes.NewBuffer([]byte{}), opts)
+	expectedEnc := &EncodeError{
+		Err:     ErrInvalidEncoding,
+		Offset:  10,
+		FrameID: "TIT2",
+		Field:   "Encoding",
+		Version: Version2_3,
+	}
+	var eerr *EncodeError
+	if !errors.As(err, &eerr) || !reflect.DeepEqual(eerr, expectedEnc) {
+		t.Errorf("got error %#v, expected %#v", err, expectedEnc)
+	}
+	if !errors.Is(err, ErrInvalidEncoding) {
+		t.Errorf("error '%v' doesn't wrap '%v'", err, ErrInvalidEncoding)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	var cases = []struct {
+		version Version
+		frames  []Frame
+		rules   []string
+	}{
+		{Version2_4, []Frame{
+			NewFrameText(FrameTypeTextSongTitle, "Title"),
+			NewFrameComment("eng", "", "Comment"),
+			NewFramePlayCount(1),
+		}, nil},
+		{Version2_4, []Frame{
+			NewFrameText(FrameTypeTextSongTitle, "Title"),
+			NewFrameText(FrameTypeTextSongTitle, "Title 2"),
+		}, []string{RuleDuplicateTextFrame}},
+		{Version2_4, []Frame{
+			NewFrameAttachedPicture("image/png", "cover", PictureTypeCoverFront, nil),
+			NewFrameAttachedPicture("image/png", "cover", PictureTypeCoverBack, nil),
+		}, []string{RuleDuplicatePicture}},
+		{Version2_4, []Frame{
+			NewFrameComment("EN", "", "Comment"),
+			NewFrameComment("xyz", "", "Comment"),
+		}, []string{RuleInvalidLanguage, RuleUnknownLanguage}},
+		{Version2_4, []Frame{
+			NewFrameComment("eng", "a", "Comment"),
+			NewFrameComment("eng", "a", "Comment 2"),
+			NewFrameComment("fra", "a", "Comment 3"),
+		}, []string{RuleDuplicateComment}},
+		{Version2_3, []Frame{
+			NewFrameText(FrameTypeTextSetSubtitle, "Disc 1"),
+		}, []string{RuleUnsupportedFrame}},
+		{Version2_4, []Frame{
+			NewFrameUniqueFileID("", strings.Repeat("x", 65)),
+		}, []string{RuleUniqueFileIDOwner, RuleUniqueFileIDLength}},
+		{Version2_4, []Frame{
+			NewFramePopularimeter("a@b.c", 1, 0),
+			NewFramePopularimeter("a@b.c", 2, 0),
+			NewFramePlayCount(1),
+			NewFramePlayCount(2),
+		}, []string{RuleDuplicatePopularimeter, RuleDuplicatePlayCount}},
+		{Version2_4, []Frame{
+			NewFrameURL(FrameTypeURLArtist, "http://a"),
+			NewFrameURL(FrameTypeURLArtist, "http://b"),
+			NewFrameURL(FrameTypeURLCommercial, "http://a"),
+			NewFrameURL(FrameTypeURLCommercial, "http://b"),
+		}, nil},
+		{Version2_4, []Frame{
+			NewFrameURL(FrameTypeURLArtist, "http://a"),
+			NewFrameURL(FrameTypeURLArtist, "http://a"),
+			NewFrameURL(FrameTypeURLAudioFile, "http://a"),
+			NewFrameURL(FrameTypeURLAudioFile, "http://b"),
+		}, []string{RuleDuplicateURLFrame, RuleDuplicateURLFrame}},
+	}
+
+	for i, c := range cases {
+		tag := NewTag(c.version, 0)
+		tag.Frames = c.frames
+
+		var rules []string
+		for _, issue := range tag.Validate() {
+			rules = append(rules, issue.Rule)
+		}
+		if !reflect.DeepEqual(rules, c.rules) {
+			t.Errorf("case %d:\n  got %v, expected %v\n", i, rules, c.rules)
+		}
+	}
+}
+
+func TestRestrictions(t *testing.T) {
+	for b := 0; b < 256; b++ {
+		if got := decodeRestrictions(uint8(b)).encode(); got != uint8(b) {
+			t.Errorf("restrictions byte %#02x encoded as %#02x", b, got)
+		}
+	}
+
+	newPNG := func(w, h int) []byte {
+		buf := bytes.NewBuffer([]byte{})
+		png.Encode(buf, image.NewGray(image.Rect(0, 0, w, h)))
+		return buf.Bytes()
+	}
+	newTag := func(r Restrictions, frames ...Frame) *Tag {
+		tag := NewTag(Version2_4, TagFlagHasRestrictions)
+		tag.Restrictions = r
+		tag.Frames = frames
+		return tag
+	}
+	newTitle := func(enc Encoding, s string) Frame {
+		f := NewFrameText(FrameTypeTextSongTitle, s)
+		f.Encoding = enc
+		return f
+	}
+
+	// Validation reports each violated restriction.
+	strict := Restrictions{
+		TagSize:       TagSize32Frames4KB,
+		TextEncoding:  true,
+		TextSize:      TextSize30,
+		ImageEncoding: true,
+		ImageSize:     ImageSize64,
+	}
+	var cases = []struct {
+		tag   *Tag
+		rules []string
+	}{
+		{newTag(strict, newTitle(EncodingUTF8, "Title"),
+			NewFrameAttachedPicture("image/png", "", PictureTypeCoverFront, newPNG(64, 64))), nil},
+		{newTag(strict, newTitle(EncodingUTF16BOM, "Title")),
+			[]string{RuleRestrictedTextEncoding}},
+		{newTag(strict, newTitle(EncodingUTF8, strings.Repeat("x", 31))),
+			[]string{RuleRestrictedTextSize}},
+		{newTag(strict, NewFrameAttachedPicture("image/gif", "", PictureTypeCoverFront, []byte("GIF89a"))),
+			[]string{RuleRestrictedImageFormat}},
+		{newTag(strict, NewFrameAttachedPicture("image/png", "", PictureTypeCoverFront, newPNG(65, 64))),
+			[]string{RuleRestrictedImageSize}},
+		{newTag(strict, NewFramePrivate("owner", make([]byte, 5000))),
+			[]string{RuleRestrictedTagSize}},
+		{newTag(Restrictions{TextSize: TextSize30}, newTitle(EncodingUTF8, strings.Repeat("x", 31))),
+			[]string{RuleRestrictedTextSize}},
+		{newTag(strict, NewFrameComment("english", "", "Comment")),
+			[]string{RuleInvalidLanguage, RuleEncodingFailed}},
+	}
+	for i, c := range cases {
+		var rules []string
+		for _, issue := range c.tag.Validate() {
+			rules = append(rules, issue.Rule)
+		}
+		if !reflect.DeepEqual(rules, c.rules) {
+			t.Errorf("case %d:\n  got %v, expected %v\n", i, rules, c.rules)
+		}
+	}
+
+	// Measuring the tag's size leaves the tag and its frame headers
+	// unchanged.
+	tag := newTag(strict, newTitle(EncodingUTF8, "Title"))
+	tag.Validate()
+	if h := HeaderOf(tag.Frames[0]); h.Size != 0 || h.FrameID != "" {
+		t.Errorf("validation changed the frame header to %+v", h)
+	}
+	if tag.Flags != TagFlagHasRestrictions || tag.Size != 0 {
+		t.Errorf("validation changed the tag flags to %v and size to %d", tag.Flags, tag.Size)
+	}
+
+	// Applying restrictions truncates and re-encodes text and reduces
+	// padding.
+	title := strings.Repeat("\u00e9\u4e16", 20)
+	tag = newTag(strict, newTitle(EncodingUTF16BOM, title))
+	tag.Padding = 8192
+	opts := EncodeOptions{TextEncoding: EncodingPolicyPreserve, ApplyRestrictions: true}
+	buf := bytes.NewBuffer([]byte{})
+	if _, err := tag.WriteToWithOptions(buf, opts); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() > 4096 {
+		t.Errorf("tag is %d bytes, expected at most 4096", buf.Len())
+	}
+	if tag.Frames[0].(*FrameText).Text[0] != title {
+		t.Errorf("applying restrictions modified the tag")
+	}
+
+	tag = new(Tag)
+	if _, err := tag.ReadFrom(buf); err != nil {
+		t.Fatal(err)
+	}
+	if tag.Restrictions != strict {
+		t.Errorf("got restrictions %+v, expected %+v", tag.Restrictions, strict)
+	}
+	ft := tag.Frames[0].(*FrameText)
+	if ft.Encoding != EncodingUTF8 || ft.Text[0] != string([]rune(title)[:30]) {
+		t.Errorf("got title %q encoded as %v", ft.Text[0], ft.Encoding)
+	}
+
+	// Pictures and tags that can't be made to conform fail.
+	failures := []struct {
+		tag *Tag
+		err error
+	}{
+		{newTag(strict, NewFrameAttachedPicture("image/png", "", PictureTypeCoverFront, newPNG(128, 128))),
+			ErrRestrictedImageSize},
+		{newTag(strict, NewFrameAttachedPicture("image/bmp", "", PictureTypeCoverFront, []byte("BM"))),
+			ErrRestrictedImageFormat},
+		{newTag(strict, NewFramePrivate("owner", make([]byte, 5000))),
+			ErrRestrictedTagSize},
+	}
+	for i, c := range failures {
+		_, err := c.tag.WriteToWithOptions(bytes.NewBuffer([]byte{}), opts)
+		if !errors.Is(err, c.err) {
+			t.Errorf("case %d:\n  got error '%v', expected '%v'\n", i, err, c.err)
+		}
+	}
+}
+
+func TestAlteration(t *testing.T) {
+	newTag := func() *Tag {
+		tag := NewTag(Version2_4, 0)
+		title := NewFrameText(FrameTypeTextSongTitle, "Title")
+		length := NewFrameText(FrameTypeTextLengthInMs, "1000")
+		length.Header.SetFlag(FrameFlagDiscardOnFileAlteration, true)
+		priv := NewFramePrivate("owner", []byte{1, 2, 3})
+		priv.Header.SetFlag(FrameFlagDiscardOnTagAlteration, true)
+		unknown := NewFrameUnknown("XYZZ", []byte{1, 2, 3})
+		unknown.Header.SetFlag(FrameFlagDiscardOnTagAlteration, true)
+		tag.Frames = append(tag.Frames, title, length, priv, unknown)
+
+		buf := bytes.NewBuffer([]byte{})
+		if _, err := tag.WriteTo(buf); err != nil {
+			t.Fatal(err)
+		}
+		tag = new(Tag)
+		if _, err := tag.ReadFrom(buf); err != nil {
+			t.Fatal(err)
+		}
+		return tag
+	}
+	ids := func(ff []Frame) string {
+		var s []string
+		for _, f := range ff {
+			s = append(s, HeaderOf(f).FrameID)
+		}
+		return strings.Join(s, ",")
+	}
+
+	var cases = []struct {
+		alter     func(tag *Tag)
+		opts      EncodeOptions
+		altered   bool
+		frames    string
+		discarded string
+	}{
+		{func(tag *Tag) {}, EncodeOptions{}, false, "TIT2,TLEN,PRIV,XYZZ", ""},
+		{func(tag *Tag) { tag.Frames[0].(*FrameText).Text[0] = "New" }, EncodeOptions{}, true, "TIT2,TLEN,PRIV", "XYZZ"},
+		{func(tag *Tag) { tag.Padding = 64 }, EncodeOptions{}, true, "TIT2,TLEN,PRIV", "XYZZ"},
+		{func(tag *Tag) { tag.Frames[0], tag.Frames[1] = tag.Frames[1], tag.Frames[0] }, EncodeOptions{}, true, "TLEN,TIT2,PRIV", "XYZZ"},
+		{func(tag *Tag) { tag.RemoveFrames(FrameTypeTextSongTitle) }, EncodeOptions{}, true, "TLEN,PRIV", "XYZZ"},
+		{func(tag *Tag) { tag.Padding = 64 }, EncodeOptions{PreserveDiscardable: true}, true, "TIT2,TLEN,PRIV,XYZZ", ""},
+		{func(tag *Tag) { tag.Padding = 64 }, EncodeOptions{DiscardKnownFrames: true}, true, "TIT2,TLEN", "PRIV,XYZZ"},
+		{func(tag *Tag) { tag.DiscardOnFileAlteration() }, EncodeOptions{}, true, "TIT2,PRIV", "XYZZ"},
+		{func(tag *Tag) { HeaderOf(tag.Frames[0]).SetFlag(FrameFlagReadOnly, true) }, EncodeOptions{}, true, "TIT2,TLEN,PRIV", "XYZZ"},
+		{func(tag *Tag) { HeaderOf(tag.Frames[2]).SetFlag(FrameFlagDiscardOnTagAlteration, false) }, EncodeOptions{}, true, "TIT2,TLEN,PRIV", "XYZZ"},
+		{func(tag *Tag) { HeaderOf(tag.Frames[0]).Size = 0 }, EncodeOptions{}, false, "TIT2,TLEN,PRIV,XYZZ", ""},
+	}
+
+	for i, c := range cases {
+		tag := newTag()
+		c.alter(tag)
+		if tag.Altered() != c.altered {
+			t.Errorf("case %d: got altered %v, expected %v", i, tag.Altered(), c.altered)
+		}
+
+		buf := bytes.NewBuffer([]byte{})
+		if _, err := tag.WriteToWithOptions(buf, c.opts); err != nil {
+			t.Fatalf("case %d: %v", i, err)
+		}
+		if tag.Altered() {
+			t.Errorf("case %d: tag altered after writing", i)
+		}
+		if s := ids(tag.Discarded); s != c.discarded {
+			t.Errorf("case %d:\n  got discarded %q, expected %q\n", i, s, c.discarded)
+		}
+
+		tag = new(Tag)
+		if _, err := tag.ReadFrom(buf); err != nil {
+			t.Fatalf("case %d: %v", i, err)
+		}
+		if s := ids(tag.Frames); s != c.frames {
+			t.Errorf("case %d:\n  got frames %q, expected %q\n", i, s, c.frames)
+		}
+	}
+
+	tag := newTag()
+	if ff := tag.DiscardOnFileAlteration(); ids(ff) != "TLEN" {
+		t.Errorf("got discarded %q, expected %q", ids(ff), "TLEN")
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	newTag := func() *Tag {
+		tag := NewTag(Version2_4, 0)
+		isrc := NewFrameText(FrameTypeTextISRC, "USABC1234567")
+		isrc.Header.SetFlag(FrameFlagReadOnly, true)
+		ufid := NewFrameUniqueFileID("label", "1234")
+		ufid.Header.SetFlag(FrameFlagReadOnly, true)
+		tag.Frames = append(tag.Frames,
+			NewFrameText(FrameTypeTextSongTitle, "Title"), isrc, ufid)
+		return tag
+	}
+
+	var cases = []struct {
+		edit   func(tag *Tag) error
+		err    error
+		frames int
+	}{
+		{func(tag *Tag) error { return tag.SetText(FrameTypeTextSongTitle, "New") }, nil, 3},
+		{func(tag *Tag) error { return tag.SetText(FrameTypeTextISRC, "X") }, ErrReadOnly, 3},
+		{func(tag *Tag) error { return tag.SetText(FrameTypeTextISRC, "X", EditForce) }, nil, 3},
+		{func(tag *Tag) error { return tag.SetTextValues(FrameTypeTextISRC, nil) }, ErrReadOnly, 3},
+		{func(tag *Tag) error { return tag.SetTextValues(FrameTypeTextArtist, []string{"A", "B"}) }, nil, 4},
+		{func(tag *Tag) error { return tag.RemoveFrames(FrameTypeUniqueFileID) }, ErrReadOnly, 3},
+		{func(tag *Tag) error { return tag.RemoveFrames(FrameTypeUniqueFileID, EditForce) }, nil, 2},
+		{func(tag *Tag) error { return tag.RemoveFrame(tag.Frames[2]) }, ErrReadOnly, 3},
+		{func(tag *Tag) error { return tag.RemoveFrame(tag.Frames[0]) }, nil, 2},
+		{func(tag *Tag) error { return tag.RemoveFrame(NewFramePlayCount(1)) }, ErrFrameNotFound, 3},
+		{func(tag *Tag) error { return tag.ReplaceFrame(tag.Frames[2], NewFrameUniqueFileID("x", "1")) }, ErrReadOnly, 3},
+		{func(tag *Tag) error { return tag.ReplaceFrame(tag.Frames[0], NewFramePlayCount(1)) }, nil, 3},
+		{func(tag *Tag) error { return tag.ApplyMetadata(&Metadata{Title: "New"}, MetadataOptions{}) }, nil, 3},
+		{func(tag *Tag) error { return tag.ApplyMetadata(&Metadata{}, MetadataOptions{RemoveEmpty: true}) }, nil, 2},
+	}
+
+	for i, c := range cases {
+		tag := newTag()
+		err := c.edit(tag)
+		if !errors.Is(err, c.err) || (err == nil) != (c.err == nil) {
+			t.Errorf("case %d:\n  got error '%v', expected '%v'\n", i, err, c.err)
+		}
+		if len(tag.Frames) != c.frames {
+			t.Errorf("case %d:\n  got %d frames, expected %d\n", i, len(tag.Frames), c.frames)
+		}
+		if s, _ := tag.text(FrameTypeTextISRC); c.err != nil && s != "USABC1234567" {
+			t.Errorf("case %d: read-only frame modified", i)
+		}
+	}
+
+	// Decoded read-only frames identify themselves in errors.
+	tag := newTag()
+	buf := bytes.NewBuffer([]byte{})
+	if _, err := tag.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	tag = new(Tag)
+	if _, err := tag.ReadFrom(buf); err != nil {
+		t.Fatal(err)
+	}
+	err := tag.SetText(FrameTypeTextISRC, "X")
+	var rerr *ReadOnlyError
+	if !errors.As(err, &rerr) || rerr.FrameID != "TSRC" || err.Error() != "TSRC frame is read-only" {
+		t.Errorf("got error %#v", err)
+	}
+
+	// Frames stored by value, which may not be comparable, are rejected
+	// without panicking.
+	title := NewFrameText(FrameTypeTextSongTitle, "Title")
+	tag = NewTag(Version2_4, 0)
+	tag.Frames = append(tag.Frames, *NewFrameText(FrameTypeTextArtist, "Artist"), title)
+	if err := tag.RemoveFrame(tag.Frames[0]); err != ErrInvalidFrameStruct {
+		t.Errorf("got error '%v', expected '%v'", err, ErrInvalidFrameStruct)
+	}
+	if err := tag.ReplaceFrame(tag.Frames[0], title); err != ErrInvalidFrameStruct {
+		t.Errorf("got error '%v', expected '%v'", err, ErrInvalidFrameStruct)
+	}
+	if err := tag.RemoveFrame(title); err != nil || len(tag.Frames) != 1 {
+		t.Errorf("got error '%v', %d frames", err, len(tag.Frames))
+	}
+}
+
+func TestTagReader(t *testing.T) {
+	for _, v := range []Version{Version2_3, Version2_4} {
+		for _, flags := range []TagFlags{0, TagFlagUnsync, TagFlagHasCRC} {
+			tag := NewTag(v, flags)
+			tag.Frames = append(tag.Frames,
+				NewFrameText(FrameTypeTextSongTitle, "Title"),
+				NewFrameAttachedPicture("image/jpeg", "cover", PictureTypeCoverFront, []byte{0xff, 0xd8, 0xff, 0x00, 1, 2, 3}),
+				NewFrameText(FrameTypeTextArtist, "Artist"),
+			)
+			tag.Padding = 16
+			buf := bytes.NewBuffer([]byte{})
+			if _, err := tag.WriteTo(buf); err != nil {
+				t.Fatal(err)
+			}
+
+			tr, err := NewTagReader(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatalf("v2.%d flags %#x: %v", v, flags, err)
+			}
+
+			hh := tr.Frames()
+			if len(hh) != 3 || hh[1].FrameID != "APIC" || hh[1].FrameType != FrameTypeAttachedPicture {
+				t.Errorf("v2.%d flags %#x: got headers %+v", v, flags, hh)
+				continue
+			}
+
+			f, err := tr.FindFrame(FrameTypeTextArtist)
+			if err != nil || f.(*FrameText).Text[0] != "Artist" {
+				t.Errorf("v2.%d flags %#x: got frame %+v, error %v", v, flags, f, err)
+			}
+			f, err = tr.Frame(1)
+			if err != nil || !bytes.Equal(f.(*FrameAttachedPicture).Data, []byte{0xff, 0xd8, 0xff, 0x00, 1, 2, 3}) {
+				t.Errorf("v2.%d flags %#x: got frame %+v, error %v", v, flags, f, err)
+			}
+			if f, _ := tr.FindFrame(FrameTypeComment); f != nil {
+				t.Errorf("v2.%d flags %#x: found missing frame", v, flags)
+			}
+
+			raw, err := tr.Raw(0)
+			if err != nil || len(raw) != hh[0].Size || string(raw[1:]) != "Title" {
+				t.Errorf("v2.%d flags %#x: got raw payload %q, error %v", v, flags, raw, err)
+			}
+		}
+	}
+
+	// Frames that can't be decoded report their location.
+	tag := NewTag(Version2_4, 0)
+	tag.Frames = append(tag.Frames,
+		NewFrameText(FrameTypeTextSongTitle, "Title"),
+		NewFrameComment("eng", "", "Comment"),
+	)
+	buf := bytes.NewBuffer([]byte{})
+	if _, err := tag.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	b[36] = 9
+
+	tr, err := NewTagReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tr.Frame(0); err != nil {
+		t.Error(err)
+	}
+	_, err = tr.Frame(1)
+	var derr *DecodeError
+	if !errors.As(err, &derr) || derr.Offset != 26 || derr.FrameID != "COMM" || !errors.Is(err, ErrInvalidEncoding) {
+		t.Errorf("got error %v", err)
+	}
+
+	if _, err := NewTagReader(bytes.NewReader([]byte("not a tag"))); err == nil {
+		t.Errorf("expected error for missing tag")
+	}
+
+	// Out of range frame indexes and I/O errors are reported.
+	for _, i := range []int{-1, 2} {
+		if _, err := tr.Frame(i); err != ErrFrameIndex {
+			t.Errorf("frame %d: got error '%v', expected '%v'", i, err, ErrFrameIndex)
+		}
+		if _, err := tr.Raw(i); err != ErrFrameIndex {
+			t.Errorf("frame %d: got error '%v', expected '%v'", i, err, ErrFrameIndex)
+		}
+	}
+
+	errIO := errors.New("i/o error")
+	fr := &failingReaderAt{r: bytes.NewReader(b)}
+	if tr, err = NewTagReader(fr); err != nil {
+		t.Fatal(err)
+	}
+	fr.err = errIO
+	if _, err := tr.Frame(0); err != errIO {
+		t.Errorf("got error '%v', expected '%v'", err, errIO)
+	}
+	if _, err := tr.Raw(0); err != errIO {
+		t.Errorf("got error '%v', expected '%v'", err, errIO)
+	}
+
+	fr.err = io.EOF
+	if _, err := tr.Raw(0); err != io.ErrUnexpectedEOF {
+		t.Errorf("got error '%v', expected '%v'", err, io.ErrUnexpectedEOF)
+	}
+}
+
+// A failingReaderAt reads from r until err is set.
+type failingReaderAt struct {
+	r   io.ReaderAt
+	err error
+}
+
+func (f *failingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	return f.r.ReadAt(p, off)
+}
+
+func TestFrameScanner(t *testing.T) {
+	picture := bytes.Repeat([]byte{0xff, 0x00, 0xe0, 0x12}, 256)
+	for _, v := range []Version{Version2_3, Version2_4} {
+		for _, flags := range []TagFlags{0, TagFlagUnsync, TagFlagHasCRC} {
+			tag := NewTag(v, flags)
+			tag.Frames = append(tag.Frames,
+				NewFrameText(FrameTypeTextSongTitle, "Title"),
+				NewFrameAttachedPicture("image/jpeg", "", PictureTypeCoverFront, picture),
+				NewFrameText(FrameTypeTextArtist, "Artist"),
+			)
+			tag.Padding = 16
+			buf := bytes.NewBuffer([]byte{})
+			if _, err := tag.WriteTo(buf); err != nil {
+				t.Fatal(err)
+			}
+			buf.WriteString("audio")
+
+			s, err := NewFrameScannerWithOptions(buf, ScanOptions{MaxFrameSize: 512})
+			if err != nil {
+				t.Fatalf("v2.%d flags %#x: %v", v, flags, err)
+			}
+
+			var ids []string
+			for s.Next() {
+				h := s.Header()
+				ids = append(ids, h.FrameID)
+				switch h.FrameID {
+				case "TIT2":
+					// Leave the frame unread.
+				case "APIC":
+					if _, err := s.Frame(); !errors.Is(err, ErrFrameTooLarge) {
+						t.Errorf("v2.%d flags %#x: got error %v, expected %v", v, flags, err, ErrFrameTooLarge)
+					}
+					b, err := io.ReadAll(s.Payload())
+					if err != nil || len(b) != h.Size || !bytes.HasSuffix(b, picture) {
+						t.Errorf("v2.%d flags %#x: got payload of %d bytes, error %v", v, flags, len(b), err)
+					}
+				case "TPE1":
+					f, err := s.Frame()
+					if err != nil || f.(*FrameText).Text[0] != "Artist" {
+						t.Errorf("v2.%d flags %#x: got frame %+v, error %v", v, flags, f, err)
+					}
+				}
+			}
+			if s.Err() != nil {
+				t.Errorf("v2.%d flags %#x: %v", v, flags, s.Err())
+			}
+			if strings.Join(ids, " ") != "TIT2 APIC TPE1" {
+				t.Errorf("v2.%d flags %#x: got frames %v", v, flags, ids)
+			}
+			if buf.String() != "audio" {
+				t.Errorf("v2.%d flags %#x: got remainder %q", v, flags, buf.String())
+			}
+		}
+	}
+
+	// A truncated tag reports an error.
+	tag := NewTag(Version2_4, 0)
+	tag.Frames = append(tag.Frames, NewFrameText(FrameTypeTextSongTitle, "Title"))
+	buf := bytes.NewBuffer([]byte{})
+	if _, err := tag.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewFrameScanner(bytes.NewReader(buf.Bytes()[:buf.Len()-2]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for s.Next() {
+	}
+	if !errors.Is(s.Err(), ErrIncompleteFrame) {
+		t.Errorf("got error %v, expected %v", s.Err(), ErrIncompleteFrame)
+	}
+
+	// A frame exceeding the MaxFrameSize decode limit stops the scan as
+	// soon as its header is read.
+	tag.Frames = append(tag.Frames,
+		NewFrameAttachedPicture("image/jpeg", "", PictureTypeCoverFront, make([]byte, 200)),
+		NewFrameText(FrameTypeTextArtist, "Artist"),
+	)
+	buf.Reset()
+	if _, err := tag.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	opts := ScanOptions{DecodeOptions: DecodeOptions{Limits: DecodeLimits{MaxFrameSize: 100}}}
+	if s, err = NewFrameScannerWithOptions(buf, opts); err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for s.Next() {
+		ids = append(ids, s.Header().FrameID)
+	}
+	var le *LimitError
+	var de *DecodeError
+	if !errors.As(s.Err(), &le) || le.Limit != "MaxFrameSize" || !errors.As(s.Err(), &de) || de.FrameID != "APIC" {
+		t.Errorf("got error %v, expected MaxFrameSize limit", s.Err())
+	}
+	if strings.Join(ids, " ") != "TIT2" {
+		t.Errorf("got frames %v", ids)
+	}
+}
+
+func TestDecodeLimits(t *testing.T) {
+	sync := NewFrameLyricsSync("eng", "", TimeStampMilliseconds, LyricContentTypeLyrics)
+	sync.AddSync(0, "one")
+	sync.AddSync(1000, "two")
+	sync.AddSync(2000, "three")
+
+	tag := NewTag(Version2_4, 0)
+	tag.Frames = append(tag.Frames,
+		NewFrameText(FrameTypeTextArtist, "A"),
+		NewFrameAttachedPicture("image/jpeg", "", PictureTypeCoverFront, make([]byte, 100)),
+		sync,
+	)
+	tag.Frames[0].(*FrameText).Text = []string{"A", "B", "C"}
+	buf := bytes.NewBuffer([]byte{})
+	if _, err := tag.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var cases = []struct {
+		limits DecodeLimits
+		limit  string
+	}{
+		{DecodeLimits{}, ""},
+		{DefaultDecodeLimits, ""},
+		{DecodeLimits{MaxTagSize: 100}, "MaxTagSize"},
+		{DecodeLimits{MaxFrameSize: 100}, "MaxFrameSize"},
+		{DecodeLimits{MaxFrames: 2}, "MaxFrames"},
+		{DecodeLimits{MaxStrings: 2}, "MaxStrings"},
+		{DecodeLimits{MaxEntries: 2}, "MaxEntries"},
+		{DecodeLimits{MaxPictureSize: 99}, "MaxPictureSize"},
+	}
+
+	for i, c := range cases {
+		for _, lenient := range []bool{false, true} {
+			var tag2 Tag
+			_, err := tag2.ReadFromWithOptions(bytes.NewReader(buf.Bytes()), DecodeOptions{Limits: c.limits, Lenient: lenient})
+			var le *LimitError
+			switch {
+			case c.limit == "" && err != nil:
+				t.Errorf("case %d: unexpected error %v\n", i, err)
+			case c.limit != "" && (!errors.As(err, &le) || le.Limit != c.limit || !errors.Is(err, ErrLimitExceeded)):
+				t.Errorf("case %d:\n  got error %v, expected %s limit\n", i, err, c.limit)
+			}
+		}
+	}
+}
+
+func TestCompression(t *testing.T) {
+	lyrics := strings.Repeat("la ", 200)
+	for _, v := range []Version{Version2_3, Version2_4} {
+		f := NewFrameLyricsUnsync("eng", "", lyrics)
+		f.Header.Flags = FrameFlagCompressed
+
+		tag := NewTag(v, 0)
+		tag.Frames = append(tag.Frames, f)
+		buf := bytes.NewBuffer([]byte{})
+		if _, err := tag.WriteTo(buf); err != nil {
+			t.Fatal(err)
+		}
+		if buf.Len() > len(lyrics)/2 || strings.Contains(buf.String(), "la la") {
+			t.Errorf("v2.%d: frame not compressed", v)
+		}
+
+		var tag2 Tag
+		if _, err := tag2.ReadFrom(bytes.NewReader(buf.Bytes())); err != nil {
+			t.Fatalf("v2.%d: %v", v, err)
+		}
+		f2 := tag2.Frames[0].(*FrameLyricsUnsync)
+		if f2.Text != lyrics || f2.Header.Flags&FrameFlagCompressed == 0 {
+			t.Errorf("v2.%d: got frame %+v", v, f2)
+		}
+
+		opts := DecodeOptions{Limits: DecodeLimits{MaxDecompressedSize: 2 * len(lyrics)}}
+		if _, err := tag2.ReadFromWithOptions(bytes.NewReader(buf.Bytes()), opts); err != nil {
+			t.Errorf("v2.%d: %v", v, err)
+		}
+		opts.Limits.MaxDecompressedSize = len(lyrics)
+		var le *LimitError
+		if _, err := tag2.ReadFromWithOptions(bytes.NewReader(buf.Bytes()), opts); !errors.As(err, &le) || le.Limit != "MaxDecompressedSize" {
+			t.Errorf("v2.%d: got error %v", v, err)
+		}
+	}
+}
+
+type frameNoHeader struct {
+	Text string
+}
+
+type frameIntField struct {
+	Header FrameHeader
+	Count  int
+}
+
+type frameNoEncoding struct {
+	Header FrameHeader
+	Text   []string
+}
+
+type frameNested struct {
+	Header   FrameHeader
+	Encoding Encoding
+	Inner    struct{ Value uint16 }
+	Items    []struct{ FrameID string }
+}
+
+func TestInvalidFrames(t *testing.T) {
+	var cases = []struct {
+		frame Frame
+		err   error
+	}{
+		{nil, ErrInvalidFrameStruct},
+		{FrameText{}, ErrInvalidFrameStruct},
+		{(*FrameText)(nil), ErrInvalidFrameStruct},
+		{new(int), ErrInvalidFrameStruct},
+		{&frameNoHeader{}, ErrInvalidFrameStruct},
+		{&frameIntField{}, ErrInvalidPayloadDef},
+		{&frameNoEncoding{Text: []string{"a"}}, ErrInvalidPayloadDef},
+		{&frameNested{}, nil},
+	}
+
+	for i, c := range cases {
+		_, herr := HeaderOfChecked(c.frame)
+		if (herr != nil) != (c.err == ErrInvalidFrameStruct) {
+			t.Errorf("case %d:\n  got header error %v\n", i, herr)
+		}
+
+		for _, v := range []Version{Version2_3, Version2_4} {
+			tag := NewTag(v, 0)
+			tag.Frames = append(tag.Frames, NewFrameText(FrameTypeTextSongTitle, "Title"), c.frame)
+			tag.FindFrame(FrameTypeTextArtist)
+			tag.Validate()
+
+			_, err := tag.WriteTo(io.Discard)
+			if !errors.Is(err, c.err) {
+				t.Errorf("case %d: v2.%d:\n  got error %v, expected %v\n", i, v, err, c.err)
+			}
+		}
+	}
+
+	// Frames that can't be scanned return an error rather than panicking.
+	var scans = []struct {
+		typ reflect.Type
+		err error
+	}{
+		{reflect.TypeOf(frameIntField{}), ErrInvalidPayloadDef},
+		{reflect.TypeOf(frameNoEncoding{}), ErrInvalidPayloadDef},
+		{reflect.TypeOf(frameNested{}), ErrInvalidPayloadDef},
+		{reflect.TypeOf(FrameText{}), nil},
+	}
+
+	rf := newReflector(Version2_4, newCodec24().vdata)
+	for i, c := range scans {
+		r := newReader(nil, nil)
+		r.ReplaceBuffer([]byte{0, 0, 1, 'a', 'b', 0})
+		rf.scanStruct(r, property{typ: c.typ, value: reflect.New(c.typ)}, &state{})
+		if r.err != c.err {
+			t.Errorf("case %d:\n  got error %v, expected %v\n", i, r.err, c.err)
+		}
+	}
+}
+
+// generatedTestFrames returns frames of every type with generated scan and
+// output methods.
+func generatedTestFrames() []Frame {
+	aspi := NewFrameAudioSeekPointIndex(100, 100000)
+	aspi.BitsPerIndex = 16
+	aspi.AddIndexOffset(0)
+	aspi.AddIndexOffset(50000)
+	aspi.AddIndexOffset(99999)
+
+	aspi8 := NewFrameAudioSeekPointIndex(0, 1000)
+	aspi8.BitsPerIndex = 8
+	aspi8.AddIndexOffset(500)
+
+	sylt := NewFrameLyricsSync("eng", "desc", TimeStampMilliseconds, LyricContentTypeLyrics)
+	sylt.AddSync(10, "la")
+	sylt.AddSync(20, "caf\u00e9")
+
+	syltLossy := NewFrameLyricsSync("eng", "desc", TimeStampMilliseconds, LyricContentTypeLyrics)
+	syltLossy.Encoding = EncodingISO88591
+	syltLossy.AddSync(10, "la")
+	syltLossy.AddSync(20, "\u20ac")
+
+	sytc := NewFrameSyncTempoCodes(TimeStampFrames)
+	sytc.AddSync(120, 0)
+	sytc.AddSync(300, 1000)
+
+	textLossy := NewFrameText(FrameTypeTextArtist, "a")
+	textLossy.Encoding = EncodingISO88591
+	textLossy.Text = append(textLossy.Text, "\u20ac")
+
+	badEncoding := NewFrameComment("eng", "", "text")
+	badEncoding.Encoding = 9
+
+	return []Frame{
+		NewFrameAttachedPicture("image/png", "cover", PictureTypeCoverFront, []byte{1, 2, 3}),
+		NewFrameAudioEncryption("owner", 1, 2, []byte{4, 5}),
+		aspi, aspi8,
+		NewFrameComment("eng", "desc", "\u4e16\u754c"),
+		NewFrameEncryptionMethodRegistration("owner", 0x80, []byte{6}),
+		NewFrameGroupID("owner", 0x81, nil),
+		sylt, syltLossy,
+		NewFrameLyricsUnsync("eng", "", "lyrics"),
+		NewFramePrivate("owner", []byte{7, 8, 9}),
+		NewFramePlayCount(1 << 40),
+		NewFramePopularimeter("a@b.c", 255, 12),
+		sytc,
+		NewFrameTermsOfUse("eng", "terms"),
+		NewFrameText(FrameTypeTextArtist, "a"),
+		&FrameText{Header: FrameHeader{FrameType: FrameTypeTextGenre}, Text: []string{"Rock", "Pop"}},
+		textLossy,
+		NewFrameTextCustom("key", "value"),
+		NewFrameUnknown("ZZZZ", []byte{1}),
+		NewFrameURL(FrameTypeURLArtist, "http://a.b"),
+		NewFrameURLCustom("desc", "http://a.b"),
+		NewFrameUniqueFileID("owner", "id"),
+		badEncoding,
+	}
+}
+
+func TestGeneratedFrames(t *testing.T) {
+	frames := generatedTestFrames()
+	covered := make(map[reflect.Type]bool)
+	for _, f := range frames {
+		covered[reflect.TypeOf(f).Elem()] = true
+	}
+	for typ := range generatedFrames {
+		if !covered[typ] {
+			t.Errorf("no test frame of type %s", typ.Name())
+		}
+	}
+
+	for _, v := range []Version{Version2_3, Version2_4} {
+		rf := newReflector(v, versionDataOf(v))
+		for _, policy := range []EncodingPolicy{EncodingPolicyLegalize, EncodingPolicyPreserve} {
+			opts := &EncodeOptions{MultiValueSeparator: "/", TextEncoding: policy}
+			for i, f := range frames {
+				// The generated output method must match the reflector.
+				w1 := newWriter(nil, opts)
+				id1, err1 := rf.OutputFrame(w1, f)
+
+				w2 := newWriter(nil, opts)
+				h := HeaderOf(f)
+				s := state{frameID: rf.vdata.frameTypes.LookupFrameID(h.FrameType)}
+				rf.outputFrame(w2, f, &s)
+				var err2 error
+				if w2.err != nil {
+					err2 = &EncodeError{Err: w2.err, FrameID: s.frameID, Field: s.field}
+				}
+
+				if fmt.Sprint(err1) != fmt.Sprint(err2) || (err1 == nil && (id1 != s.frameID || !bytes.Equal(w1.Bytes(), w2.Bytes()))) {
+					t.Errorf("v2.%d: policy %d: case %d: output mismatch:\n  generated %s %x %v\n  reflected %s %x %v\n",
+						v, policy, i, id1, w1.Bytes(), err1, s.frameID, w2.Bytes(), err2)
+					continue
+				}
+				if err1 != nil {
+					continue
+				}
+
+				// The generated scan method must match the reflector,
+				// including for truncated frames.
+				typ := rf.vdata.frameTypes.LookupReflectType(id1)
+				data := w1.Bytes()
+				for n := 0; n <= len(data); n++ {
+					r1 := newReader(nil, &DecodeOptions{})
+					r1.ReplaceBuffer(data[:n])
+					f1, err1 := rf.ScanFrame(r1, id1)
+
+					r2 := newReader(nil, &DecodeOptions{})
+					r2.ReplaceBuffer(data[:n])
+					s := state{frameID: id1}
+					f2 := rf.scanFrame(r2, typ, &s)
+					var err2 error
+					if r2.err != nil {
+						f2, err2 = nil, &DecodeError{Err: r2.err, FrameID: id1, Field: s.field}
+					}
+
+					if fmt.Sprint(err1) != fmt.Sprint(err2) || !reflect.DeepEqual(f1, f2) {
+						t.Errorf("v2.%d: policy %d: case %d: scan mismatch of %x:\n  generated %+v %v\n  reflected %+v %v\n",
+							v, policy, i, data[:n], f1, err1, f2, err2)
+					}
+				}
+			}
+		}
+	}
+}
+
+// benchmarkFrames returns the frames used by benchmarks, encoded as v2.4
+// frame payloads.
+func benchmarkFrames() (rf *reflector, ids []string, payloads [][]byte) {
+	rf = newReflector(Version2_4, versionDataOf(Version2_4))
+	for _, f := range generatedTestFrames() {
+		w := newWriter(nil, &EncodeOptions{MultiValueSeparator: "/"})
+		id, err := rf.OutputFrame(w, f)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+		payloads = append(payloads, w.Bytes())
+	}
+	return rf, ids, payloads
+}
+
+func BenchmarkScanFrame(b *testing.B) {
+	rf, ids, payloads := benchmarkFrames()
+	opts := &DecodeOptions{}
+
+	b.Run("generated", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for j, id := range ids {
+				r := newReader(nil, opts)
+				r.ReplaceBuffer(payloads[j])
+				rf.ScanFrame(r, id)
+			}
+		}
+	})
+
+	b.Run("reflect", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for j, id := range ids {
+				r := newReader(nil, opts)
+				r.ReplaceBuffer(payloads[j])
+				s := state{frameID: id}
+				rf.scanFrame(r, rf.vdata.frameTypes.LookupReflectType(id), &s)
+			}
+		}
+	})
+}
+
+func BenchmarkOutputFrame(b *testing.B) {
+	rf := newReflector(Version2_4, versionDataOf(Version2_4))
+	frames := generatedTestFrames()
+	opts := &EncodeOptions{MultiValueSeparator: "/"}
+
+	b.Run("generated", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, f := range frames {
+				w := newWriter(nil, opts)
+				rf.OutputFrame(w, f)
+			}
+		}
+	})
+
+	b.Run("reflect", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, f := range frames {
+				w := newWriter(nil, opts)
+				s := state{frameID: rf.vdata.frameTypes.LookupFrameID(HeaderOf(f).FrameType)}
+				rf.outputFrame(w, f, &s)
+			}
+		}
+	})
+}
@@ -0,0 +1,674 @@
+// Framegen generates the scan and output methods of the id3 package's
+// frame types, so that standard frames are decoded and encoded without
+// reflection. It reads the frame struct definitions from the package's
+// source files and applies the same rules the package's reflector applies
+// at run time. It is run by go generate from the package's directory:
+//
+//	go run ./internal/framegen
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var output = flag.String("output", "frame_gen.go", "name of the generated file")
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("framegen: ")
+	flag.Parse()
+
+	p, err := loadPackage(".")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	frames, err := p.frames()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	src, err := generate(p.name, frames)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*output, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// A pkg holds the type declarations of the package being generated.
+type pkg struct {
+	name  string
+	fset  *token.FileSet
+	types map[string]*ast.TypeSpec
+	order []*ast.TypeSpec // type declarations in source order
+}
+
+// loadPackage parses the non-test source files of the package in dir,
+// other than the generated file.
+func loadPackage(dir string) (*pkg, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	p := &pkg{fset: token.NewFileSet(), types: make(map[string]*ast.TypeSpec)}
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") || filepath.Base(file) == *output {
+			continue
+		}
+
+		f, err := parser.ParseFile(p.fset, file, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		p.name = f.Name.Name
+
+		for _, decl := range f.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				ts := spec.(*ast.TypeSpec)
+				p.types[ts.Name.Name] = ts
+				p.order = append(p.order, ts)
+			}
+		}
+	}
+	if p.name == "" {
+		return nil, fmt.Errorf("no source files found in %s", dir)
+	}
+	return p, nil
+}
+
+// Field kinds, named after the reflect.Kind of the field's type, or of
+// its elements for slices.
+const (
+	kindUint8 = iota
+	kindUint16
+	kindUint32
+	kindUint64
+	kindString
+	kindHeader
+	kindBytes
+	kindUint32s
+	kindStrings
+	kindStructs
+)
+
+// A field describes a field of a frame struct, or of a struct held in
+// one of a frame's slices.
+type field struct {
+	name    string
+	typ     string // type as written in the struct definition
+	kind    int
+	western bool       // string of type WesternString
+	elem    *structDef // element type of a slice of structs
+}
+
+// A structDef describes a frame struct, or a struct held in one of a
+// frame's slices.
+type structDef struct {
+	name   string
+	fields []field
+}
+
+// field returns the named field of the struct, or nil if it has none.
+func (s *structDef) field(name string) *field {
+	for i := range s.fields {
+		if s.fields[i].name == name {
+			return &s.fields[i]
+		}
+	}
+	return nil
+}
+
+// frames returns the frame structs of the package, which are the exported
+// structs starting with an exported FrameHeader field.
+func (p *pkg) frames() ([]*structDef, error) {
+	var frames []*structDef
+	for _, ts := range p.order {
+		st, ok := ts.Type.(*ast.StructType)
+		if !ok || !ts.Name.IsExported() || len(st.Fields.List) == 0 {
+			continue
+		}
+		first := st.Fields.List[0]
+		if id, ok := first.Type.(*ast.Ident); !ok || id.Name != "FrameHeader" ||
+			len(first.Names) == 0 || !first.Names[0].IsExported() {
+			continue
+		}
+
+		s, err := p.structDef(ts.Name.Name, st)
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, s)
+	}
+	return frames, nil
+}
+
+func (p *pkg) structDef(name string, st *ast.StructType) (*structDef, error) {
+	s := &structDef{name: name}
+	for _, f := range st.Fields.List {
+		if len(f.Names) == 0 {
+			return nil, p.errorf(f.Pos(), "%s: embedded fields are not supported", name)
+		}
+		for _, n := range f.Names {
+			if !n.IsExported() {
+				return nil, p.errorf(n.Pos(), "%s.%s: unexported fields are not supported", name, n.Name)
+			}
+			fd, err := p.field(name, n.Name, f.Type)
+			if err != nil {
+				return nil, err
+			}
+			s.fields = append(s.fields, fd)
+		}
+	}
+	return s, nil
+}
+
+func (p *pkg) field(parent, name string, expr ast.Expr) (field, error) {
+	f := field{name: name, typ: p.exprString(expr)}
+	if f.typ == "FrameHeader" {
+		f.kind = kindHeader
+		return f, nil
+	}
+	f.western = f.typ == "WesternString"
+
+	switch t := p.underlying(expr).(type) {
+	case *ast.Ident:
+		switch t.Name {
+		case "uint8", "byte":
+			f.kind = kindUint8
+		case "uint16":
+			f.kind = kindUint16
+		case "uint32":
+			f.kind = kindUint32
+		case "uint64":
+			f.kind = kindUint64
+		case "string":
+			f.kind = kindString
+		default:
+			return f, p.errorf(expr.Pos(), "%s.%s: unsupported type %s", parent, name, f.typ)
+		}
+
+	case *ast.ArrayType:
+		if t.Len != nil {
+			return f, p.errorf(expr.Pos(), "%s.%s: arrays are not supported", parent, name)
+		}
+		switch e := p.underlying(t.Elt).(type) {
+		case *ast.Ident:
+			switch {
+			case (e.Name == "uint8" || e.Name == "byte") && p.isBuiltin(t.Elt):
+				f.kind = kindBytes
+			case e.Name == "uint32" && p.isBuiltin(t.Elt):
+				f.kind = kindUint32s
+			case e.Name == "string" && p.isBuiltin(t.Elt):
+				f.kind = kindStrings
+			default:
+				return f, p.errorf(expr.Pos(), "%s.%s: unsupported type %s", parent, name, f.typ)
+			}
+		case *ast.StructType:
+			elem, err := p.structDef(p.exprString(t.Elt), e)
+			if err != nil {
+				return f, err
+			}
+			f.kind = kindStructs
+			f.elem = elem
+		default:
+			return f, p.errorf(expr.Pos(), "%s.%s: unsupported type %s", parent, name, f.typ)
+		}
+
+	default:
+		return f, p.errorf(expr.Pos(), "%s.%s: unsupported type %s", parent, name, f.typ)
+	}
+	return f, nil
+}
+
+// underlying resolves a type expression declared in the package to its
+// underlying type expression.
+func (p *pkg) underlying(expr ast.Expr) ast.Expr {
+	for {
+		id, ok := expr.(*ast.Ident)
+		if !ok {
+			return expr
+		}
+		ts, ok := p.types[id.Name]
+		if !ok {
+			return expr
+		}
+		expr = ts.Type
+	}
+}
+
+// isBuiltin returns true if a type expression names a predeclared type.
+func (p *pkg) isBuiltin(expr ast.Expr) bool {
+	id, ok := expr.(*ast.Ident)
+	return ok && p.types[id.Name] == nil
+}
+
+func (p *pkg) exprString(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.ArrayType:
+		return "[]" + p.exprString(t.Elt)
+	case *ast.StarExpr:
+		return "*" + p.exprString(t.X)
+	case *ast.SelectorExpr:
+		return p.exprString(t.X) + "." + t.Sel.Name
+	default:
+		return fmt.Sprintf("%T", expr)
+	}
+}
+
+func (p *pkg) errorf(pos token.Pos, format string, args ...interface{}) error {
+	return fmt.Errorf("%s: %s", p.fset.Position(pos), fmt.Sprintf(format, args...))
+}
+
+// A generator accumulates the generated source.
+type generator struct {
+	buf     bytes.Buffer
+	strconv bool // the generated source uses package strconv
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+// generate returns the formatted source of the generated file.
+func generate(pkgName string, frames []*structDef) ([]byte, error) {
+	var g generator
+	for _, f := range frames {
+		if err := g.frame(f); err != nil {
+			return nil, err
+		}
+	}
+	g.registry(frames)
+
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "// Code generated by framegen; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&src, "package %s\n\n", pkgName)
+	fmt.Fprintf(&src, "import (\n\t\"reflect\"\n")
+	if g.strconv {
+		fmt.Fprintf(&src, "\t\"strconv\"\n")
+	}
+	fmt.Fprintf(&src, ")\n")
+	src.Write(g.buf.Bytes())
+
+	out, err := format.Source(src.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated source: %v", err)
+	}
+	return out, nil
+}
+
+// A scope describes the struct whose fields are being generated: either
+// the frame itself or an element of one of its slices.
+type scope struct {
+	frame  *structDef
+	def    *structDef
+	v      string // variable holding the struct
+	prefix string // variable holding the field name prefix, if nested
+	depth  int
+}
+
+func (s scope) root() bool {
+	return s.prefix == ""
+}
+
+// fieldName returns an expression naming a field, as reported in errors.
+func (s scope) fieldName(name string) string {
+	if s.root() {
+		return fmt.Sprintf("%q", name)
+	}
+	return fmt.Sprintf("%s + %q", s.prefix, name)
+}
+
+// encoding returns an expression holding the frame's text encoding, or an
+// error if the frame has no Encoding field.
+func (s scope) encoding(name string) (string, error) {
+	if !hasEncoding(s.frame) {
+		return "", fmt.Errorf("%s.%s: text field in a frame without an Encoding field", s.def.name, name)
+	}
+	return convert(&field{typ: "Encoding"}, s.frame.field("Encoding").typ, "f.Encoding"), nil
+}
+
+// hasEncoding returns true if the frame struct has an Encoding field.
+func hasEncoding(frame *structDef) bool {
+	e := frame.field("Encoding")
+	return e != nil && e.kind <= kindUint64
+}
+
+func (g *generator) frame(f *structDef) error {
+	top := scope{frame: f, def: f, v: "f"}
+
+	g.printf("\nfunc (f *%s) header() *FrameHeader {\n", f.name)
+	g.printf("if f == nil {\nreturn nil\n}\n")
+	g.printf("return &f.%s\n}\n", f.fields[0].name)
+
+	g.printf("\nfunc (f *%s) scan(r *reader, rf *reflector, state *state) {\n", f.name)
+	if err := g.scanFields(top); err != nil {
+		return err
+	}
+	g.printf("}\n")
+
+	g.printf("\nfunc (f *%s) output(w *writer, rf *reflector, state *state) {\n", f.name)
+	if hasEncoding(f) {
+		enc, _ := top.encoding("Encoding")
+		g.printf("rf.selectOutputEncoding(w, %s, f.textIsLatin1, state)\n\n", enc)
+	}
+	if err := g.outputFields(top); err != nil {
+		return err
+	}
+	g.printf("}\n")
+
+	if hasEncoding(f) {
+		g.printf("\nfunc (f *%s) textIsLatin1() bool {\n", f.name)
+		g.textIsLatin1(top)
+		g.printf("return true\n}\n")
+	}
+	return nil
+}
+
+// convert returns an expression converting expr, of type from, to the
+// type of field f.
+func convert(f *field, from, expr string) string {
+	if f.typ == from {
+		return expr
+	}
+	return fmt.Sprintf("%s(%s)", f.typ, expr)
+}
+
+func (g *generator) scanFields(s scope) error {
+	last := len(s.def.fields) - 1
+	for i := range s.def.fields {
+		f := &s.def.fields[i]
+		if f.kind == kindHeader {
+			continue
+		}
+
+		if i > 1 || !s.root() && i > 0 {
+			g.printf("\n")
+		}
+		dst := s.v + "." + f.name
+		g.printf("state.field = %s\n", s.fieldName(f.name))
+
+		switch f.kind {
+		case kindUint8:
+			g.printf("%s = %s\n", dst, convert(f, "uint8", fmt.Sprintf("rf.readUint8(r, %q)", f.name)))
+
+		case kindUint16:
+			if f.name == "BPM" {
+				g.printf("%s = %s\n", dst, convert(f, "uint16", "readBPM(r)"))
+			} else {
+				g.printf("%s = %s\n", dst, convert(f, "uint16", "readUint16(r)"))
+			}
+
+		case kindUint32:
+			g.printf("%s = %s\n", dst, convert(f, "uint32", "r.ConsumeUint32()"))
+
+		case kindUint64:
+			if f.name != "Counter" {
+				return fmt.Errorf("%s.%s: uint64 fields must be named Counter", s.def.name, f.name)
+			}
+			g.printf("%s = %s\n", dst, convert(f, "uint64", "readCounter(r)"))
+
+		case kindBytes:
+			g.printf("%s = %s\n", dst, convert(f, "[]byte", "r.ConsumeAll()"))
+
+		case kindUint32s:
+			length, bits, err := indexFields(s, f)
+			if err != nil {
+				return err
+			}
+			g.printf("%s = %s\n", dst, convert(f, "[]uint32",
+				fmt.Sprintf("rf.readIndexOffsets(r, uint32(%s), uint32(%s))", length, bits)))
+
+		case kindStrings:
+			enc, err := s.encoding(f.name)
+			if err != nil {
+				return err
+			}
+			g.printf("%s = %s\n", dst, convert(f, "[]string", fmt.Sprintf("rf.readStrings(r, %s, state)", enc)))
+
+		case kindString:
+			switch {
+			case f.name == "FrameID":
+				g.printf("%s = %s\n", dst, convert(f, "string", "state.frameID"))
+			case f.name == "Language":
+				g.printf("%s = %s\n", dst, convert(f, "string", "r.ConsumeFixedLengthString(3, EncodingISO88591)"))
+			case f.western:
+				g.printf("%s = %s\n", dst, convert(f, "string", "readWesternString(r)"))
+			default:
+				enc, err := s.encoding(f.name)
+				if err != nil {
+					return err
+				}
+				g.printf("%s = %s\n", dst, convert(f, "string", fmt.Sprintf("readString(r, %s)", enc)))
+			}
+
+		case kindStructs:
+			if err := g.scanStructs(s, f); err != nil {
+				return err
+			}
+		}
+		if !s.root() || i != last {
+			g.printf("if r.err != nil {\nreturn\n}\n")
+		}
+	}
+	return nil
+}
+
+// scanStructs generates a loop scanning the elements of a slice of
+// structs until the frame is exhausted.
+func (g *generator) scanStructs(s scope, f *field) error {
+	g.strconv = true
+	e := scope{frame: s.frame, def: f.elem, v: fmt.Sprintf("e%d", s.depth), prefix: fmt.Sprintf("p%d", s.depth), depth: s.depth + 1}
+	i := fmt.Sprintf("i%d", s.depth)
+	n := fmt.Sprintf("n%d", s.depth)
+
+	g.printf("%s.%s = make(%s, 0)\n", s.v, f.name, f.typ)
+	g.printf("for %s := 0; r.Len() > 0; %s++ {\n", i, i)
+	g.printf("if r.err = checkLimit(\"MaxEntries\", r.limits().MaxEntries, %s+1); r.err != nil {\nreturn\n}\n\n", i)
+	g.printf("%s := r.Len()\n", n)
+	g.printf("%s := %s\n", e.prefix, prefixExpr(s, f, i))
+	g.printf("var %s %s\n", e.v, f.elem.name)
+	if err := g.scanFields(e); err != nil {
+		return err
+	}
+	g.printf("\n// An element that consumes no data would repeat forever.\n")
+	g.printf("if r.Len() == %s {\nr.err = ErrInvalidPayloadDef\nreturn\n}\n\n", n)
+	g.printf("%s.%s = append(%s.%s, %s)\n", s.v, f.name, s.v, f.name, e.v)
+	g.printf("}\n")
+	return nil
+}
+
+// prefixExpr returns an expression naming an element of a slice of
+// structs, as the prefix of the names of its fields.
+func prefixExpr(s scope, f *field, i string) string {
+	expr := fmt.Sprintf("%q + strconv.Itoa(%s) + \"].\"", f.name+"[", i)
+	if !s.root() {
+		expr = s.prefix + " + " + expr
+	}
+	return expr
+}
+
+// indexFields returns the expressions holding the length and bits of an
+// audio seek point index, whose offsets are stored in field f.
+func indexFields(s scope, f *field) (length, bits string, err error) {
+	l, b := s.frame.field("IndexedDataLength"), s.frame.field("BitsPerIndex")
+	if f.name != "IndexOffsets" || l == nil || b == nil || l.kind > kindUint64 || b.kind > kindUint64 {
+		return "", "", fmt.Errorf("%s.%s: unsupported []uint32 field", s.def.name, f.name)
+	}
+	return "f.IndexedDataLength", "f.BitsPerIndex", nil
+}
+
+func (g *generator) outputFields(s scope) error {
+	last := len(s.def.fields) - 1
+	for i := range s.def.fields {
+		f := &s.def.fields[i]
+		if f.kind == kindHeader {
+			continue
+		}
+
+		if i > 1 || !s.root() && i > 0 {
+			g.printf("\n")
+		}
+		src := s.v + "." + f.name
+		g.printf("state.field = %s\n", s.fieldName(f.name))
+
+		switch f.kind {
+		case kindUint8:
+			if f.name == "Encoding" && s.root() {
+				g.printf("rf.writeUint8(w, %q, uint8(state.encoding))\n", f.name)
+			} else {
+				g.printf("rf.writeUint8(w, %q, %s)\n", f.name, convert(&field{typ: "uint8"}, f.typ, src))
+			}
+
+		case kindUint16:
+			if f.name == "BPM" {
+				g.printf("writeBPM(w, %s)\n", convert(&field{typ: "uint16"}, f.typ, src))
+			} else {
+				g.printf("writeUint16(w, %s)\n", convert(&field{typ: "uint16"}, f.typ, src))
+			}
+
+		case kindUint32:
+			g.printf("writeUint32(w, %s)\n", convert(&field{typ: "uint32"}, f.typ, src))
+
+		case kindUint64:
+			if f.name != "Counter" {
+				return fmt.Errorf("%s.%s: uint64 fields must be named Counter", s.def.name, f.name)
+			}
+			g.printf("writeCounter(w, %s)\n", convert(&field{typ: "uint64"}, f.typ, src))
+
+		case kindBytes:
+			g.printf("w.StoreBytes(%s)\n", convert(&field{typ: "[]byte"}, f.typ, src))
+
+		case kindUint32s:
+			length, bits, err := indexFields(s, f)
+			if err != nil {
+				return err
+			}
+			g.printf("rf.writeIndexOffsets(w, %s, uint32(%s), uint32(%s))\n",
+				convert(&field{typ: "[]uint32"}, f.typ, src), length, bits)
+
+		case kindStrings:
+			if _, err := s.encoding(f.name); err != nil {
+				return err
+			}
+			g.printf("rf.writeStrings(w, %s, state)\n", convert(&field{typ: "[]string"}, f.typ, src))
+
+		case kindString:
+			// Always terminate strings unless they are the last struct
+			// field of the root level struct.
+			term := !s.root() || i != last
+			str := convert(&field{typ: "string"}, f.typ, src)
+			switch {
+			case f.name == "FrameID":
+				g.printf("state.frameID = %s\n", str)
+			case f.name == "Language":
+				g.printf("w.StoreFixedLengthString(%s, 3, EncodingISO88591)\n", str)
+			case f.western:
+				g.printf("rf.writeWesternString(w, %s, %t, state)\n", str, term)
+			default:
+				if _, err := s.encoding(f.name); err != nil {
+					return err
+				}
+				g.printf("rf.writeString(w, %s, %t, state)\n", str, term)
+			}
+
+		case kindStructs:
+			g.strconv = true
+			e := scope{frame: s.frame, def: f.elem, v: fmt.Sprintf("e%d", s.depth), prefix: fmt.Sprintf("p%d", s.depth), depth: s.depth + 1}
+			idx := fmt.Sprintf("i%d", s.depth)
+			g.printf("for %s := range %s {\n", idx, src)
+			g.printf("%s := &%s[%s]\n", e.v, src, idx)
+			g.printf("%s := %s\n", e.prefix, prefixExpr(s, f, idx))
+			if err := g.outputFields(e); err != nil {
+				return err
+			}
+			g.printf("}\n")
+		}
+		if !s.root() || i != last {
+			g.printf("if w.err != nil {\nreturn\n}\n")
+		}
+	}
+	return nil
+}
+
+// textIsLatin1 generates the checks of the frame's encoded text fields
+// for characters outside the ISO-8859-1 range.
+func (g *generator) textIsLatin1(s scope) {
+	for i := range s.def.fields {
+		f := &s.def.fields[i]
+		src := s.v + "." + f.name
+
+		switch {
+		case f.kind == kindString && !f.western && f.name != "FrameID" && f.name != "Language":
+			g.printf("if !isLatin1(%s) {\nreturn false\n}\n", convert(&field{typ: "string"}, f.typ, src))
+
+		case f.kind == kindStrings:
+			g.printf("for _, s := range %s {\nif !isLatin1(s) {\nreturn false\n}\n}\n", src)
+
+		case f.kind == kindStructs && hasText(f.elem):
+			e := scope{frame: s.frame, def: f.elem, v: fmt.Sprintf("e%d", s.depth), prefix: "-", depth: s.depth + 1}
+			idx := fmt.Sprintf("i%d", s.depth)
+			g.printf("for %s := range %s {\n", idx, src)
+			g.printf("%s := &%s[%s]\n", e.v, src, idx)
+			g.textIsLatin1(e)
+			g.printf("}\n")
+		}
+	}
+}
+
+// hasText returns true if a struct has encoded text fields.
+func hasText(def *structDef) bool {
+	for i := range def.fields {
+		f := &def.fields[i]
+		switch {
+		case f.kind == kindString && !f.western && f.name != "FrameID" && f.name != "Language":
+			return true
+		case f.kind == kindStrings:
+			return true
+		case f.kind == kindStructs && hasText(f.elem):
+			return true
+		}
+	}
+	return false
+}
+
+// registry generates the lookup of the frame types having generated
+// methods.
+func (g *generator) registry(frames []*structDef) {
+	g.printf("\n// generatedFrames holds a constructor for each frame type with generated\n")
+	g.printf("// scan and output methods.\n")
+	g.printf("var generatedFrames = map[reflect.Type]func() generatedFrame{\n")
+	for _, f := range frames {
+		g.printf("reflect.TypeOf(%s{}): func() generatedFrame { return new(%s) },\n", f.name, f.name)
+	}
+	g.printf("}\n")
+
+	g.printf("\n// asGeneratedFrame returns f if its type has generated scan and output\n")
+	g.printf("// methods, or nil otherwise.\n")
+	g.printf("func asGeneratedFrame(f Frame) generatedFrame {\n")
+	g.printf("switch f := f.(type) {\n")
+	for _, f := range frames {
+		g.printf("case *%s:\nreturn f\n", f.name)
+	}
+	g.printf("}\nreturn nil\n}\n")
+}
@@ -0,0 +1,193 @@
+package id3
+
+import "io"
+
+// decodeFrames decodes a tag's frames until the tag data is exhausted or
+// padding is encountered. The decode function decodes a single frame
+// using the version-specific codec. exSize is the size of the tag's
+// extended header, or zero if it has none.
+//
+// In lenient mode, problems that would otherwise abort decoding are
+// recorded as warnings on the tag instead: non-zero padding is accepted,
+// a tag whose header size excludes its extended header is extended, and
+// decoding stops at the first frame that can't be located.
+func decodeFrames(t *Tag, r *reader, exSize int, decode func(t *Tag, f *Frame, r *reader) error) error {
+	// Track frame offsets relative to the start of the tag header.
+	base := 10 + t.Size - r.Len()
+	start := r.Len()
+
+	extended := false
+	for r.Len() > 0 {
+		rest := r.Bytes()
+		offset := base + start - len(rest)
+		warnings := len(t.Warnings)
+
+		var f Frame
+		err := decode(t, &f, r)
+
+		// Add the frame's location to any warnings it produced.
+		for _, w := range t.Warnings[warnings:] {
+			if de, ok := w.(*DecodeError); ok {
+				de.Offset, de.Version = offset, t.Version
+			}
+		}
+
+		if err == errPaddingEncountered {
+			if r.lenient() && !isZero(rest) {
+				t.warn(&DecodeError{Err: ErrInvalidPadding, Offset: offset, Version: t.Version})
+			}
+			t.Padding = len(rest)
+			r.ConsumeAll()
+			break
+		}
+
+		// Some encoders exclude the extended header from the tag size,
+		// truncating the last frame. Load the missing bytes and retry.
+		truncated := err == ErrIncompleteFrame || err == io.ErrUnexpectedEOF
+		if truncated && r.lenient() && exSize > 0 && !extended {
+			extended = true
+			r.ReplaceBuffer(rest)
+			r.err = nil
+			if r.Load(exSize); r.err == nil {
+				t.Size += exSize
+				t.warn(ErrInvalidTagSize)
+				continue
+			}
+			r.ReplaceBuffer(rest[:len(rest):len(rest)])
+			r.err = nil
+		}
+
+		if err != nil {
+			var id string
+			if len(rest) >= 4 && validFrameID(rest[:4]) {
+				id = string(rest[:4])
+			}
+			de := frameDecodeError(err, id)
+			de.Offset, de.Version = offset, t.Version
+			if !r.lenient() || isLimitError(err) {
+				// Errors outside of an identifiable frame are returned
+				// as is.
+				if de.FrameID == "" {
+					return err
+				}
+				return de
+			}
+			t.warn(de)
+			r.err = nil
+			r.ConsumeAll()
+			break
+		}
+
+		if err := checkLimit("MaxFrames", r.limits().MaxFrames, len(t.Frames)+1); err != nil {
+			return err
+		}
+		t.Frames = append(t.Frames, f)
+	}
+
+	return nil
+}
+
+// unknownFrame creates a frame of unknown type holding the raw payload of
+// a frame that couldn't be decoded. It is used in lenient mode so that the
+// frame is preserved when the tag is re-encoded.
+func unknownFrame(h FrameHeader, data []byte) *FrameUnknown {
+	h.FrameType = FrameTypeUnknown
+	return &FrameUnknown{
+		Header:  h,
+		FrameID: h.FrameID,
+		Data:    append([]byte{}, data...),
+	}
+}
+
+// frameSize decodes the payload size stored in the size field b of a v2.3
+// or v2.4 frame header. It is shared by every decoder that locates frames
+// within a tag. The at function returns up to n bytes of the tag starting
+// off bytes past the end of the frame header, and fewer at the end of the
+// tag. It is used only for v2.4 frames in lenient mode.
+//
+// Some encoders (notably older versions of iTunes) incorrectly store v2.4
+// frame sizes as plain integers, so in lenient mode the plain
+// interpretation is used if only it locates the next frame. The returned
+// plain flag reports when it is.
+func frameSize(v Version, b []byte, lenient bool, at func(off, n int) []byte) (size int, plain bool, err error) {
+	var n uint32
+	if v == Version2_3 {
+		n, err = decodeUint32(b)
+	} else {
+		n, err = decodeSyncSafeUint32(b)
+		if lenient {
+			p, _ := decodeUint32(b)
+			if (err != nil || !frameEndIsValid(int(n), at)) && frameEndIsValid(int(p), at) {
+				n, err, plain = p, nil, true
+			}
+		}
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	if n < 1 {
+		return 0, false, ErrInvalidFrameHeader
+	}
+	return int(n), plain, nil
+}
+
+// frameEndIsValid returns true if a frame of the requested size is
+// followed by the end of the tag, padding, or another frame header. The
+// at function returns the bytes following the frame's header, as for
+// frameSize.
+func frameEndIsValid(size int, at func(off, n int) []byte) bool {
+	if size < 1 {
+		return false
+	}
+
+	// Examine the last byte of the frame and the 4 bytes after it.
+	b := at(size-1, 5)
+	switch {
+	case len(b) == 0:
+		return false
+	case len(b) == 1 || b[1] == 0:
+		return true
+	case len(b) == 5:
+		return validFrameID(b[1:])
+	default:
+		return false
+	}
+}
+
+// window returns up to n bytes of b starting at offset off.
+func window(b []byte, off, n int) []byte {
+	if off < 0 || off >= len(b) {
+		return nil
+	}
+	if n > len(b)-off {
+		n = len(b) - off
+	}
+	return b[off : off+n]
+}
+
+// validFrameID returns true if id consists only of uppercase letters,
+// digits, and (as written by some v2.2 to v2.3 converters) spaces.
+func validFrameID(id []byte) bool {
+	for _, c := range id {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') && c != ' ' {
+			return false
+		}
+	}
+	return true
+}
+
+// isZero returns true if all bytes in b are zero.
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// warn records a problem encountered while decoding the tag in lenient
+// mode.
+func (t *Tag) warn(err error) {
+	t.Warnings = append(t.Warnings, err)
+}
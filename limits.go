@@ -0,0 +1,96 @@
+package id3
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io"
+)
+
+// DecodeLimits bound the resources used to decode a tag, so that hostile
+// or corrupt files can't exhaust memory. A limit of zero is unlimited.
+// Exceeding a limit produces an error wrapping a LimitError, even in
+// lenient mode.
+type DecodeLimits struct {
+	MaxTagSize          int // Size of the tag in bytes, as claimed by its header
+	MaxFrameSize        int // Size of a frame's payload in bytes, as stored
+	MaxFrames           int // Number of frames in the tag
+	MaxStrings          int // Number of strings in a single frame field
+	MaxEntries          int // Number of entries (e.g., SYLT or ASPI) in a frame
+	MaxPictureSize      int // Size of an attached picture's data in bytes
+	MaxDecompressedSize int // Size of a compressed frame's payload once decompressed
+}
+
+// DefaultDecodeLimits are limits suitable for decoding untrusted files.
+// They accommodate large attached pictures and other binary objects while
+// bounding the memory used by a single tag.
+var DefaultDecodeLimits = DecodeLimits{
+	MaxTagSize:          64 << 20,
+	MaxFrameSize:        64 << 20,
+	MaxFrames:           10000,
+	MaxStrings:          10000,
+	MaxEntries:          100000,
+	MaxPictureSize:      64 << 20,
+	MaxDecompressedSize: 16 << 20,
+}
+
+// checkLimit returns a LimitError if value exceeds max, unless max is
+// zero. The name identifies the DecodeLimits field holding max.
+func checkLimit(name string, max, value int) error {
+	if max > 0 && value > max {
+		return &LimitError{Limit: name, Max: max}
+	}
+	return nil
+}
+
+// isLimitError returns true if err wraps a LimitError.
+func isLimitError(err error) bool {
+	var le *LimitError
+	return errors.As(err, &le)
+}
+
+// checkFrameLimits returns a LimitError if a decoded frame exceeds the
+// limits that apply to its contents.
+func checkFrameLimits(f Frame, l DecodeLimits) error {
+	if pic, ok := f.(*FrameAttachedPicture); ok {
+		return checkLimit("MaxPictureSize", l.MaxPictureSize, len(pic.Data))
+	}
+	return nil
+}
+
+// compress compresses the payload of a frame using zlib, as required by
+// the ID3v2.3 and v2.4 compression frame flag.
+func compress(b []byte) []byte {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(b)
+	zw.Close()
+	return buf.Bytes()
+}
+
+// decompress decompresses the zlib-compressed payload of a frame, whose
+// header claims it holds size bytes once decompressed. It returns a
+// LimitError if the decompressed payload would exceed max bytes.
+func decompress(b []byte, size uint32, max int) ([]byte, error) {
+	if max > 0 && int64(size) > int64(max) {
+		return nil, &LimitError{Limit: "MaxDecompressedSize", Max: max}
+	}
+
+	zr, err := zlib.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, ErrInvalidCompression
+	}
+	var lr io.Reader = zr
+	if max > 0 {
+		lr = io.LimitReader(zr, int64(max)+1)
+	}
+
+	out, err := io.ReadAll(lr)
+	if err != nil {
+		return nil, ErrInvalidCompression
+	}
+	if err := checkLimit("MaxDecompressedSize", max, len(out)); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
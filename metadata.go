@@ -0,0 +1,275 @@
+package id3
+
+import (
+	"strconv"
+)
+
+// Metadata holds the most commonly used tag fields as plain values. Use
+// Tag.Metadata to extract them from a tag and Tag.ApplyMetadata to store
+// them into a tag. Both select the frames appropriate for the tag's
+// version.
+type Metadata struct {
+	Title       string    // TIT2
+	Artists     []string  // TPE1
+	Album       string    // TALB
+	AlbumArtist string    // TPE2
+	Year        int       // TDRC (v2.4) or TYER (v2.3)
+	Track       int       // TRCK
+	TrackTotal  int       // TRCK
+	Disc        int       // TPOS
+	DiscTotal   int       // TPOS
+	Genres      []string  // TCON, normalized to canonical genre names
+	Comment     string    // COMM with an empty description
+	Lyrics      string    // USLT
+	Compilation *bool     // TCMP (iTunes), or nil if not present
+	BPM         int       // TBPM
+	Composer    string    // TCOM
+	Pictures    []Picture // APIC
+}
+
+// A Picture describes an image attached to a tag.
+type Picture struct {
+	MimeType    string
+	Type        PictureType
+	Description string
+	Data        []byte
+}
+
+// MetadataOptions control how Tag.ApplyMetadata stores metadata into a tag.
+type MetadataOptions struct {
+	// Language is the ISO-639-2 language code used when creating comment
+	// and lyrics frames. If empty, "eng" is used.
+	Language string
+
+	// NumberPadding selects how track and disc numbers are zero-padded.
+	NumberPadding NumberPadding
+
+	// RemoveEmpty causes empty (zero-valued) metadata fields to remove the
+	// corresponding frames from the tag. Otherwise, frames corresponding to
+	// empty fields are left untouched.
+	RemoveEmpty bool
+}
+
+// Metadata extracts the most commonly used fields from the tag.
+func (t *Tag) Metadata() *Metadata {
+	m := &Metadata{}
+
+	m.Title, _ = t.text(FrameTypeTextSongTitle)
+	m.Album, _ = t.text(FrameTypeTextAlbumName)
+	m.AlbumArtist, _ = t.text(FrameTypeTextAlbumArtist)
+	m.Composer, _ = t.text(FrameTypeTextComposer)
+
+	if ft := t.textFrame(FrameTypeTextArtist); ft != nil {
+		m.Artists = append([]string{}, ft.Text...)
+	}
+
+	if ts, ok := t.RecordingTime(); ok {
+		m.Year = ts.Year
+	}
+
+	m.Track, m.TrackTotal, _ = t.TrackNumber()
+	m.Disc, m.DiscTotal, _ = t.DiscNumber()
+
+	if ft := t.textFrame(FrameTypeTextGenre); ft != nil {
+		m.Genres = NormalizeGenres(ft.Text)
+	}
+
+	if f := t.comment(); f != nil {
+		m.Comment = f.Text
+	}
+
+	if f, ok := t.FindFrame(FrameTypeLyricsUnsync).(*FrameLyricsUnsync); ok {
+		m.Lyrics = f.Text
+	}
+
+	if s, ok := t.text(FrameTypeTextCompilationItunes); ok {
+		compilation := s == "1"
+		m.Compilation = &compilation
+	}
+
+	if s, ok := t.text(FrameTypeTextBPM); ok {
+		m.BPM, _, _ = parseNumber(s, skipSpaces(s, 0))
+	}
+
+	for _, f := range t.FindFrames(FrameTypeAttachedPicture) {
+		if p, ok := f.(*FrameAttachedPicture); ok {
+			m.Pictures = append(m.Pictures, Picture{
+				MimeType:    string(p.MimeType),
+				Type:        p.PictureType,
+				Description: p.Description,
+				Data:        p.Data,
+			})
+		}
+	}
+
+	return m
+}
+
+// ApplyMetadata stores metadata fields into the tag, adding, updating or
+// removing frames as necessary. Read-only frames are never modified; if a
+// field would modify one, ApplyMetadata stops and returns a ReadOnlyError.
+func (t *Tag) ApplyMetadata(m *Metadata, opts MetadataOptions) error {
+	lang := opts.Language
+	if lang == "" {
+		lang = "eng"
+	}
+
+	setString := func(typ FrameType, s string) error {
+		switch {
+		case s != "":
+			return t.setText(typ, s)
+		case opts.RemoveEmpty:
+			return t.setText(typ)
+		default:
+			return nil
+		}
+	}
+
+	for _, f := range []struct {
+		typ FrameType
+		s   string
+	}{
+		{FrameTypeTextSongTitle, m.Title},
+		{FrameTypeTextAlbumName, m.Album},
+		{FrameTypeTextAlbumArtist, m.AlbumArtist},
+		{FrameTypeTextComposer, m.Composer},
+	} {
+		if err := setString(f.typ, f.s); err != nil {
+			return err
+		}
+	}
+
+	if len(m.Artists) > 0 || opts.RemoveEmpty {
+		if err := t.setText(FrameTypeTextArtist, m.Artists...); err != nil {
+			return err
+		}
+	}
+
+	// Keep a more precise recording time if the year hasn't changed.
+	switch {
+	case m.Year != 0:
+		if ts, ok := t.RecordingTime(); !ok || ts.Year != m.Year {
+			err := t.SetRecordingTime(Timestamp{Year: m.Year, Precision: PrecisionYear})
+			if err != nil {
+				return err
+			}
+		}
+	case opts.RemoveEmpty:
+		if err := t.SetRecordingTime(Timestamp{}); err != nil {
+			return err
+		}
+	}
+
+	if m.Track != 0 || opts.RemoveEmpty {
+		err := t.SetTrackNumberPadded(m.Track, m.TrackTotal, opts.NumberPadding)
+		if err != nil {
+			return err
+		}
+	}
+
+	if m.Disc != 0 || opts.RemoveEmpty {
+		err := t.SetDiscNumberPadded(m.Disc, m.DiscTotal, opts.NumberPadding)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(m.Genres) > 0 || opts.RemoveEmpty {
+		err := t.setText(FrameTypeTextGenre, FormatGenres(t.Version, genresFromNames(t.Version, m.Genres))...)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch f := t.comment(); {
+	case m.Comment != "" && f != nil:
+		if err := checkWritable(f, nil); err != nil {
+			return err
+		}
+		f.Text = m.Comment
+	case m.Comment != "":
+		t.Frames = append(t.Frames, NewFrameComment(lang, "", m.Comment))
+	case opts.RemoveEmpty && f != nil:
+		if err := t.RemoveFrame(f); err != nil {
+			return err
+		}
+	}
+
+	switch f, _ := t.FindFrame(FrameTypeLyricsUnsync).(*FrameLyricsUnsync); {
+	case m.Lyrics != "" && f != nil:
+		if err := checkWritable(f, nil); err != nil {
+			return err
+		}
+		f.Text = m.Lyrics
+	case m.Lyrics != "":
+		t.Frames = append(t.Frames, NewFrameLyricsUnsync(lang, "", m.Lyrics))
+	case opts.RemoveEmpty:
+		if err := t.RemoveFrames(FrameTypeLyricsUnsync); err != nil {
+			return err
+		}
+	}
+
+	var compilation string
+	switch {
+	case m.Compilation == nil:
+	case *m.Compilation:
+		compilation = "1"
+	default:
+		compilation = "0"
+	}
+	if err := setString(FrameTypeTextCompilationItunes, compilation); err != nil {
+		return err
+	}
+
+	var bpm string
+	switch {
+	case m.BPM < 0:
+		return ErrInvalidBPM
+	case m.BPM != 0:
+		bpm = strconv.Itoa(m.BPM)
+	}
+	if err := setString(FrameTypeTextBPM, bpm); err != nil {
+		return err
+	}
+
+	if len(m.Pictures) > 0 || opts.RemoveEmpty {
+		if err := t.RemoveFrames(FrameTypeAttachedPicture); err != nil {
+			return err
+		}
+		for _, p := range m.Pictures {
+			f := NewFrameAttachedPicture(p.MimeType, p.Description, p.Type, p.Data)
+			t.Frames = append(t.Frames, f)
+		}
+	}
+
+	return nil
+}
+
+// comment returns the tag's general comment frame, which is the first
+// comment frame with an empty description. If there is no such frame,
+// it returns nil.
+func (t *Tag) comment() *FrameComment {
+	for _, f := range t.FindFrames(FrameTypeComment) {
+		if c, ok := f.(*FrameComment); ok && c.Description == "" {
+			return c
+		}
+	}
+	return nil
+}
+
+// genresFromNames converts genre names into genre entries suitable for the
+// requested version. For v2.4, names are stored as free text. For earlier
+// versions, known names are stored as numeric references with the
+// canonical name as a refinement, which is the most widely supported form.
+func genresFromNames(v Version, names []string) []Genre {
+	gg := make([]Genre, 0, len(names))
+	for _, name := range names {
+		id, ok := LookupGenre(name)
+		if ok && id >= 0 && v < Version2_4 {
+			gg = append(gg, Genre{ID: id, Name: GenreName(id)})
+			continue
+		}
+		gg = append(gg, Genre{ID: GenreNone, Name: name})
+	}
+	return gg
+}
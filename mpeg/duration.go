@@ -0,0 +1,159 @@
+package mpeg
+
+import (
+	"io"
+	"math"
+	"time"
+)
+
+// Info describes the audio stream of an MP3 file.
+type Info struct {
+	Header    Header        // Header of the first audio frame
+	Offset    int64         // Offset of the first audio frame
+	Size      int64         // Size of the audio data in bytes
+	Frames    int           // Number of audio frames, or zero if unknown
+	Bitrate   int           // Average bitrate in kbit/s
+	VBR       bool          // Frames have different bitrates
+	Duration  time.Duration // Duration of the audio
+	VBRHeader *VBRHeader    // Xing, Info or VBRI header, or nil if none
+}
+
+// Gapless returns the gapless playback information of the stream, as
+// recorded by the encoder in a LAME header. If the stream has no LAME
+// header or its number of frames is unknown, it returns false.
+func (info *Info) Gapless() (Gapless, bool) {
+	if info.VBRHeader == nil || info.VBRHeader.LAME == nil || info.Frames == 0 {
+		return Gapless{}, false
+	}
+
+	l := info.VBRHeader.LAME
+	g := Gapless{
+		Delay:   l.EncoderDelay + decoderDelay,
+		Padding: l.EncoderPadding - decoderDelay,
+		Samples: int64(info.Frames)*int64(info.Header.Samples()) - int64(l.EncoderDelay+l.EncoderPadding),
+	}
+	if g.Padding < 0 {
+		g.Padding = 0
+	}
+	return g, true
+}
+
+// Scan reads an entire audio stream, which may begin with ID3v2 tags, and
+// returns a description of it. The duration is calculated from every
+// frame of the stream, so it is accurate for both constant and variable
+// bitrate streams. A frame holding a Xing, Info or VBRI header is not
+// counted as audio. Scan returns ErrNoFrames if the stream holds no audio
+// frames.
+func Scan(r io.Reader) (*Info, error) {
+	s := NewScanner(r)
+
+	var info *Info
+	var samples, end int64
+	for s.Next() {
+		h := s.Header()
+		end = s.Offset() + int64(h.FrameSize())
+		if info == nil {
+			info = &Info{Header: h, Offset: s.Offset()}
+			if info.VBRHeader = vbrHeader(s); info.VBRHeader != nil {
+				continue
+			}
+		}
+		if info.Frames == 0 {
+			info.Header = h
+		} else if h.Bitrate != info.Header.Bitrate {
+			info.VBR = true
+		}
+		info.Frames++
+		samples += int64(h.Samples())
+	}
+	if s.Err() != nil {
+		return nil, s.Err()
+	}
+	if info == nil || info.Frames == 0 {
+		return nil, ErrNoFrames
+	}
+
+	info.Size = end - info.Offset
+	info.Duration = time.Duration(samples) * time.Second / time.Duration(info.Header.SampleRate)
+	info.Bitrate = bitrate(info.Size, info.Duration)
+	return info, nil
+}
+
+// Estimate quickly estimates the duration of an audio stream, which may
+// begin with ID3v2 tags, from its first frame. If the frame holds a Xing,
+// Info or VBRI header recording the number of frames, the duration is
+// exact. Otherwise, it is estimated from the size of the stream and the
+// bitrate of the first frame, which is accurate only for constant bitrate
+// streams; use Scan for other streams. An ID3v1 tag at the end of the
+// stream is excluded from the audio size. Estimate returns ErrNoFrames if
+// the stream holds no audio frames.
+func Estimate(r io.ReadSeeker) (*Info, error) {
+	start, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+
+	s := NewScanner(r)
+	if !s.Next() {
+		if s.Err() != nil {
+			return nil, s.Err()
+		}
+		return nil, ErrNoFrames
+	}
+	info := &Info{Header: s.Header(), Offset: s.Offset(), VBRHeader: vbrHeader(s)}
+
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if end-start-info.Offset >= 128+HeaderSize {
+		var b [3]byte
+		if _, err := r.Seek(end-128, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return nil, err
+		}
+		if string(b[:]) == "TAG" {
+			end -= 128
+		}
+	}
+
+	info.Size = end - start - info.Offset
+
+	if vh := info.VBRHeader; vh != nil && vh.Frames > 0 {
+		info.Frames = vh.Frames
+		info.VBR = vh.Type != VBRTypeInfo
+		samples := int64(vh.Frames) * int64(info.Header.Samples())
+		info.Duration = time.Duration(samples) * time.Second / time.Duration(info.Header.SampleRate)
+		info.Bitrate = bitrate(info.Size, info.Duration)
+		return info, nil
+	}
+
+	info.Bitrate = info.Header.Bitrate
+	info.Duration = time.Duration(float64(info.Size) * 8 / float64(info.Bitrate*1000) * float64(time.Second))
+	return info, nil
+}
+
+// vbrHeader returns the VBR header held by the scanner's current frame, or
+// nil if it holds none.
+func vbrHeader(s *Scanner) *VBRHeader {
+	frame, err := s.Frame()
+	if err != nil {
+		return nil
+	}
+	vh, err := ParseVBRHeader(frame)
+	if err != nil {
+		return nil
+	}
+	return vh
+}
+
+// bitrate returns the average bitrate in kbit/s of size bytes of audio
+// lasting d.
+func bitrate(size int64, d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(math.Round(float64(size) * 8 / d.Seconds() / 1000))
+}
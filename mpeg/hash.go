@@ -0,0 +1,313 @@
+package mpeg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash"
+	"io"
+	"strconv"
+
+	"github.com/beevik/id3"
+)
+
+// HashOptions control how AudioHashWithOptions hashes audio.
+type HashOptions struct {
+	// ExcludeVBRHeader excludes the frame holding a Xing, Info or VBRI
+	// header from the hash. Encoders and tag editors sometimes rewrite
+	// this frame (e.g., to update the LAME ReplayGain fields) without
+	// changing the audio.
+	ExcludeVBRHeader bool
+}
+
+// AudioHash writes the audio frames of an MP3 file into a hash, so that
+// the resulting sum identifies the file's audio content regardless of its
+// tags. ID3v2 tags at the start of the file (and the tags they point to
+// with SEEK frames), ID3v2.4 tags appended to the file, and Lyrics3, APE
+// and ID3v1 tags at the end of the file are all skipped, as is any other
+// data that isn't part of an audio frame. It returns ErrNoFrames if the
+// file holds no audio frames.
+func AudioHash(r io.ReadSeeker, h hash.Hash) error {
+	return AudioHashWithOptions(r, h, HashOptions{})
+}
+
+// AudioHashWithOptions writes the audio frames of an MP3 file into a hash
+// using the requested options. See AudioHash.
+func AudioHashWithOptions(r io.ReadSeeker, h hash.Hash, opts HashOptions) error {
+	ra := &readerAt{r: r}
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	start, skip, err := leadingTags(ra, size)
+	if err != nil {
+		return err
+	}
+	end, err := trailingTags(ra, start, size)
+	if err != nil {
+		return err
+	}
+
+	// Read the audio between the tags, excluding tags located with SEEK
+	// frames.
+	var sections []io.Reader
+	pos := start
+	for _, s := range skip {
+		if s.start >= end {
+			break
+		}
+		if s.start > pos {
+			sections = append(sections, io.NewSectionReader(ra, pos, s.start-pos))
+		}
+		if s.end > pos {
+			pos = s.end
+		}
+	}
+	if end > pos {
+		sections = append(sections, io.NewSectionReader(ra, pos, end-pos))
+	}
+
+	s := NewScanner(io.MultiReader(sections...))
+	frames := 0
+	for s.Next() {
+		b, err := s.Frame()
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		if frames == 0 && opts.ExcludeVBRHeader {
+			if _, err := ParseVBRHeader(b); err == nil {
+				frames++
+				continue
+			}
+		}
+		h.Write(b)
+		frames++
+	}
+	if s.Err() != nil {
+		return s.Err()
+	}
+	if frames == 0 {
+		return ErrNoFrames
+	}
+	return nil
+}
+
+// A region is a range of bytes within a file.
+type region struct {
+	start, end int64
+}
+
+// leadingTags returns the offset of the first byte following the ID3v2
+// tags at the start of a file, along with the regions of any tags located
+// later in the file by SEEK frames, in order of their offsets.
+func leadingTags(r io.ReaderAt, size int64) (int64, []region, error) {
+	var pos int64
+	var skip []region
+	for {
+		n, err := tagSizeAt(r, pos)
+		if err != nil {
+			return 0, nil, err
+		}
+		if n == 0 {
+			break
+		}
+		pos += n
+		skip = seekChain(r, pos-n, size, skip)
+	}
+	return pos, skip, nil
+}
+
+// seekChain follows the SEEK frames of the tag at offset pos, adding the
+// regions of the tags they locate to skip.
+func seekChain(r io.ReaderAt, pos, size int64, skip []region) []region {
+	for {
+		n, err := tagSizeAt(r, pos)
+		if err != nil || n == 0 {
+			return skip
+		}
+
+		tag := new(id3.Tag)
+		_, err = tag.ReadFromWithOptions(io.NewSectionReader(r, pos, n), id3.DecodeOptions{Lenient: true})
+		if err != nil {
+			return skip
+		}
+		offset := int64(-1)
+		for _, f := range tag.Frames {
+			if u, ok := f.(*id3.FrameUnknown); ok && u.FrameID == "SEEK" && len(u.Data) >= 4 {
+				offset = int64(binary.BigEndian.Uint32(u.Data))
+			}
+		}
+		if offset < 0 {
+			return skip
+		}
+
+		// The SEEK frame holds the minimum offset of the next tag from
+		// the end of this one.
+		next := findTag(r, pos+n+offset, size)
+		if next < 0 {
+			return skip
+		}
+		n, _ = tagSizeAt(r, next)
+		skip = insertRegion(skip, region{next, next + n})
+		pos = next
+	}
+}
+
+// findTag returns the offset of the first ID3v2 tag header found at or
+// after offset pos, or -1 if there is none.
+func findTag(r io.ReaderAt, pos, size int64) int64 {
+	const chunk = 64 * 1024
+	buf := make([]byte, chunk+9)
+	for ; pos < size; pos += chunk {
+		n, _ := r.ReadAt(buf, pos)
+		b := buf[:n]
+		for i := 0; ; {
+			j := bytes.Index(b[i:], []byte("ID3"))
+			if j < 0 || i+j >= chunk {
+				break
+			}
+			i += j
+			if _, _, err := id3.PeekTag(b[i:]); err == nil {
+				return pos + int64(i)
+			}
+			i++
+		}
+	}
+	return -1
+}
+
+// insertRegion inserts a region into a list of regions sorted by offset.
+func insertRegion(rr []region, reg region) []region {
+	i := len(rr)
+	for i > 0 && rr[i-1].start > reg.start {
+		i--
+	}
+	rr = append(rr, region{})
+	copy(rr[i+1:], rr[i:])
+	rr[i] = reg
+	return rr
+}
+
+// tagSizeAt returns the total size of the ID3v2 tag at offset pos,
+// including its header and footer, or zero if there is no tag at pos.
+func tagSizeAt(r io.ReaderAt, pos int64) (int64, error) {
+	b := make([]byte, 10)
+	if n, err := r.ReadAt(b, pos); n < len(b) {
+		if err == io.EOF {
+			err = nil
+		}
+		return 0, err
+	}
+	_, size, err := id3.PeekTag(b)
+	if err != nil {
+		return 0, nil
+	}
+	if (b[5] & 0x10) != 0 {
+		size += 10 // v2.4 footer
+	}
+	return int64(size), nil
+}
+
+// trailingTags returns the offset of the first byte of the tags found at
+// the end of a file, which must follow offset start. ID3v1 tags, ID3v2.4
+// tags with a footer, APE tags, and Lyrics3 v1 and v2 tags are recognized,
+// in any order.
+func trailingTags(r io.ReaderAt, start, end int64) (int64, error) {
+	for {
+		n, err := trailingTagSize(r, end-start, end)
+		if err != nil {
+			return 0, err
+		}
+		if n == 0 || n > end-start {
+			return end, nil
+		}
+		end -= n
+	}
+}
+
+// trailingTagSize returns the size of the tag ending at offset end, or
+// zero if there is none. At most max bytes preceding end are considered.
+func trailingTagSize(r io.ReaderAt, max, end int64) (int64, error) {
+	tail := func(n int64) ([]byte, error) {
+		if n > max {
+			return nil, nil
+		}
+		b := make([]byte, n)
+		_, err := r.ReadAt(b, end-n)
+		return b, err
+	}
+
+	// ID3v1 tag.
+	if b, err := tail(128); err != nil {
+		return 0, err
+	} else if b != nil && string(b[:3]) == "TAG" {
+		return 128, nil
+	}
+
+	// ID3v2.4 tag with a footer.
+	if b, err := tail(10); err != nil {
+		return 0, err
+	} else if b != nil && string(b[:3]) == "3DI" {
+		b[0], b[1], b[2] = 'I', 'D', '3'
+		if _, size, err := id3.PeekTag(b); err == nil {
+			return int64(size) + 10, nil
+		}
+	}
+
+	// APE tag footer, which may be preceded by an APE tag header.
+	if b, err := tail(32); err != nil {
+		return 0, err
+	} else if b != nil && string(b[:8]) == "APETAGEX" {
+		size := int64(binary.LittleEndian.Uint32(b[12:16]))
+		if (binary.LittleEndian.Uint32(b[20:24]) & (1 << 31)) != 0 {
+			size += 32
+		}
+		return size, nil
+	}
+
+	// Lyrics3 v2 tag, ending with its size and "LYRICS200".
+	if b, err := tail(15); err != nil {
+		return 0, err
+	} else if b != nil && string(b[6:]) == "LYRICS200" {
+		if size, err := strconv.Atoi(string(b[:6])); err == nil {
+			return int64(size) + 15, nil
+		}
+	}
+
+	// Lyrics3 v1 tag, which is at most 5100 bytes long between its
+	// "LYRICSBEGIN" and "LYRICSEND" markers.
+	if b, err := tail(9); err != nil {
+		return 0, err
+	} else if b != nil && string(b) == "LYRICSEND" {
+		n := int64(5100 + 11 + 9)
+		if n > max {
+			n = max
+		}
+		b, err := tail(n)
+		if err != nil {
+			return 0, err
+		}
+		if i := bytes.LastIndex(b, []byte("LYRICSBEGIN")); i >= 0 {
+			return n - int64(i), nil
+		}
+	}
+
+	return 0, nil
+}
+
+// A readerAt adapts an io.ReadSeeker to the io.ReaderAt interface. It
+// is not safe for concurrent use.
+type readerAt struct {
+	r io.ReadSeeker
+}
+
+func (ra *readerAt) ReadAt(b []byte, off int64) (int, error) {
+	if _, err := ra.r.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(ra.r, b)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
@@ -0,0 +1,197 @@
+// Package mpeg parses the MPEG audio frames that follow an ID3 tag in an
+// MP3 file, and calculates the duration of the audio they contain.
+package mpeg
+
+import (
+	"errors"
+	"time"
+)
+
+// Possible errors returned by this package.
+var (
+	ErrInvalidHeader = errors.New("invalid mpeg audio frame header")
+	ErrNoFrames      = errors.New("no mpeg audio frames found")
+	ErrNoVBRHeader   = errors.New("no xing, info or vbri header found")
+)
+
+// Version describes the MPEG version of an audio frame.
+type Version uint8
+
+// All possible MPEG versions.
+const (
+	Version1   Version = iota // MPEG-1
+	Version2                  // MPEG-2
+	Version2_5                // MPEG-2.5 (unofficial extension of MPEG-2)
+)
+
+// String returns the name of the MPEG version.
+func (v Version) String() string {
+	return [...]string{"MPEG-1", "MPEG-2", "MPEG-2.5"}[v]
+}
+
+// Layer describes the MPEG audio layer of an audio frame.
+type Layer uint8
+
+// All possible MPEG audio layers.
+const (
+	Layer1 Layer = 1 + iota // Layer I
+	Layer2                  // Layer II
+	Layer3                  // Layer III
+)
+
+// String returns the name of the MPEG audio layer.
+func (l Layer) String() string {
+	return [...]string{"", "Layer I", "Layer II", "Layer III"}[l]
+}
+
+// ChannelMode describes how audio channels are stored in an audio frame.
+type ChannelMode uint8
+
+// All possible channel modes.
+const (
+	ChannelModeStereo      ChannelMode = iota // Stereo
+	ChannelModeJointStereo                    // Joint stereo
+	ChannelModeDualChannel                    // Two independent mono channels
+	ChannelModeMono                           // Single channel
+)
+
+// String returns the name of the channel mode.
+func (m ChannelMode) String() string {
+	return [...]string{"stereo", "joint stereo", "dual channel", "mono"}[m]
+}
+
+// HeaderSize is the size of an MPEG audio frame header in bytes.
+const HeaderSize = 4
+
+// A Header holds the data described by an MPEG audio frame header.
+type Header struct {
+	Version       Version     // MPEG version
+	Layer         Layer       // MPEG audio layer
+	Protected     bool        // Frame header is followed by a 16-bit CRC
+	Bitrate       int         // Bitrate in kbit/s
+	SampleRate    int         // Sample rate in Hz
+	Padding       bool        // Frame is padded with an extra slot
+	Private       bool        // Private bit
+	ChannelMode   ChannelMode // Channel mode
+	ModeExtension uint8       // Joint stereo mode extension
+	Copyright     bool        // Audio is copyrighted
+	Original      bool        // Audio is an original
+	Emphasis      uint8       // Emphasis
+}
+
+// bitrates holds the bitrates in kbit/s indexed by the bitrate index of a
+// frame header, for MPEG-1 layers I to III and MPEG-2/2.5 layers I to III.
+var bitrates = [2][3][15]int{
+	{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	},
+	{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	},
+}
+
+// sampleRates holds the sample rates in Hz indexed by MPEG version and the
+// sample rate index of a frame header.
+var sampleRates = [3][3]int{
+	{44100, 48000, 32000},
+	{22050, 24000, 16000},
+	{11025, 12000, 8000},
+}
+
+// ParseHeader parses a 4-byte MPEG audio frame header. It returns
+// ErrInvalidHeader if the bytes don't hold a valid header. Free-format
+// streams, which don't specify a bitrate, are not supported.
+func ParseHeader(b []byte) (Header, error) {
+	if len(b) < HeaderSize || b[0] != 0xff || (b[1]&0xe0) != 0xe0 {
+		return Header{}, ErrInvalidHeader
+	}
+
+	var h Header
+	switch (b[1] >> 3) & 3 {
+	case 0:
+		h.Version = Version2_5
+	case 2:
+		h.Version = Version2
+	case 3:
+		h.Version = Version1
+	default:
+		return Header{}, ErrInvalidHeader
+	}
+
+	layer := (b[1] >> 1) & 3
+	if layer == 0 {
+		return Header{}, ErrInvalidHeader
+	}
+	h.Layer = Layer(4 - layer)
+
+	bitrateIndex := b[2] >> 4
+	sampleRateIndex := (b[2] >> 2) & 3
+	if bitrateIndex == 0 || bitrateIndex == 15 || sampleRateIndex == 3 {
+		return Header{}, ErrInvalidHeader
+	}
+	row := 0
+	if h.Version != Version1 {
+		row = 1
+	}
+	h.Bitrate = bitrates[row][h.Layer-1][bitrateIndex]
+	h.SampleRate = sampleRates[h.Version][sampleRateIndex]
+
+	h.Protected = (b[1] & 1) == 0
+	h.Padding = (b[2] & 2) != 0
+	h.Private = (b[2] & 1) != 0
+	h.ChannelMode = ChannelMode(b[3] >> 6)
+	h.ModeExtension = (b[3] >> 4) & 3
+	h.Copyright = (b[3] & 8) != 0
+	h.Original = (b[3] & 4) != 0
+	h.Emphasis = b[3] & 3
+	if h.Emphasis == 2 {
+		return Header{}, ErrInvalidHeader
+	}
+
+	return h, nil
+}
+
+// Samples returns the number of audio samples per channel held by the
+// frame.
+func (h *Header) Samples() int {
+	switch {
+	case h.Layer == Layer1:
+		return 384
+	case h.Layer == Layer3 && h.Version != Version1:
+		return 576
+	default:
+		return 1152
+	}
+}
+
+// FrameSize returns the size of the frame in bytes, including its header.
+func (h *Header) FrameSize() int {
+	if h.Layer == Layer1 {
+		size := 12 * h.Bitrate * 1000 / h.SampleRate
+		if h.Padding {
+			size++
+		}
+		return size * 4
+	}
+
+	size := h.Samples() / 8 * h.Bitrate * 1000 / h.SampleRate
+	if h.Padding {
+		size++
+	}
+	return size
+}
+
+// Duration returns the duration of the audio held by the frame.
+func (h *Header) Duration() time.Duration {
+	return time.Duration(h.Samples()) * time.Second / time.Duration(h.SampleRate)
+}
+
+// compatible returns true if two frame headers could belong to the same
+// audio stream.
+func (h *Header) compatible(o *Header) bool {
+	return h.Version == o.Version && h.Layer == o.Layer && h.SampleRate == o.SampleRate
+}
@@ -0,0 +1,348 @@
+package mpeg
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/beevik/id3"
+)
+
+// newFrame returns an audio frame with the requested header and a silent
+// payload.
+func newFrame(hdr ...byte) []byte {
+	h, err := ParseHeader(hdr)
+	if err != nil {
+		panic(err)
+	}
+	b := make([]byte, h.FrameSize())
+	copy(b, hdr)
+	return b
+}
+
+// newStream returns an audio stream preceded by an ID3v2 tag and some
+// garbage, and followed by an ID3v1 tag.
+func newStream(frames ...[]byte) []byte {
+	tag := id3.NewTag(id3.Version2_4, 0)
+	tag.Frames = append(tag.Frames, id3.NewFrameText(id3.FrameTypeTextSongTitle, "Title"))
+	buf := bytes.NewBuffer([]byte{})
+	tag.WriteTo(buf)
+
+	// Garbage that looks like a frame header.
+	buf.Write([]byte{0xff, 0xfb, 0x90, 0x00, 0x01, 0x02})
+
+	for _, f := range frames {
+		buf.Write(f)
+	}
+
+	v1 := make([]byte, 128)
+	copy(v1, "TAG")
+	buf.Write(v1)
+	return buf.Bytes()
+}
+
+func TestParseHeader(t *testing.T) {
+	var cases = []struct {
+		input   []byte
+		header  Header
+		size    int
+		samples int
+	}{
+		{[]byte{0xff, 0xfb, 0x90, 0x00},
+			Header{Version: Version1, Layer: Layer3, Bitrate: 128, SampleRate: 44100}, 417, 1152},
+		{[]byte{0xff, 0xfb, 0x92, 0x64},
+			Header{Version: Version1, Layer: Layer3, Bitrate: 128, SampleRate: 44100, Padding: true,
+				ChannelMode: ChannelModeJointStereo, ModeExtension: 2, Original: true}, 418, 1152},
+		{[]byte{0xff, 0xf3, 0x84, 0xc4},
+			Header{Version: Version2, Layer: Layer3, Bitrate: 64, SampleRate: 24000,
+				ChannelMode: ChannelModeMono, Original: true}, 192, 576},
+		{[]byte{0xff, 0xe3, 0x18, 0xc0},
+			Header{Version: Version2_5, Layer: Layer3, Bitrate: 8, SampleRate: 8000,
+				ChannelMode: ChannelModeMono}, 72, 576},
+		{[]byte{0xff, 0xfd, 0xd0, 0x40},
+			Header{Version: Version1, Layer: Layer2, Bitrate: 320, SampleRate: 44100,
+				ChannelMode: ChannelModeJointStereo}, 1044, 1152},
+		{[]byte{0xff, 0xfe, 0xc4, 0x80},
+			Header{Version: Version1, Layer: Layer1, Protected: true, Bitrate: 384, SampleRate: 48000,
+				ChannelMode: ChannelModeDualChannel}, 384, 384},
+	}
+
+	for i, c := range cases {
+		h, err := ParseHeader(c.input)
+		if err != nil {
+			t.Errorf("case %d: %v", i, err)
+			continue
+		}
+		if h != c.header {
+			t.Errorf("case %d:\n  got %+v, expected %+v\n", i, h, c.header)
+		}
+		if h.FrameSize() != c.size || h.Samples() != c.samples {
+			t.Errorf("case %d:\n  got size %d and %d samples, expected %d and %d\n",
+				i, h.FrameSize(), h.Samples(), c.size, c.samples)
+		}
+	}
+
+	invalid := [][]byte{
+		{0xff, 0xfb, 0x90},       // too short
+		{0xfe, 0xfb, 0x90, 0x00}, // bad sync
+		{0xff, 0xeb, 0x90, 0x00}, // reserved version
+		{0xff, 0xf9, 0x90, 0x00}, // reserved layer
+		{0xff, 0xfb, 0x00, 0x00}, // free format
+		{0xff, 0xfb, 0xf0, 0x00}, // bad bitrate
+		{0xff, 0xfb, 0x9c, 0x00}, // reserved sample rate
+		{0xff, 0xfb, 0x90, 0x02}, // reserved emphasis
+	}
+	for i, b := range invalid {
+		if _, err := ParseHeader(b); err != ErrInvalidHeader {
+			t.Errorf("invalid case %d: got error %v", i, err)
+		}
+	}
+}
+
+func TestDuration(t *testing.T) {
+	cbr := newFrame(0xff, 0xfb, 0x90, 0x00)
+	var frames [][]byte
+	for i := 0; i < 100; i++ {
+		frames = append(frames, cbr)
+	}
+	stream := newStream(frames...)
+
+	info, err := Scan(bytes.NewReader(stream))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := 100 * 1152 * time.Second / 44100
+	if info.Frames != 100 || info.Duration != expected || info.VBR || info.Size != 41700 {
+		t.Errorf("got %+v, expected 100 frames lasting %v", info, expected)
+	}
+
+	est, err := Estimate(bytes.NewReader(stream))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if est.Offset != info.Offset || est.Size != info.Size {
+		t.Errorf("got estimate %+v, expected offset %d and size %d", est, info.Offset, info.Size)
+	}
+	if d := est.Duration - expected; d < -10*time.Millisecond || d > 10*time.Millisecond {
+		t.Errorf("got estimated duration %v, expected %v", est.Duration, expected)
+	}
+
+	// Variable bitrate streams are scanned frame by frame.
+	frames = frames[:0]
+	for i := 0; i < 50; i++ {
+		frames = append(frames, newFrame(0xff, 0xfb, 0x50, 0x00), newFrame(0xff, 0xfb, 0xe0, 0x00))
+	}
+	info, err = Scan(bytes.NewReader(newStream(frames...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Frames != 100 || info.Duration != expected || !info.VBR || info.Bitrate != 192 {
+		t.Errorf("got %+v, expected 100 frames lasting %v at 192 kbit/s", info, expected)
+	}
+
+	if _, err := Scan(bytes.NewReader(newStream())); err != ErrNoFrames {
+		t.Errorf("got error %v, expected %v", err, ErrNoFrames)
+	}
+}
+
+// newXingFrame returns an audio frame holding a Xing header with a LAME
+// extension.
+func newXingFrame(typ string, frames, size int) []byte {
+	f := newFrame(0xff, 0xfb, 0x90, 0x00)
+	b := f[HeaderSize+32:]
+	copy(b, typ)
+	binary.BigEndian.PutUint32(b[4:], 0x0f)
+	binary.BigEndian.PutUint32(b[8:], uint32(frames))
+	binary.BigEndian.PutUint32(b[12:], uint32(size))
+	for i := 0; i < 100; i++ {
+		b[16+i] = byte(i * 2)
+	}
+	binary.BigEndian.PutUint32(b[116:], 78)
+
+	l := b[120:]
+	copy(l, "LAME3.100")
+	l[9] = 0x13
+	l[10] = 194
+	binary.BigEndian.PutUint32(l[11:], 1<<22)
+	binary.BigEndian.PutUint16(l[15:], 0x2e41)
+	l[20] = 128
+	copy(l[21:], []byte{0x24, 0x03, 0xe8})
+	binary.BigEndian.PutUint32(l[28:], uint32(size))
+	return f
+}
+
+func TestVBRHeader(t *testing.T) {
+	f := newXingFrame("Xing", 100, 42117)
+	vh, err := ParseVBRHeader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &VBRHeader{
+		Type:    VBRTypeXing,
+		Frames:  100,
+		Bytes:   42117,
+		TOC:     f[HeaderSize+32+16 : HeaderSize+32+116],
+		Quality: 78,
+		LAME: &LAMEHeader{
+			Encoder:        "LAME3.100",
+			Revision:       1,
+			VBRMethod:      3,
+			Lowpass:        19400,
+			Peak:           0.5,
+			TrackGain:      &ReplayGain{Gain: -6.5, Originator: 3},
+			Bitrate:        128,
+			EncoderDelay:   576,
+			EncoderPadding: 1000,
+			MusicLength:    42117,
+		},
+	}
+	if !reflect.DeepEqual(vh, expected) {
+		t.Errorf("got %+v, expected %+v", vh, expected)
+	}
+
+	// VBRI header.
+	f = newFrame(0xff, 0xfb, 0x90, 0x00)
+	b := f[HeaderSize+32:]
+	copy(b, "VBRI")
+	binary.BigEndian.PutUint16(b[8:], 75)
+	binary.BigEndian.PutUint32(b[10:], 20000)
+	binary.BigEndian.PutUint32(b[14:], 50)
+	vh, err = ParseVBRHeader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(vh, &VBRHeader{Type: VBRTypeVBRI, Frames: 50, Bytes: 20000, Quality: 75}) {
+		t.Errorf("got %+v", vh)
+	}
+
+	if _, err := ParseVBRHeader(newFrame(0xff, 0xfb, 0x90, 0x00)); err != ErrNoVBRHeader {
+		t.Errorf("got error %v, expected %v", err, ErrNoVBRHeader)
+	}
+
+	// Streams starting with a Xing header.
+	frames := [][]byte{newXingFrame("Xing", 100, 42117)}
+	for i := 0; i < 100; i++ {
+		frames = append(frames, newFrame(0xff, 0xfb, 0x90, 0x00))
+	}
+	stream := newStream(frames...)
+	duration := 100 * 1152 * time.Second / 44100
+
+	for i, fn := range []func() (*Info, error){
+		func() (*Info, error) { return Scan(bytes.NewReader(stream)) },
+		func() (*Info, error) { return Estimate(bytes.NewReader(stream)) },
+	} {
+		info, err := fn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Frames != 100 || info.Duration != duration || info.VBRHeader == nil {
+			t.Errorf("case %d: got %+v, expected 100 frames lasting %v", i, info, duration)
+		}
+
+		g, ok := info.Gapless()
+		if !ok || g != (Gapless{Delay: 1105, Padding: 471, Samples: 113624}) {
+			t.Errorf("case %d: got gapless info %+v", i, g)
+		}
+		smpb := " 00000000 00000451 000001D7 000000000001BBD8 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000"
+		if s := g.ITunSMPB(); s != smpb {
+			t.Errorf("case %d: got iTunSMPB %q", i, s)
+		}
+	}
+}
+
+func TestAudioHash(t *testing.T) {
+	var audioA, audioB []byte
+	for i := 0; i < 10; i++ {
+		f := newFrame(0xff, 0xfb, 0x90, 0x00)
+		f[100] = byte(i)
+		audioA = append(audioA, f...)
+		f = newFrame(0xff, 0xfb, 0x50, 0x00)
+		f[100] = byte(i)
+		audioB = append(audioB, f...)
+	}
+	xing := newXingFrame("Xing", 20, len(audioA)+len(audioB))
+
+	newTag := func(title string, frames ...id3.Frame) []byte {
+		tag := id3.NewTag(id3.Version2_4, 0)
+		tag.Frames = append(tag.Frames, id3.NewFrameText(id3.FrameTypeTextSongTitle, title))
+		tag.Frames = append(tag.Frames, frames...)
+		buf := bytes.NewBuffer([]byte{})
+		if _, err := tag.WriteTo(buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	concat := func(bb ...[]byte) []byte {
+		return bytes.Join(bb, nil)
+	}
+	sum := func(b []byte, opts HashOptions) string {
+		h := sha256.New()
+		if err := AudioHashWithOptions(bytes.NewReader(b), h, opts); err != nil {
+			t.Fatal(err)
+		}
+		return string(h.Sum(nil))
+	}
+
+	// A tag located by a SEEK frame in the middle of the audio.
+	seek := make([]byte, 4)
+	binary.BigEndian.PutUint32(seek, uint32(len(audioA)))
+	chained := concat(
+		newTag("Leading", id3.NewFrameUnknown("SEEK", seek)),
+		audioA, newTag("Chained"), audioB)
+
+	// Appended v2.4 tag with a footer.
+	appended := newTag("Appended")
+	appended[0], appended[1], appended[2] = '3', 'D', 'I'
+	appended = concat(newTag("Appended")[:len(appended)], appended[:10])
+	appended[5] |= 0x10
+
+	// APE tag with header and footer.
+	apeFooter := make([]byte, 32)
+	copy(apeFooter, "APETAGEX")
+	binary.LittleEndian.PutUint32(apeFooter[12:], 32+20)
+	binary.LittleEndian.PutUint32(apeFooter[20:], 1<<31)
+	ape := concat(apeFooter, make([]byte, 20), apeFooter)
+
+	lyrics2 := concat([]byte("LYRICSBEGININD00002"), []byte("000019LYRICS200"))
+	lyrics1 := []byte("LYRICSBEGINsome lyricsLYRICSEND")
+	v1 := make([]byte, 128)
+	copy(v1, "TAGTitle")
+
+	plain := concat(audioA, audioB)
+	expected := sum(plain, HashOptions{})
+
+	var cases = [][]byte{
+		concat(newTag("Title"), plain),
+		concat(newTag("Other"), newTag("Second"), plain, v1),
+		concat(chained, v1),
+		concat(plain, appended),
+		concat(newTag("Title"), plain, ape, lyrics2, v1),
+		concat(plain, lyrics1, v1),
+		concat([]byte{0xff, 0xfb, 0x90, 0x00, 0x00}, plain),
+	}
+	for i, c := range cases {
+		if s := sum(c, HashOptions{}); s != expected {
+			t.Errorf("case %d: hash differs from audio-only hash", i)
+		}
+	}
+
+	// VBR headers are hashed unless excluded.
+	rewritten := append([]byte{}, xing...)
+	rewritten[len(rewritten)-20] = 0x55
+	withXing := sum(concat(xing, plain), HashOptions{})
+	if withXing == expected || withXing == sum(concat(rewritten, plain), HashOptions{}) {
+		t.Errorf("VBR header not hashed")
+	}
+	opts := HashOptions{ExcludeVBRHeader: true}
+	if sum(concat(xing, plain), opts) != expected || sum(concat(rewritten, plain), opts) != expected {
+		t.Errorf("VBR header not excluded")
+	}
+
+	err := AudioHash(bytes.NewReader(concat(newTag("Title"), v1)), sha256.New())
+	if err != ErrNoFrames {
+		t.Errorf("got error %v, expected %v", err, ErrNoFrames)
+	}
+}
@@ -0,0 +1,154 @@
+package mpeg
+
+import (
+	"bufio"
+	"io"
+
+	"github.com/beevik/id3"
+)
+
+// A Scanner reads the MPEG audio frames of a stream one at a time. The
+// stream may begin with one or more ID3v2 tags, which are skipped. Data
+// that isn't part of an audio frame, such as garbage between frames or an
+// ID3v1 tag at the end of the stream, is skipped as well.
+type Scanner struct {
+	r      *bufio.Reader
+	offset int64  // offset of the current frame within the stream
+	size   int    // size of the current frame, or zero before the first
+	header Header // header of the current frame
+	first  Header // header of the first frame
+	synced bool   // true if the current frame directly follows the previous
+	done   bool   // true once the scanner has stopped
+	err    error  // error that stopped the scanner, if any
+}
+
+// NewScanner creates a new Scanner reading from r.
+func NewScanner(r io.Reader) *Scanner {
+	return &Scanner{r: bufio.NewReaderSize(r, 16*1024)}
+}
+
+// Next advances the scanner to the next audio frame. It returns false when
+// there are no more frames or an error occurs. Use Err to distinguish the
+// two cases.
+func (s *Scanner) Next() bool {
+	if s.done {
+		return false
+	}
+
+	if s.size == 0 {
+		if !s.skipTags() {
+			return false
+		}
+	} else {
+		// Skip the current frame.
+		if !s.discard(s.size) {
+			return false
+		}
+	}
+
+	for {
+		b, err := s.r.Peek(HeaderSize)
+		if err != nil {
+			s.fail(err)
+			return false
+		}
+
+		h, err := ParseHeader(b)
+		if err == nil && (s.size == 0 || h.compatible(&s.first)) {
+			if s.synced || s.confirm(&h) {
+				if s.size == 0 {
+					s.first = h
+				}
+				s.header, s.size, s.synced = h, h.FrameSize(), true
+				return true
+			}
+		}
+
+		// Search for the next frame one byte at a time.
+		s.synced = false
+		if !s.discard(1) {
+			return false
+		}
+	}
+}
+
+// Header returns the header of the current audio frame.
+func (s *Scanner) Header() Header {
+	return s.header
+}
+
+// Offset returns the offset of the current audio frame from the start of
+// the stream.
+func (s *Scanner) Offset() int64 {
+	return s.offset
+}
+
+// Frame returns the contents of the current audio frame, including its
+// header. The returned slice is valid only until the next call to Next.
+func (s *Scanner) Frame() ([]byte, error) {
+	b, err := s.r.Peek(s.size)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return b, err
+}
+
+// Err returns the first error encountered by the scanner, or nil if the
+// scanner stopped at the end of the stream.
+func (s *Scanner) Err() error {
+	return s.err
+}
+
+// skipTags skips the ID3v2 tags at the start of the stream.
+func (s *Scanner) skipTags() bool {
+	for {
+		b, _ := s.r.Peek(10)
+		_, size, err := id3.PeekTag(b)
+		if err != nil {
+			return true
+		}
+		if (b[5] & 0x10) != 0 {
+			size += 10 // v2.4 footer
+		}
+		if !s.discard(size) {
+			return false
+		}
+	}
+}
+
+// confirm returns true if a frame header found while searching for a
+// frame is followed by another compatible frame header or by the end of
+// the stream. This guards against mistaking random data for a header.
+func (s *Scanner) confirm(h *Header) bool {
+	size := h.FrameSize()
+	b, err := s.r.Peek(size + HeaderSize)
+	switch {
+	case err == nil:
+		next, err := ParseHeader(b[size:])
+		return err == nil && next.compatible(h)
+	case err == io.EOF:
+		return len(b) == size
+	default:
+		return false
+	}
+}
+
+// discard skips n bytes of the stream.
+func (s *Scanner) discard(n int) bool {
+	m, err := s.r.Discard(n)
+	s.offset += int64(m)
+	if err != nil {
+		s.fail(err)
+		return false
+	}
+	return true
+}
+
+// fail stops the scanner, recording the error that stopped it. Reaching
+// the end of the stream isn't an error.
+func (s *Scanner) fail(err error) {
+	s.done = true
+	if err != io.EOF {
+		s.err = err
+	}
+}
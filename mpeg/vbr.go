@@ -0,0 +1,223 @@
+package mpeg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// VBRType describes the kind of header found in the first audio frame of a
+// stream.
+type VBRType uint8
+
+// All possible VBRType values.
+const (
+	VBRTypeXing VBRType = iota // Xing header of a variable bitrate stream
+	VBRTypeInfo                // Xing header of a constant bitrate stream
+	VBRTypeVBRI                // Fraunhofer VBRI header
+)
+
+// String returns the tag identifying the header.
+func (t VBRType) String() string {
+	return [...]string{"Xing", "Info", "VBRI"}[t]
+}
+
+// A VBRHeader holds the data of the Xing, Info or VBRI header stored in the
+// first audio frame of a stream by most encoders. The frame holding the
+// header contains no audio.
+type VBRHeader struct {
+	Type    VBRType     // Kind of header
+	Frames  int         // Number of audio frames, or zero if unknown
+	Bytes   int64       // Size of the audio data in bytes, or zero if unknown
+	TOC     []byte      // Xing seek table of 100 entries, if present
+	Quality int         // Encoder quality indicator, or zero if unknown
+	LAME    *LAMEHeader // LAME extension, or nil if not present
+}
+
+// A LAMEHeader holds the data of the LAME extension to the Xing/Info
+// header, written by LAME and compatible encoders.
+type LAMEHeader struct {
+	Encoder        string      // Encoder name and version (e.g., "LAME3.100")
+	Revision       uint8       // Revision of the LAME extension
+	VBRMethod      uint8       // VBR method (e.g., 1 for CBR, 3 to 5 for VBR)
+	Lowpass        int         // Lowpass filter frequency in Hz, or zero
+	Peak           float64     // Peak signal amplitude, 1.0 being full scale
+	TrackGain      *ReplayGain // Track (radio) ReplayGain, or nil
+	AlbumGain      *ReplayGain // Album (audiophile) ReplayGain, or nil
+	EncodingFlags  uint8       // Encoding flags
+	ATHType        uint8       // Absolute threshold of hearing type
+	Bitrate        int         // Target (ABR) or minimal (VBR) bitrate in kbit/s
+	EncoderDelay   int         // Samples added by the encoder at the start
+	EncoderPadding int         // Samples added by the encoder at the end
+	MusicLength    uint32      // Size of the audio data in bytes, or zero
+	MusicCRC       uint16      // CRC-16 of the audio data
+}
+
+// A ReplayGain holds a ReplayGain adjustment stored in a LAME header.
+type ReplayGain struct {
+	Gain       float64 // Adjustment in dB
+	Originator uint8   // How the adjustment was determined (e.g., 3 for automatic)
+}
+
+// ParseVBRHeader parses the Xing, Info or VBRI header held by an audio
+// frame, which must include its frame header. It returns ErrNoVBRHeader if
+// the frame doesn't contain such a header.
+func ParseVBRHeader(frame []byte) (*VBRHeader, error) {
+	h, err := ParseHeader(frame)
+	if err != nil {
+		return nil, err
+	}
+
+	off := HeaderSize + sideInfoSize(&h)
+	if h.Protected {
+		off += 2
+	}
+	if len(frame) >= off+8 {
+		switch string(frame[off : off+4]) {
+		case "Xing":
+			return parseXing(frame[off:], VBRTypeXing)
+		case "Info":
+			return parseXing(frame[off:], VBRTypeInfo)
+		}
+	}
+
+	// The VBRI header always follows 32 bytes of side information.
+	off = HeaderSize + 32
+	if len(frame) >= off+26 && string(frame[off:off+4]) == "VBRI" {
+		b := frame[off:]
+		return &VBRHeader{
+			Type:    VBRTypeVBRI,
+			Quality: int(binary.BigEndian.Uint16(b[8:10])),
+			Bytes:   int64(binary.BigEndian.Uint32(b[10:14])),
+			Frames:  int(binary.BigEndian.Uint32(b[14:18])),
+		}, nil
+	}
+
+	return nil, ErrNoVBRHeader
+}
+
+// Flags indicating which fields of a Xing header are present.
+const (
+	xingFrames  = 1 << 0
+	xingBytes   = 1 << 1
+	xingTOC     = 1 << 2
+	xingQuality = 1 << 3
+)
+
+// parseXing parses a Xing or Info header and its LAME extension.
+func parseXing(b []byte, typ VBRType) (*VBRHeader, error) {
+	vh := &VBRHeader{Type: typ}
+	flags := binary.BigEndian.Uint32(b[4:8])
+	b = b[8:]
+
+	field := func(flag uint32, size int) []byte {
+		if (flags&flag) == 0 || len(b) < size {
+			return nil
+		}
+		f := b[:size]
+		b = b[size:]
+		return f
+	}
+	if f := field(xingFrames, 4); f != nil {
+		vh.Frames = int(binary.BigEndian.Uint32(f))
+	}
+	if f := field(xingBytes, 4); f != nil {
+		vh.Bytes = int64(binary.BigEndian.Uint32(f))
+	}
+	if f := field(xingTOC, 100); f != nil {
+		vh.TOC = append([]byte{}, f...)
+	}
+	if f := field(xingQuality, 4); f != nil {
+		vh.Quality = int(binary.BigEndian.Uint32(f))
+	}
+
+	if len(b) >= 36 && isEncoderName(b[:4]) {
+		vh.LAME = parseLAME(b[:36])
+	}
+	return vh, nil
+}
+
+// parseLAME parses the 36-byte LAME extension of a Xing header.
+func parseLAME(b []byte) *LAMEHeader {
+	l := &LAMEHeader{
+		Encoder:       strings.TrimRight(string(bytes.TrimRight(b[:9], "\x00")), " "),
+		Revision:      b[9] >> 4,
+		VBRMethod:     b[9] & 0x0f,
+		Lowpass:       int(b[10]) * 100,
+		Peak:          float64(binary.BigEndian.Uint32(b[11:15])) / (1 << 23),
+		TrackGain:     parseReplayGain(binary.BigEndian.Uint16(b[15:17]), 1),
+		AlbumGain:     parseReplayGain(binary.BigEndian.Uint16(b[17:19]), 2),
+		EncodingFlags: b[19] >> 4,
+		ATHType:       b[19] & 0x0f,
+		Bitrate:       int(b[20]),
+		MusicLength:   binary.BigEndian.Uint32(b[28:32]),
+		MusicCRC:      binary.BigEndian.Uint16(b[32:34]),
+	}
+	l.EncoderDelay = int(b[21])<<4 | int(b[22]>>4)
+	l.EncoderPadding = int(b[22]&0x0f)<<8 | int(b[23])
+	return l
+}
+
+// parseReplayGain parses a ReplayGain field of a LAME header, returning
+// nil if the field is unset or doesn't hold the requested kind of
+// adjustment (1 for track, 2 for album).
+func parseReplayGain(v uint16, name uint16) *ReplayGain {
+	if v>>13 != name {
+		return nil
+	}
+	rg := &ReplayGain{
+		Gain:       float64(v&0x1ff) / 10,
+		Originator: uint8(v>>10) & 7,
+	}
+	if (v & 0x200) != 0 {
+		rg.Gain = -rg.Gain
+	}
+	return rg
+}
+
+// isEncoderName returns true if b starts like an encoder name, as written
+// by LAME and its forks (e.g., "LAME", "Lavc", "Lavf" or "GOGO").
+func isEncoderName(b []byte) bool {
+	for _, c := range b {
+		if (c < 'A' || c > 'Z') && (c < 'a' || c > 'z') {
+			return false
+		}
+	}
+	return true
+}
+
+// sideInfoSize returns the size of the Layer III side information that
+// follows a frame header, which precedes a Xing header.
+func sideInfoSize(h *Header) int {
+	mono := h.ChannelMode == ChannelModeMono
+	switch {
+	case h.Version == Version1 && mono:
+		return 17
+	case h.Version == Version1:
+		return 32
+	case mono:
+		return 9
+	default:
+		return 17
+	}
+}
+
+// decoderDelay is the number of samples of delay introduced by MP3
+// decoders, which gapless players remove in addition to the encoder delay.
+const decoderDelay = 528 + 1
+
+// Gapless describes how many samples a player must remove from the start
+// and end of the decoded audio for gapless playback.
+type Gapless struct {
+	Delay   int   // Samples to remove from the start, including decoder delay
+	Padding int   // Samples to remove from the end
+	Samples int64 // Samples remaining after removal
+}
+
+// ITunSMPB returns the gapless playback information formatted as the
+// value of the iTunSMPB comment used by iTunes.
+func (g Gapless) ITunSMPB() string {
+	return fmt.Sprintf(" 00000000 %08X %08X %016X 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000",
+		g.Delay, g.Padding, g.Samples)
+}
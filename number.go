@@ -0,0 +1,136 @@
+package id3
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// NumberPadding describes how track and disc numbers are zero-padded when
+// they are stored into a tag.
+type NumberPadding uint8
+
+// All possible NumberPadding values.
+const (
+	NumberPaddingNone      NumberPadding = iota // "3/12"
+	NumberPaddingToTotal                        // "03/12", "003/100"
+	NumberPaddingTwoDigits                      // "03/12", "03"
+)
+
+// TrackNumber returns the track number and total number of tracks stored
+// in the tag's TRCK frame. If the frame doesn't indicate the total number
+// of tracks, total is zero. If the tag contains no parseable track number,
+// ok is false.
+func (t *Tag) TrackNumber() (n, total int, ok bool) {
+	return t.numberPair(FrameTypeTextTrackNumber)
+}
+
+// SetTrackNumber stores a track number and total number of tracks into the
+// tag's TRCK frame. Use a total of zero if the total is unknown. Use a
+// track number of zero to remove the frame.
+func (t *Tag) SetTrackNumber(n, total int) error {
+	return t.setNumberPair(FrameTypeTextTrackNumber, n, total, NumberPaddingNone)
+}
+
+// SetTrackNumberPadded is like SetTrackNumber, but it zero-pads the numbers
+// according to the requested padding style.
+func (t *Tag) SetTrackNumberPadded(n, total int, p NumberPadding) error {
+	return t.setNumberPair(FrameTypeTextTrackNumber, n, total, p)
+}
+
+// DiscNumber returns the disc number and total number of discs stored in
+// the tag's TPOS (part of set) frame. If the frame doesn't indicate the
+// total number of discs, total is zero. If the tag contains no parseable
+// disc number, ok is false.
+func (t *Tag) DiscNumber() (n, total int, ok bool) {
+	return t.numberPair(FrameTypeTextPartOfSet)
+}
+
+// SetDiscNumber stores a disc number and total number of discs into the
+// tag's TPOS (part of set) frame. Use a total of zero if the total is
+// unknown. Use a disc number of zero to remove the frame.
+func (t *Tag) SetDiscNumber(n, total int) error {
+	return t.setNumberPair(FrameTypeTextPartOfSet, n, total, NumberPaddingNone)
+}
+
+// SetDiscNumberPadded is like SetDiscNumber, but it zero-pads the numbers
+// according to the requested padding style.
+func (t *Tag) SetDiscNumberPadded(n, total int, p NumberPadding) error {
+	return t.setNumberPair(FrameTypeTextPartOfSet, n, total, p)
+}
+
+func (t *Tag) numberPair(typ FrameType) (n, total int, ok bool) {
+	s, ok := t.text(typ)
+	if !ok {
+		return 0, 0, false
+	}
+	return parseNumberPair(s)
+}
+
+func (t *Tag) setNumberPair(typ FrameType, n, total int, p NumberPadding) error {
+	if n < 0 || total < 0 {
+		return ErrInvalidNumber
+	}
+	if n == 0 {
+		return t.setText(typ)
+	}
+	return t.setText(typ, formatNumberPair(n, total, p))
+}
+
+// parseNumberPair parses a string of the form "n" or "n/total". It
+// tolerates leading zeros, surrounding whitespace, and any junk following
+// the numbers (e.g., "03 / 12 (bonus)").
+func parseNumberPair(s string) (n, total int, ok bool) {
+	i := skipSpaces(s, 0)
+	n, i, ok = parseNumber(s, i)
+	if !ok {
+		return 0, 0, false
+	}
+
+	i = skipSpaces(s, i)
+	if i < len(s) && s[i] == '/' {
+		i = skipSpaces(s, i+1)
+		total, _, _ = parseNumber(s, i)
+	}
+	return n, total, true
+}
+
+// parseNumber parses the decimal number starting at offset i of s. It
+// returns the number and the offset of the first byte following it.
+func parseNumber(s string, i int) (n int, next int, ok bool) {
+	start := i
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	if i == start {
+		return 0, i, false
+	}
+	n, err := strconv.Atoi(s[start:i])
+	if err != nil {
+		return 0, i, false
+	}
+	return n, i, true
+}
+
+func skipSpaces(s string, i int) int {
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+		i++
+	}
+	return i
+}
+
+// formatNumberPair formats a number and an optional total using the
+// requested padding style.
+func formatNumberPair(n, total int, p NumberPadding) string {
+	var width int
+	switch p {
+	case NumberPaddingToTotal:
+		width = len(strconv.Itoa(total))
+	case NumberPaddingTwoDigits:
+		width = 2
+	}
+
+	if total == 0 {
+		return fmt.Sprintf("%0*d", width, n)
+	}
+	return fmt.Sprintf("%0*d/%0*d", width, n, width, total)
+}
@@ -8,14 +8,19 @@ import (
 // A reader represents a buffer that may be consumed by the caller. The
 // buffer is populated from an input stream.
 type reader struct {
-	r   io.Reader
-	buf []byte
-	n   int
-	err error
+	r    io.Reader
+	buf  []byte
+	n    int
+	err  error
+	opts *DecodeOptions
+
+	// byteOrder is the byte order of the first UTF-16 string with a byte
+	// order mark consumed from the reader.
+	byteOrder ByteOrder
 }
 
-func newReader(r io.Reader) *reader {
-	return &reader{r: r, buf: make([]byte, 0, 64)}
+func newReader(r io.Reader, opts *DecodeOptions) *reader {
+	return &reader{r: r, buf: make([]byte, 0, 64), opts: opts}
 }
 
 // Bytes returns the contents of the reader's buffer without consuming them.
@@ -29,12 +34,26 @@ func (r *reader) Len() int {
 }
 
 // LoadFrom pulls exactly n bytes from a stream into the reader's buffer.
+// The buffer grows in chunks as data arrives, so that a stream holding
+// fewer bytes than requested doesn't cause a large allocation.
 func (r *reader) Load(n int) (int, error) {
-	l := len(r.buf)
-	r.buf = append(r.buf, make([]byte, n)...)
+	const chunk = 1 << 20
 
 	var nn int
-	nn, r.err = io.ReadFull(r.r, r.buf[l:])
+	for nn < n && r.err == nil {
+		c := n - nn
+		if c > chunk {
+			c = chunk
+		}
+
+		l := len(r.buf)
+		r.buf = append(r.buf, make([]byte, c)...)
+
+		var cn int
+		cn, r.err = io.ReadFull(r.r, r.buf[l:])
+		r.buf = r.buf[:l+cn]
+		nn += cn
+	}
 	r.n += nn
 
 	if nn < n {
@@ -43,6 +62,27 @@ func (r *reader) Load(n int) (int, error) {
 	return nn, r.err
 }
 
+// text returns the codec used to decode the reader's strings.
+func (r *reader) text() textCodec {
+	if r.opts == nil {
+		return textCodec{}
+	}
+	return textCodec{lenient: r.opts.LenientUTF16}
+}
+
+// limits returns the reader's decoding limits.
+func (r *reader) limits() DecodeLimits {
+	if r.opts == nil {
+		return DecodeLimits{}
+	}
+	return r.opts.Limits
+}
+
+// lenient returns true if the reader is decoding in lenient mode.
+func (r *reader) lenient() bool {
+	return r.opts != nil && r.opts.Lenient
+}
+
 // ReplaceBuffer replaces the contents of the reader's buffer with the
 // provided byte slice.
 func (r *reader) ReplaceBuffer(p []byte) {
@@ -80,6 +120,16 @@ func (r *reader) ConsumeBytes(n int) []byte {
 	return b
 }
 
+// ConsumeUint32 consumes a 4-byte big-endian integer from the reader's
+// buffer and returns it.
+func (r *reader) ConsumeUint32() uint32 {
+	v, err := decodeUint32(r.ConsumeBytes(4))
+	if r.err == nil {
+		r.err = err
+	}
+	return v
+}
+
 // ConsumeFixedLengthString consumes a string of known length from the reader's
 // buffer and returns it.
 func (r *reader) ConsumeFixedLengthString(len int, enc Encoding) string {
@@ -93,8 +143,9 @@ func (r *reader) ConsumeFixedLengthString(len int, enc Encoding) string {
 		return strings.Repeat("_", len)
 	}
 
+	r.noteByteOrder(p, enc)
 	var str string
-	str, r.err = decodeString(p, enc)
+	str, r.err = r.text().decodeString(p, enc)
 	return str
 }
 
@@ -105,8 +156,9 @@ func (r *reader) ConsumeNextString(enc Encoding) string {
 		return ""
 	}
 
+	r.noteByteOrder(r.buf, enc)
 	var str string
-	str, r.buf, r.err = decodeNextString(r.buf, enc)
+	str, r.buf, r.err = r.text().decodeNextString(r.buf, enc)
 	return str
 }
 
@@ -117,8 +169,9 @@ func (r *reader) ConsumeStrings(enc Encoding) []string {
 		return []string{}
 	}
 
+	r.noteByteOrder(r.buf, enc)
 	var ss []string
-	ss, r.err = decodeStrings(r.buf, enc)
+	ss, r.err = r.text().decodeStrings(r.buf, enc)
 	if r.err != nil {
 		return ss
 	}
@@ -127,6 +180,14 @@ func (r *reader) ConsumeStrings(enc Encoding) []string {
 	return ss
 }
 
+// noteByteOrder records the byte order of an encoded UTF-16 string about
+// to be consumed, if it is the first one with a byte order mark.
+func (r *reader) noteByteOrder(b []byte, enc Encoding) {
+	if enc == EncodingUTF16BOM && r.byteOrder == ByteOrderDefault {
+		r.byteOrder = bomOrder(b)
+	}
+}
+
 // ConsumeAll consumes the remaining contents of the reader's buffer
 // and returns them as a byte slice.
 func (r *reader) ConsumeAll() []byte {
@@ -143,14 +204,14 @@ func (r *reader) ConsumeAll() []byte {
 // a new reader.
 func (r *reader) ConsumeIntoNewReader(n int) *reader {
 	if r.err != nil {
-		return &reader{r: r.r, buf: nil}
+		return &reader{r: r.r, buf: nil, opts: r.opts}
 	}
 	if len(r.buf) < n {
 		r.err = io.ErrUnexpectedEOF
-		return &reader{r: r.r, buf: nil}
+		return &reader{r: r.r, buf: nil, opts: r.opts}
 	}
 
 	b := r.buf[:n]
 	r.buf = r.buf[n:]
-	return &reader{r: r.r, buf: b}
+	return &reader{r: r.r, buf: b, opts: r.opts}
 }
@@ -19,6 +19,16 @@ func newReflector(v Version, vdata *versionData) *reflector {
 	}
 }
 
+// A generatedFrame is a frame type whose scan and output methods are
+// generated by framegen from its struct definition, so that it can be
+// scanned and output without reflection. Other frame types, such as
+// custom frames defined outside this package, use the reflector.
+type generatedFrame interface {
+	header() *FrameHeader
+	scan(r *reader, rf *reflector, state *state)
+	output(w *writer, rf *reflector, state *state)
+}
+
 // A property holds the reflection data necessary to update a property's
 // value. Usually the property is a struct field.
 type property struct {
@@ -34,57 +44,103 @@ type state struct {
 	structStack valueStack // stack of active struct values
 	fieldCount  int        // current frame's field count
 	fieldIndex  int        // current frame field index
+	encoding    Encoding   // text encoding selected for output
+	field       string     // name of the current field
+}
+
+// rootUint returns the value of an unsigned integer field of the frame's
+// root level struct. It returns false if the struct has no such field.
+func (s *state) rootUint(name string) (uint64, bool) {
+	f := s.structStack.first().FieldByName(name)
+	switch f.Kind() {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return f.Uint(), true
+	default:
+		return 0, false
+	}
 }
 
-// ScanFrame uses reflection to scan the contents of an ID3 frame from a
-// reader buffer.
+// ScanFrame scans the contents of an ID3 frame from a reader buffer. Frame
+// types with generated scan methods are scanned without reflection.
 func (rf *reflector) ScanFrame(r *reader, frameID string) (Frame, error) {
 	state := state{frameID: frameID}
 
 	typ := rf.vdata.frameTypes.LookupReflectType(frameID)
 
+	var f Frame
+	if newFrame, ok := generatedFrames[typ]; ok {
+		gf := newFrame()
+		gf.scan(r, rf, &state)
+		f = gf
+	} else {
+		f = rf.scanFrame(r, typ, &state)
+	}
+
+	if r.err != nil {
+		return nil, &DecodeError{Err: r.err, FrameID: frameID, Field: state.field}
+	}
+	return f, nil
+}
+
+// scanFrame uses reflection to scan the contents of a frame of the
+// requested type from a reader buffer.
+func (rf *reflector) scanFrame(r *reader, typ reflect.Type, state *state) Frame {
 	p := property{
 		typ:   typ,
 		value: reflect.New(typ),
 		name:  "",
 	}
 
-	rf.scanStruct(r, p, &state)
-	if r.err != nil {
-		return nil, r.err
-	}
-
-	f := p.value.Interface().(Frame)
-	return f, nil
+	rf.scanStruct(r, p, state)
+	return p.value.Interface().(Frame)
 }
 
 // SetFrameHeader uses reflection to update a frame's header.
-func (rf *reflector) SetFrameHeader(f Frame, h *FrameHeader) {
-	source := reflect.ValueOf(h).Elem()
-	target := reflect.ValueOf(f).Elem().Field(0)
-	target.Set(source)
+func (rf *reflector) SetFrameHeader(f Frame, h *FrameHeader) error {
+	target, err := HeaderOfChecked(f)
+	if err != nil {
+		return err
+	}
+	*target = *h
+	return nil
 }
 
-// OutputFrame uses reflection to output the contents of an ID3 frame to
-// a writer buffer.
+// OutputFrame outputs the contents of an ID3 frame to a writer buffer.
+// Frame types with generated output methods are output without
+// reflection.
 func (rf *reflector) OutputFrame(w *writer, f Frame) (frameID string, err error) {
-	frameType := HeaderOf(f).FrameType
-	frameID = rf.vdata.frameTypes.LookupFrameID(frameType)
+	h, err := HeaderOfChecked(f)
+	if err != nil {
+		return "", &EncodeError{Err: err}
+	}
+	frameID = rf.vdata.frameTypes.LookupFrameID(h.FrameType)
 
 	state := state{frameID: frameID}
 
+	if gf := asGeneratedFrame(f); gf != nil {
+		gf.output(w, rf, &state)
+	} else {
+		rf.outputFrame(w, f, &state)
+	}
+
+	if w.err != nil {
+		return "", &EncodeError{Err: w.err, FrameID: state.frameID, Field: state.field}
+	}
+
+	// Unknown frames supply their own frame ID.
+	return state.frameID, nil
+}
+
+// outputFrame uses reflection to output the contents of a frame to a
+// writer buffer.
+func (rf *reflector) outputFrame(w *writer, f Frame, state *state) {
 	p := property{
 		typ:   reflect.TypeOf(f).Elem(),
 		value: reflect.ValueOf(f).Elem(),
 		name:  "",
 	}
 
-	rf.outputStruct(w, p, &state)
-	if w.err != nil {
-		return "", w.err
-	}
-
-	return frameID, nil
+	rf.outputStruct(w, p, state)
 }
 
 func (rf *reflector) scanStruct(r *reader, p property, state *state) {
@@ -97,12 +153,16 @@ func (rf *reflector) scanStruct(r *reader, p property, state *state) {
 		state.fieldCount = p.typ.NumField()
 	}
 
-	for ii, n := 0, p.typ.NumField(); ii < n; ii++ {
+	for ii, n := 0, p.typ.NumField(); ii < n && r.err == nil; ii++ {
 		if state.structStack.depth() == 1 {
 			state.fieldIndex = ii
 		}
 
 		field := p.typ.Field(ii)
+		state.field = fieldPath(p.name, field.Name)
+		if r.err = checkField(field); r.err != nil {
+			break
+		}
 
 		fp := property{
 			typ:   field.Type,
@@ -134,17 +194,18 @@ func (rf *reflector) scanStruct(r *reader, p property, state *state) {
 			case reflect.Struct:
 				rf.scanStructSlice(r, fp, state)
 			default:
-				panic(errUnknownFieldType)
+				r.err = ErrInvalidPayloadDef
 			}
 
 		case reflect.String:
 			rf.scanString(r, fp, state)
 
 		case reflect.Struct:
+			fp.value = fp.value.Addr()
 			rf.scanStruct(r, fp, state)
 
 		default:
-			panic(errUnknownFieldType)
+			r.err = ErrInvalidPayloadDef
 		}
 	}
 
@@ -156,18 +217,11 @@ func (rf *reflector) scanUint8(r *reader, p property, state *state) {
 		return
 	}
 
-	bounds, hasBounds := rf.vdata.bounds[p.name]
-
-	value := r.ConsumeByte()
+	value := rf.readUint8(r, p.name)
 	if r.err != nil {
 		return
 	}
 
-	if hasBounds && (value < uint8(bounds.min) || value > uint8(bounds.max)) {
-		r.err = bounds.err
-		return
-	}
-
 	p.value.SetUint(uint64(value))
 }
 
@@ -179,13 +233,9 @@ func (rf *reflector) scanUint16(r *reader, p property, state *state) {
 	var value uint16
 	switch p.name {
 	case "BPM":
-		value = uint16(r.ConsumeByte())
-		if value == 0xff {
-			value += uint16(r.ConsumeByte())
-		}
+		value = readBPM(r)
 	default:
-		b := r.ConsumeBytes(2)
-		value = uint16(b[0])<<8 | uint16(b[1])
+		value = readUint16(r)
 	}
 
 	if r.err != nil {
@@ -200,14 +250,7 @@ func (rf *reflector) scanUint32(r *reader, p property, state *state) {
 		return
 	}
 
-	b := r.ConsumeBytes(4)
-
-	var value uint64
-	for _, bb := range b {
-		value = (value << 8) | uint64(bb)
-	}
-
-	p.value.SetUint(value)
+	p.value.SetUint(uint64(r.ConsumeUint32()))
 }
 
 func (rf *reflector) scanUint64(r *reader, p property, state *state) {
@@ -215,20 +258,12 @@ func (rf *reflector) scanUint64(r *reader, p property, state *state) {
 		return
 	}
 
-	var b []byte
-	switch p.name {
-	case "Counter":
-		b = r.ConsumeAll()
-	default:
-		panic(errUnknownFieldType)
-	}
-
-	var value uint64
-	for _, bb := range b {
-		value = (value << 8) | uint64(bb)
+	if p.name != "Counter" {
+		r.err = ErrInvalidPayloadDef
+		return
 	}
 
-	p.value.SetUint(value)
+	p.value.SetUint(readCounter(r))
 }
 
 func (rf *reflector) scanByteSlice(r *reader, p property, state *state) {
@@ -245,42 +280,15 @@ func (rf *reflector) scanUint32Slice(r *reader, p property, state *state) {
 		return
 	}
 
-	if p.name != "IndexOffsets" {
-		panic(errUnknownFieldType)
+	length, ok1 := state.rootUint("IndexedDataLength")
+	bits, ok2 := state.rootUint("BitsPerIndex")
+	if p.name != "IndexOffsets" || !ok1 || !ok2 {
+		r.err = ErrInvalidPayloadDef
+		return
 	}
 
-	sf := state.structStack.first()
-	length := uint32(sf.FieldByName("IndexedDataLength").Uint())
-	bits := uint32(sf.FieldByName("BitsPerIndex").Uint())
-
-	var offsets []uint32
-
-	ff := r.ConsumeAll()
-	switch bits {
-	case 8:
-		offsets = make([]uint32, 0, len(ff))
-		for _, f := range ff {
-			frac := uint32(f)
-			offset := (frac*length + (1 << 7)) >> 8
-			if offset > length {
-				offset = length
-			}
-			offsets = append(offsets, offset)
-		}
-
-	case 16:
-		offsets = make([]uint32, 0, len(ff)/2)
-		for ii := 0; ii < len(ff); ii += 2 {
-			frac := uint32(ff[ii])<<8 | uint32(ff[ii+1])
-			offset := (frac*length + (1 << 15)) >> 16
-			if offset > length {
-				offset = length
-			}
-			offsets = append(offsets, offset)
-		}
-
-	default:
-		r.err = ErrInvalidBits
+	offsets := rf.readIndexOffsets(r, uint32(length), uint32(bits))
+	if r.err != nil {
 		return
 	}
 
@@ -292,15 +300,15 @@ func (rf *reflector) scanStringSlice(r *reader, p property, state *state) {
 		return
 	}
 
-	sf := state.structStack.first()
-	enc := Encoding(sf.FieldByName("Encoding").Uint())
-	ss := r.ConsumeStrings(enc)
-	if r.err != nil {
+	enc, ok := state.rootUint("Encoding")
+	if !ok {
+		r.err = ErrInvalidPayloadDef
 		return
 	}
 
-	if rf.version < Version2_4 && len(ss) > 1 {
-		ss = ss[:1]
+	ss := rf.readStrings(r, Encoding(enc), state)
+	if r.err != nil {
+		return
 	}
 
 	p.value.Set(reflect.ValueOf(ss))
@@ -313,6 +321,10 @@ func (rf *reflector) scanStructSlice(r *reader, p property, state *state) {
 
 	elems := make([]reflect.Value, 0)
 	for i := 0; r.Len() > 0; i++ {
+		if r.err = checkLimit("MaxEntries", r.limits().MaxEntries, i+1); r.err != nil {
+			return
+		}
+
 		etyp := p.typ.Elem()
 		ep := property{
 			typ:   etyp,
@@ -320,11 +332,18 @@ func (rf *reflector) scanStructSlice(r *reader, p property, state *state) {
 			name:  fmt.Sprintf("%s[%d]", p.name, i),
 		}
 
+		n := r.Len()
 		rf.scanStruct(r, ep, state)
 		if r.err != nil {
 			return
 		}
 
+		// An element that consumes no data would repeat forever.
+		if r.Len() == n {
+			r.err = ErrInvalidPayloadDef
+			return
+		}
+
 		elems = append(elems, ep.value)
 	}
 
@@ -340,27 +359,23 @@ func (rf *reflector) scanString(r *reader, p property, state *state) {
 		return
 	}
 
-	switch p.name {
-	case "FrameID":
-		p.value.SetString(string(state.frameID))
-		return
-	case "Language":
-		str := r.ConsumeFixedLengthString(3, EncodingISO88591)
-		p.value.SetString(str)
-		return
-	}
-
-	var enc Encoding
-	switch p.typ.Name() {
-	case "WesternString":
-		enc = EncodingISO88591
+	var str string
+	switch {
+	case p.name == "FrameID":
+		str = state.frameID
+	case p.name == "Language":
+		str = r.ConsumeFixedLengthString(3, EncodingISO88591)
+	case p.typ.Name() == "WesternString":
+		str = readWesternString(r)
 	default:
-		sf := state.structStack.first()
-		enc = Encoding(sf.FieldByName("Encoding").Uint())
+		enc, ok := state.rootUint("Encoding")
+		if !ok {
+			r.err = ErrInvalidPayloadDef
+			return
+		}
+		str = readString(r, Encoding(enc))
 	}
 
-	str := r.ConsumeNextString(enc)
-
 	if r.err != nil {
 		return
 	}
@@ -376,14 +391,22 @@ func (rf *reflector) outputStruct(w *writer, p property, state *state) {
 	state.structStack.push(p.value)
 	if state.structStack.depth() == 1 {
 		state.fieldCount = p.typ.NumField()
+		if enc, ok := state.rootUint("Encoding"); ok {
+			latin1 := func() bool { return textIsLatin1(p.value) }
+			rf.selectOutputEncoding(w, Encoding(enc), latin1, state)
+		}
 	}
 
-	for i, n := 0, p.typ.NumField(); i < n; i++ {
+	for i, n := 0, p.typ.NumField(); i < n && w.err == nil; i++ {
 		if state.structStack.depth() == 1 {
 			state.fieldIndex = i
 		}
 
 		field := p.typ.Field(i)
+		state.field = fieldPath(p.name, field.Name)
+		if w.err = checkField(field); w.err != nil {
+			break
+		}
 
 		fp := property{
 			typ:   field.Type,
@@ -415,7 +438,7 @@ func (rf *reflector) outputStruct(w *writer, p property, state *state) {
 			case reflect.Struct:
 				rf.outputStructSlice(w, fp, state)
 			default:
-				panic(errUnknownFieldType)
+				w.err = ErrInvalidPayloadDef
 			}
 
 		case reflect.String:
@@ -425,7 +448,7 @@ func (rf *reflector) outputStruct(w *writer, p property, state *state) {
 			rf.outputStruct(w, fp, state)
 
 		default:
-			panic(errUnknownFieldType)
+			w.err = ErrInvalidPayloadDef
 		}
 	}
 
@@ -438,18 +461,11 @@ func (rf *reflector) outputUint8(w *writer, p property, state *state) {
 	}
 
 	value := uint8(p.value.Uint())
-
-	bounds, hasBounds := rf.vdata.bounds[p.name]
-
-	if hasBounds && (value < uint8(bounds.min) || value > uint8(bounds.max)) {
-		w.err = bounds.err
-		return
+	if p.name == "Encoding" && state.structStack.depth() == 1 {
+		value = uint8(state.encoding)
 	}
 
-	w.StoreByte(value)
-	if w.err != nil {
-		return
-	}
+	rf.writeUint8(w, p.name, value)
 }
 
 func (rf *reflector) outputUint16(w *writer, p property, state *state) {
@@ -461,19 +477,9 @@ func (rf *reflector) outputUint16(w *writer, p property, state *state) {
 
 	switch p.name {
 	case "BPM":
-		if v > 2*0xff {
-			w.err = ErrInvalidBPM
-			return
-		}
-		if v < 0xff {
-			w.StoreByte(uint8(v))
-		} else {
-			w.StoreByte(0xff)
-			w.StoreByte(uint8(v - 0xff))
-		}
+		writeBPM(w, v)
 	default:
-		b := []byte{byte(v >> 8), byte(v)}
-		w.StoreBytes(b)
+		writeUint16(w, v)
 	}
 }
 
@@ -482,10 +488,7 @@ func (rf *reflector) outputUint32(w *writer, p property, state *state) {
 		return
 	}
 
-	v := uint32(p.value.Uint())
-	b := []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
-
-	w.StoreBytes(b)
+	writeUint32(w, uint32(p.value.Uint()))
 }
 
 func (rf *reflector) outputUint64(w *writer, p property, state *state) {
@@ -493,24 +496,12 @@ func (rf *reflector) outputUint64(w *writer, p property, state *state) {
 		return
 	}
 
-	v := p.value.Uint()
-
-	switch p.name {
-	case "Counter":
-		b := make([]byte, 0, 4)
-		for v != 0 {
-			b = append(b, byte(v&0xff))
-			v = v >> 8
-		}
-		for len(b) < 4 {
-			b = append(b, 0)
-		}
-		for i := len(b) - 1; i >= 0; i-- {
-			w.StoreByte(b[i])
-		}
-	default:
-		panic(errUnknownFieldType)
+	if p.name != "Counter" {
+		w.err = ErrInvalidPayloadDef
+		return
 	}
+
+	writeCounter(w, p.value.Uint())
 }
 
 func (rf *reflector) outputUint32Slice(w *writer, p property, state *state) {
@@ -518,42 +509,16 @@ func (rf *reflector) outputUint32Slice(w *writer, p property, state *state) {
 		return
 	}
 
-	if p.name != "IndexOffsets" {
-		panic(errUnknownFieldType)
+	length, ok1 := state.rootUint("IndexedDataLength")
+	bits, ok2 := state.rootUint("BitsPerIndex")
+	if p.name != "IndexOffsets" || !ok1 || !ok2 {
+		w.err = ErrInvalidPayloadDef
+		return
 	}
 
-	sf := state.structStack.first()
-	length := uint32(sf.FieldByName("IndexedDataLength").Uint())
-	bits := uint32(sf.FieldByName("BitsPerIndex").Uint())
-
-	n := p.value.Len()
-	slice := p.value.Slice(0, n)
-
-	switch bits {
-	case 8:
-		for i := 0; i < n; i++ {
-			offset := uint32(slice.Index(i).Uint())
-			frac := (offset << 8) / length
-			if frac >= (1 << 8) {
-				frac = (1 << 8) - 1
-			}
-			w.StoreByte(byte(frac))
-		}
-
-	case 16:
-		for i := 0; i < n; i++ {
-			offset := uint32(slice.Index(i).Uint())
-			frac := (offset << 16) / length
-			if frac >= (1 << 16) {
-				frac = (1 << 16) - 1
-			}
-			b := []byte{byte(frac >> 8), byte(frac)}
-			w.StoreBytes(b)
-		}
-
-	default:
-		w.err = ErrInvalidBits
-	}
+	var offsets []uint32
+	reflect.ValueOf(&offsets).Elem().Set(p.value)
+	rf.writeIndexOffsets(w, offsets, uint32(length), uint32(bits))
 }
 
 func (rf *reflector) outputByteSlice(w *writer, p property, state *state) {
@@ -571,17 +536,14 @@ func (rf *reflector) outputStringSlice(w *writer, p property, state *state) {
 		return
 	}
 
-	sf := state.structStack.first()
-	enc := Encoding(sf.FieldByName("Encoding").Uint())
+	if _, ok := state.rootUint("Encoding"); !ok {
+		w.err = ErrInvalidPayloadDef
+		return
+	}
 
 	var ss []string
 	reflect.ValueOf(&ss).Elem().Set(p.value)
-
-	if rf.version < Version2_4 && len(ss) > 1 {
-		ss = ss[:1]
-	}
-
-	w.StoreStrings(ss, enc)
+	rf.writeStrings(w, ss, state)
 }
 
 func (rf *reflector) outputStructSlice(w *writer, p property, state *state) {
@@ -615,26 +577,107 @@ func (rf *reflector) outputString(w *writer, p property, state *state) {
 
 	v := p.value.String()
 
-	switch p.name {
-	case "FrameID":
+	// Always terminate strings unless they are the last struct field
+	// of the root level struct.
+	term := state.structStack.depth() > 1 || (state.fieldIndex != state.fieldCount-1)
+
+	switch {
+	case p.name == "FrameID":
 		state.frameID = v
-		return
-	case "Language":
+	case p.name == "Language":
 		w.StoreFixedLengthString(v, 3, EncodingISO88591)
-		return
+	case p.typ.Name() == "WesternString":
+		rf.writeWesternString(w, v, term, state)
+	default:
+		if _, ok := state.rootUint("Encoding"); !ok {
+			w.err = ErrInvalidPayloadDef
+			return
+		}
+		rf.writeString(w, v, term, state)
 	}
+}
 
-	var enc Encoding
-	switch p.typ.Name() {
-	case "WesternString":
-		enc = EncodingISO88591
-	default:
-		sf := state.structStack.first()
-		enc = Encoding(sf.FieldByName("Encoding").Uint())
+// sliceTypes holds the slice types the reflector scans and outputs, keyed
+// by the kind of their elements. Slices of structs are also supported.
+var sliceTypes = map[reflect.Kind]reflect.Type{
+	reflect.Uint8:  reflect.TypeOf([]byte{}),
+	reflect.Uint32: reflect.TypeOf([]uint32{}),
+	reflect.String: reflect.TypeOf([]string{}),
+}
+
+// checkField returns ErrInvalidPayloadDef if a frame struct field has a
+// type the reflector can't scan or output, or if it isn't exported.
+func checkField(field reflect.StructField) error {
+	if field.PkgPath != "" {
+		return ErrInvalidPayloadDef
 	}
 
-	// Always terminate strings unless they are the last struct field
-	// of the root level struct.
-	term := state.structStack.depth() > 1 || (state.fieldIndex != state.fieldCount-1)
-	w.StoreString(v, enc, term)
+	switch field.Type.Kind() {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.String, reflect.Struct:
+		return nil
+
+	case reflect.Slice:
+		elem := field.Type.Elem().Kind()
+		if elem == reflect.Struct {
+			return nil
+		}
+		if st, ok := sliceTypes[elem]; ok && st.AssignableTo(field.Type) && field.Type.AssignableTo(st) {
+			return nil
+		}
+	}
+	return ErrInvalidPayloadDef
+}
+
+// fieldPath returns the name of a field within a struct property, as
+// reported in errors.
+func fieldPath(parent, field string) string {
+	if parent == "" {
+		return field
+	}
+	return parent + "." + field
+}
+
+// textIsLatin1 returns true if all of the encoded text fields of a frame
+// struct can be represented in ISO-8859-1.
+func textIsLatin1(v reflect.Value) bool {
+	latin1 := true
+	visitTextFields(v, "", func(name string, s reflect.Value) {
+		if latin1 && !isLatin1(s.String()) {
+			latin1 = false
+		}
+	})
+	return latin1
+}
+
+// visitTextFields calls fn for each encoded text field of a frame struct,
+// including the strings within string slices and struct slices. Fields
+// holding a WesternString, a language code or a frame ID are not encoded
+// using the frame's encoding and are skipped.
+func visitTextFields(v reflect.Value, prefix string, fn func(name string, s reflect.Value)) {
+	t := v.Type()
+	for i, n := 0, t.NumField(); i < n; i++ {
+		field := t.Field(i)
+		fv := v.Field(i)
+		name := prefix + field.Name
+
+		switch field.Type.Kind() {
+		case reflect.String:
+			if isEncodedTextField(field) {
+				fn(name, fv)
+			}
+
+		case reflect.Slice:
+			switch field.Type.Elem().Kind() {
+			case reflect.String:
+				for j := 0; j < fv.Len(); j++ {
+					fn(fmt.Sprintf("%s[%d]", name, j), fv.Index(j))
+				}
+			case reflect.Struct:
+				for j := 0; j < fv.Len(); j++ {
+					visitTextFields(fv.Index(j), fmt.Sprintf("%s[%d].", name, j), fn)
+				}
+			}
+		}
+	}
 }
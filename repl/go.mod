@@ -0,0 +1,7 @@
+module github.com/beevik/id3/repl
+
+go 1.25.0
+
+require github.com/beevik/id3 v0.0.0
+
+replace github.com/beevik/id3 => ../
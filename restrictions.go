@@ -0,0 +1,190 @@
+package id3
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"unicode/utf8"
+)
+
+// Restrictions describe the limits a v2.4 tag promises to respect, as
+// stored in the tag's extended header when the TagFlagHasRestrictions flag
+// is set. They allow tags to be prepared for devices with limited memory
+// or decoding capabilities.
+type Restrictions struct {
+	TagSize       TagSizeRestriction   // Maximum number of frames and tag size
+	TextEncoding  bool                 // Text limited to ISO-8859-1 and UTF-8
+	TextSize      TextSizeRestriction  // Maximum characters per text string
+	ImageEncoding bool                 // Images limited to PNG and JPEG
+	ImageSize     ImageSizeRestriction // Maximum image dimensions
+}
+
+// TagSizeRestriction limits the number of frames in a tag and its total
+// size.
+type TagSizeRestriction uint8
+
+// All possible TagSizeRestriction values.
+const (
+	TagSize128Frames1MB  TagSizeRestriction = iota // At most 128 frames and 1MB
+	TagSize64Frames128KB                           // At most 64 frames and 128KB
+	TagSize32Frames40KB                            // At most 32 frames and 40KB
+	TagSize32Frames4KB                             // At most 32 frames and 4KB
+)
+
+// MaxFrames returns the maximum number of frames a tag may contain.
+func (r TagSizeRestriction) MaxFrames() int {
+	return [...]int{128, 64, 32, 32}[r&3]
+}
+
+// MaxSize returns the maximum size of a tag in bytes, including its
+// header.
+func (r TagSizeRestriction) MaxSize() int {
+	return [...]int{1024 * 1024, 128 * 1024, 40 * 1024, 4 * 1024}[r&3]
+}
+
+// TextSizeRestriction limits the number of characters in each text
+// string.
+type TextSizeRestriction uint8
+
+// All possible TextSizeRestriction values.
+const (
+	TextSizeUnrestricted TextSizeRestriction = iota // No limit
+	TextSize1024                                    // At most 1024 characters
+	TextSize128                                     // At most 128 characters
+	TextSize30                                      // At most 30 characters
+)
+
+// MaxChars returns the maximum number of characters in a text string, or
+// zero if there is no limit.
+func (r TextSizeRestriction) MaxChars() int {
+	return [...]int{0, 1024, 128, 30}[r&3]
+}
+
+// ImageSizeRestriction limits the dimensions of attached pictures.
+type ImageSizeRestriction uint8
+
+// All possible ImageSizeRestriction values.
+const (
+	ImageSizeUnrestricted ImageSizeRestriction = iota // No limit
+	ImageSize256                                      // At most 256x256 pixels
+	ImageSize64                                       // At most 64x64 pixels
+	ImageSizeExactly64                                // Exactly 64x64 pixels
+)
+
+// Allows returns true if an image with the requested dimensions satisfies
+// the restriction.
+func (r ImageSizeRestriction) Allows(width, height int) bool {
+	switch r & 3 {
+	case ImageSize256:
+		return width <= 256 && height <= 256
+	case ImageSize64:
+		return width <= 64 && height <= 64
+	case ImageSizeExactly64:
+		return width == 64 && height == 64
+	default:
+		return true
+	}
+}
+
+// decodeRestrictions decodes the restrictions byte of a v2.4 extended
+// header, laid out as %ppqrrstt.
+func decodeRestrictions(b uint8) Restrictions {
+	return Restrictions{
+		TagSize:       TagSizeRestriction(b >> 6),
+		TextEncoding:  (b & 0x20) != 0,
+		TextSize:      TextSizeRestriction((b >> 3) & 3),
+		ImageEncoding: (b & 0x04) != 0,
+		ImageSize:     ImageSizeRestriction(b & 3),
+	}
+}
+
+// encode returns the restrictions byte of a v2.4 extended header.
+func (r Restrictions) encode() uint8 {
+	b := uint8(r.TagSize&3)<<6 | uint8(r.TextSize&3)<<3 | uint8(r.ImageSize&3)
+	if r.TextEncoding {
+		b |= 0x20
+	}
+	if r.ImageEncoding {
+		b |= 0x04
+	}
+	return b
+}
+
+// textEncoding returns the encoding used in place of enc when the
+// restrictions limit text to ISO-8859-1 and UTF-8.
+func (r *Restrictions) textEncoding(enc Encoding) Encoding {
+	if r.TextEncoding && (enc == EncodingUTF16BOM || enc == EncodingUTF16) {
+		return EncodingUTF8
+	}
+	return enc
+}
+
+// truncateText truncates a string to the number of characters allowed by
+// the restrictions.
+func (r *Restrictions) truncateText(s string) string {
+	max := r.TextSize.MaxChars()
+	if max == 0 || utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	n := 0
+	for i := range s {
+		if n == max {
+			return s[:i]
+		}
+		n++
+	}
+	return s
+}
+
+// checkPicture returns an error if an attached picture violates the
+// restrictions.
+func (r *Restrictions) checkPicture(f *FrameAttachedPicture) error {
+	if !r.ImageEncoding && r.ImageSize == ImageSizeUnrestricted {
+		return nil
+	}
+
+	format := pictureFormat(f)
+	if r.ImageEncoding && format == "" {
+		return ErrRestrictedImageFormat
+	}
+	if r.ImageSize != ImageSizeUnrestricted {
+		cfg, ok := pictureConfig(f.Data, format)
+		if !ok || !r.ImageSize.Allows(cfg.Width, cfg.Height) {
+			return ErrRestrictedImageSize
+		}
+	}
+	return nil
+}
+
+// pictureFormat returns "png" or "jpeg" if an attached picture holds an
+// image in one of these formats, according to both its MIME type and its
+// data. Otherwise it returns the empty string.
+func pictureFormat(f *FrameAttachedPicture) string {
+	switch f.MimeType {
+	case "image/png":
+		if bytes.HasPrefix(f.Data, []byte("\x89PNG\r\n\x1a\n")) {
+			return "png"
+		}
+	case "image/jpeg", "image/jpg":
+		if bytes.HasPrefix(f.Data, []byte{0xff, 0xd8}) {
+			return "jpeg"
+		}
+	}
+	return ""
+}
+
+// pictureConfig returns the dimensions of a PNG or JPEG image.
+func pictureConfig(data []byte, format string) (image.Config, bool) {
+	var cfg image.Config
+	var err error
+	switch format {
+	case "png":
+		cfg, err = png.DecodeConfig(bytes.NewReader(data))
+	case "jpeg":
+		cfg, err = jpeg.DecodeConfig(bytes.NewReader(data))
+	default:
+		return cfg, false
+	}
+	return cfg, err == nil
+}
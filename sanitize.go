@@ -0,0 +1,161 @@
+package id3
+
+import (
+	"reflect"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// SanitizeFlags select the clean-up steps applied to the text of a tag's
+// frames. Sanitization can be applied while decoding (see DecodeOptions),
+// while encoding (see EncodeOptions), or directly using Tag.Sanitize. It
+// applies to every encoded text field of every frame, including text
+// frames, comments, lyrics and descriptions. WesternString fields,
+// language codes and frame IDs are not affected.
+type SanitizeFlags uint8
+
+// All possible SanitizeFlags.
+const (
+	SanitizeNFC        SanitizeFlags = 1 << iota // Normalize text to Unicode NFC
+	SanitizeControls                             // Strip control characters and embedded BOMs
+	SanitizeTrim                                 // Trim trailing nulls and whitespace
+	SanitizeDuplicates                           // Remove duplicate values from multi-value fields
+
+	SanitizeAll = SanitizeNFC | SanitizeControls | SanitizeTrim | SanitizeDuplicates
+)
+
+// Sanitize applies the requested clean-up steps to the text of all of the
+// tag's frames. If the text of a read-only frame would change, no frames
+// are modified and a ReadOnlyError is returned, unless the EditForce
+// option is given.
+func (t *Tag) Sanitize(flags SanitizeFlags, opts ...EditOption) error {
+	if flags == 0 {
+		return nil
+	}
+
+	var values []reflect.Value
+	for _, f := range t.Frames {
+		if _, err := HeaderOfChecked(f); err != nil {
+			continue
+		}
+		v := reflect.ValueOf(f).Elem()
+
+		// Read-only frames are acceptable as long as sanitizing them
+		// changes nothing.
+		if err := checkWritable(f, opts); err != nil {
+			c := reflect.New(v.Type()).Elem()
+			c.Set(v)
+			sanitizeStruct(c, flags)
+			if !reflect.DeepEqual(c.Interface(), v.Interface()) {
+				return err
+			}
+		}
+		values = append(values, v)
+	}
+
+	for _, v := range values {
+		sanitizeStruct(v, flags)
+	}
+	return nil
+}
+
+// sanitizeStruct sanitizes the encoded text fields of a frame struct,
+// including those within struct slices. Slices are replaced rather than
+// modified in place, so a shallow copy of a struct may be sanitized
+// without affecting the original.
+func sanitizeStruct(v reflect.Value, flags SanitizeFlags) {
+	t := v.Type()
+	for i, n := 0, t.NumField(); i < n; i++ {
+		field := t.Field(i)
+		fv := v.Field(i)
+
+		switch field.Type.Kind() {
+		case reflect.String:
+			if isEncodedTextField(field) {
+				fv.SetString(sanitizeString(fv.String(), flags))
+			}
+
+		case reflect.Slice:
+			switch field.Type.Elem().Kind() {
+			case reflect.String:
+				var ss []string
+				reflect.ValueOf(&ss).Elem().Set(fv)
+				fv.Set(reflect.ValueOf(sanitizeStrings(ss, flags)))
+			case reflect.Struct:
+				if fv.IsNil() {
+					continue
+				}
+				c := reflect.MakeSlice(fv.Type(), fv.Len(), fv.Len())
+				reflect.Copy(c, fv)
+				for j := 0; j < c.Len(); j++ {
+					sanitizeStruct(c.Index(j), flags)
+				}
+				fv.Set(c)
+			}
+		}
+	}
+}
+
+// isEncodedTextField returns true if a string field of a frame struct is
+// encoded using the frame's text encoding.
+func isEncodedTextField(field reflect.StructField) bool {
+	switch {
+	case field.Type.Name() == "WesternString":
+		return false
+	case field.Name == "FrameID" || field.Name == "Language":
+		return false
+	default:
+		return true
+	}
+}
+
+// sanitizeStrings sanitizes each of the values of a multi-value field
+// and, if requested, removes duplicate values. It returns a new slice.
+func sanitizeStrings(ss []string, flags SanitizeFlags) []string {
+	if ss == nil || flags == 0 {
+		return ss
+	}
+
+	values := make([]string, 0, len(ss))
+	seen := make(map[string]bool, len(ss))
+	for _, s := range ss {
+		s = sanitizeString(s, flags)
+		if (flags&SanitizeDuplicates) != 0 && seen[s] {
+			continue
+		}
+		seen[s] = true
+		values = append(values, s)
+	}
+	return values
+}
+
+// sanitizeString applies the requested clean-up steps to a single string.
+func sanitizeString(s string, flags SanitizeFlags) string {
+	if (flags & SanitizeControls) != 0 {
+		s = strings.Map(func(r rune) rune {
+			switch {
+			case r == '\t' || r == '\n' || r == '\r':
+				return r
+			case r == bomRune || r == 0xfffe || unicode.IsControl(r):
+				return -1
+			default:
+				return r
+			}
+		}, s)
+	}
+	if (flags & SanitizeTrim) != 0 {
+		s = strings.TrimRightFunc(s, func(r rune) bool {
+			return r == 0 || unicode.IsSpace(r)
+		})
+	}
+	if (flags & SanitizeNFC) != 0 {
+		s = norm.NFC.String(s)
+	}
+	return s
+}
+
+// bomRune is the byte order mark, which sometimes appears within strings
+// produced by tools that concatenate UTF-16 text without removing it.
+const bomRune = 0xfeff
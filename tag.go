@@ -2,17 +2,22 @@ package id3
 
 import (
 	"io"
+	"reflect"
 )
 
 // A Tag represents an entire ID3 tag, including zero or more frames.
 type Tag struct {
-	Version      Version  // ID3 codec version (2.2, 2.3, or 2.4)
-	Flags        TagFlags // Flags
-	Size         int      // Size not including the header
-	Padding      int      // Number of bytes of padding
-	CRC          uint32   // Optional CRC code
-	Restrictions uint8    // ID3 restrictions (v2.4 only)
-	Frames       []Frame  // All ID3 frames included in the tag
+	Version      Version      // ID3 codec version (2.2, 2.3, or 2.4)
+	Flags        TagFlags     // Flags
+	Size         int          // Size not including the header
+	Padding      int          // Number of bytes of padding
+	CRC          uint32       // Optional CRC code
+	Restrictions Restrictions // ID3 restrictions (v2.4 only)
+	Frames       []Frame      // All ID3 frames included in the tag
+	Warnings     []error      // Problems tolerated while decoding in lenient mode
+	Discarded    []Frame      // Frames discarded by the last alteration
+
+	snap *tagSnapshot // state of the tag when last read or written
 }
 
 // TagFlags describe flags that may appear within an ID3 tag. Not all
@@ -77,10 +82,144 @@ func PeekTag(b []byte) (version Version, size int, err error) {
 	return Version(b[3]), int(sz + 10), nil
 }
 
+// DecodeOptions control how a tag is decoded.
+type DecodeOptions struct {
+	// MultiValueSeparators lists separators used to split the values of
+	// v2.2 and v2.3 text frames, which don't support null-separated values
+	// and therefore commonly join multiple values with strings like "/" or
+	// "; ". Only frames that typically hold lists of names (e.g., artists,
+	// composers and lyricists) are split. If empty, values are not split.
+	MultiValueSeparators []string
+
+	// LenientUTF16 causes unpaired UTF-16 surrogates to be replaced by the
+	// Unicode replacement character instead of failing with ErrInvalidText.
+	LenientUTF16 bool
+
+	// Sanitize selects clean-up steps applied to the text of each frame
+	// as it is decoded.
+	Sanitize SanitizeFlags
+
+	// Lenient causes the decoder to tolerate common problems found in
+	// real-world tags instead of failing. v2.4 frame sizes that aren't
+	// sync-safe are detected, tags whose size excludes the extended header
+	// are extended, padding containing non-zero bytes is accepted, a
+	// failed CRC check is ignored, and frames whose payloads can't be
+	// decoded are kept as FrameUnknown frames. Each problem is recorded
+	// in the tag's Warnings.
+	Lenient bool
+
+	// Limits bound the resources used to decode the tag. The zero value
+	// imposes no limits; DefaultDecodeLimits are suitable for decoding
+	// untrusted files.
+	Limits DecodeLimits
+}
+
+// EncodeOptions control how a tag is encoded.
+type EncodeOptions struct {
+	// MultiValueSeparator is used to join the values of a text frame
+	// holding multiple values when encoding a v2.2 or v2.3 tag, which
+	// doesn't support null-separated values. If empty, "/" is used.
+	MultiValueSeparator string
+
+	// TextEncoding selects how the text encoding of each frame is chosen.
+	TextEncoding EncodingPolicy
+
+	// UnicodeEncoding is the encoding chosen for v2.4 frames whose text
+	// can't be represented in ISO-8859-1. Versions prior to v2.4 always use
+	// UTF-16 with a byte order mark. If zero, UTF-8 is used.
+	UnicodeEncoding Encoding
+
+	// UTF16ByteOrder is the byte order used for strings encoded as UTF-16
+	// with a byte order mark. If ByteOrderDefault, each frame's
+	// Header.ByteOrder is used, so that frames decoded from little-endian
+	// text are encoded the same way. Strings encoded as UTF-16 without a
+	// byte order mark are always big endian.
+	UTF16ByteOrder ByteOrder
+
+	// Latin1 selects how text that ISO-8859-1 can't represent is handled
+	// when it must be stored as ISO-8859-1, as with WesternString fields
+	// or frames encoded with EncodingPolicyPreserve.
+	Latin1 Latin1Mode
+
+	// Sanitize selects clean-up steps applied to the text of each frame
+	// as it is encoded. The tag itself is not modified.
+	Sanitize SanitizeFlags
+
+	// ApplyRestrictions causes a v2.4 tag with the TagFlagHasRestrictions
+	// flag to be encoded so that it conforms to its Restrictions. Text
+	// is truncated to the allowed number of characters and UTF-16 text is
+	// re-encoded as UTF-8. Padding is reduced to fit the allowed tag size.
+	// Attached pictures that aren't PNG or JPEG images of the allowed
+	// dimensions, and tags with too many frames or too much data, fail
+	// with an error. The tag itself is not modified.
+	ApplyRestrictions bool
+
+	// PreserveDiscardable causes unknown frames flagged with
+	// FrameFlagDiscardOnTagAlteration to be written even if the tag was
+	// altered since it was read. Otherwise, such frames are removed from
+	// the tag and recorded in its Discarded list.
+	PreserveDiscardable bool
+
+	// DiscardKnownFrames causes frames of known types flagged with
+	// FrameFlagDiscardOnTagAlteration to be discarded from an altered tag
+	// as well. The ID3 specification asks only software that doesn't know
+	// a frame's type to discard it, so by default such frames are kept.
+	DiscardKnownFrames bool
+}
+
+// An EncodingPolicy describes how the encoder chooses the text encoding of
+// each frame. Only encodings allowed by the tag's version are ever chosen
+// automatically: ISO-8859-1 and UTF-16 with BOM for v2.2 and v2.3, and all
+// four encodings for v2.4.
+type EncodingPolicy uint8
+
+// All possible EncodingPolicy values.
+const (
+	// EncodingPolicyLegalize keeps each frame's Encoding if the tag's
+	// version allows it and it can represent the frame's text. Otherwise,
+	// an encoding is chosen as with EncodingPolicyAuto.
+	EncodingPolicyLegalize EncodingPolicy = iota
+
+	// EncodingPolicyAuto ignores each frame's Encoding and chooses
+	// ISO-8859-1 if the frame's text allows it, UTF-16 with BOM for
+	// v2.2 and v2.3, or EncodeOptions.UnicodeEncoding for v2.4.
+	EncodingPolicyAuto
+
+	// EncodingPolicyPreserve always uses each frame's Encoding, failing
+	// with an error if the tag's version doesn't allow it or it can't
+	// represent the frame's text.
+	EncodingPolicyPreserve
+)
+
+// A Latin1Mode describes how the encoder handles text that must be stored
+// as ISO-8859-1 but contains characters ISO-8859-1 can't represent.
+type Latin1Mode uint8
+
+// All possible Latin1Mode values.
+const (
+	// Latin1Strict fails with a LossyEncodingError.
+	Latin1Strict Latin1Mode = iota
+
+	// Latin1Replace replaces each unrepresentable character with '.'.
+	Latin1Replace
+
+	// Latin1Transliterate replaces each unrepresentable character with
+	// its closest ISO-8859-1 equivalent (e.g., "Ł" becomes "L" and smart
+	// quotes become ASCII quotes), or '.' if there is none.
+	Latin1Transliterate
+)
+
 // ReadFrom reads from a stream into an ID3 tag. It returns the number of
 // bytes read and any error encountered during decoding.
 func (t *Tag) ReadFrom(r io.Reader) (int64, error) {
-	rr := newReader(r)
+	return t.ReadFromWithOptions(r, DecodeOptions{})
+}
+
+// ReadFromWithOptions reads from a stream into an ID3 tag using the
+// requested decoding options. It returns the number of bytes read and any
+// error encountered during decoding.
+func (t *Tag) ReadFromWithOptions(r io.Reader, opts DecodeOptions) (int64, error) {
+	rr := newReader(r, &opts)
 
 	// Read 3 bytes to check for the ID3 file id.
 	if rr.Load(3); rr.err != nil {
@@ -102,14 +241,29 @@ func (t *Tag) ReadFrom(r io.Reader) (int64, error) {
 	}
 
 	// Decode the rest of the tag.
+	t.Warnings, t.Discarded, t.snap = nil, nil, nil
 	err = c.Decode(t, rr)
+	if err == nil {
+		t.snapshot()
+	}
 	return int64(rr.n), err
 }
 
 // WriteTo writes an ID3 tag to an output stream. It returns the number of
 // bytes written and any error encountered during encoding.
 func (t *Tag) WriteTo(w io.Writer) (int64, error) {
-	ww := newWriter(w)
+	return t.WriteToWithOptions(w, EncodeOptions{})
+}
+
+// WriteToWithOptions writes an ID3 tag to an output stream using the
+// requested encoding options. It returns the number of bytes written and
+// any error encountered during encoding.
+func (t *Tag) WriteToWithOptions(w io.Writer, opts EncodeOptions) (int64, error) {
+	if opts.MultiValueSeparator == "" {
+		opts.MultiValueSeparator = "/"
+	}
+
+	ww := newWriter(w, &opts)
 
 	// Select a codec based on the ID3 version.
 	c, err := newCodec(t.Version)
@@ -117,15 +271,69 @@ func (t *Tag) WriteTo(w io.Writer) (int64, error) {
 		return 0, err
 	}
 
+	frames := t.Frames
+	var discarded []Frame
+	t.Frames, discarded = t.framesToWrite(&opts)
+
 	err = c.Encode(t, ww)
-	return int64(ww.n), err
+	if err != nil {
+		t.Frames = frames
+		return int64(ww.n), err
+	}
+
+	t.Discarded = discarded
+	t.snapshot()
+	return int64(ww.n), nil
+}
+
+// framesToWrite returns the frames written when the tag is encoded with
+// the options, and the frames left out. Unknown frames flagged for
+// discarding when the tag is altered are not written if the tag was
+// altered since it was read.
+func (t *Tag) framesToWrite(opts *EncodeOptions) (frames, discarded []Frame) {
+	if opts.PreserveDiscardable || !t.Altered() {
+		return t.Frames, nil
+	}
+	return partitionFrames(t.Frames, func(f Frame) bool {
+		if (headerOf(f).Flags & FrameFlagDiscardOnTagAlteration) == 0 {
+			return false
+		}
+		_, unknown := f.(*FrameUnknown)
+		return unknown || opts.DiscardKnownFrames
+	})
+}
+
+// encodedSize returns the number of bytes the tag occupies when written
+// with default options. The encoder updates the headers of the frames it
+// writes, so the tag is encoded from copies of itself and its frames.
+func (t *Tag) encodedSize() (int, error) {
+	c, err := newCodec(t.Version)
+	if err != nil {
+		return 0, err
+	}
+
+	frames, _ := t.framesToWrite(&EncodeOptions{})
+	tt := *t
+	tt.Frames = make([]Frame, len(frames))
+	for i, f := range frames {
+		tt.Frames[i] = f
+		if _, err := HeaderOfChecked(f); err == nil {
+			v := reflect.New(reflect.TypeOf(f).Elem())
+			v.Elem().Set(reflect.ValueOf(f).Elem())
+			tt.Frames[i] = v.Interface().(Frame)
+		}
+	}
+
+	w := newWriter(io.Discard, &EncodeOptions{MultiValueSeparator: "/"})
+	err = c.Encode(&tt, w)
+	return w.n, err
 }
 
 // FindFrame searches the tag's frames for the first frame of the requested
 // type and returns it. If no frame is found, it returns nil.
 func (t *Tag) FindFrame(typ FrameType) Frame {
 	for _, f := range t.Frames {
-		if HeaderOf(f).FrameType == typ {
+		if headerOf(f).FrameType == typ {
 			return f
 		}
 	}
@@ -137,19 +345,162 @@ func (t *Tag) FindFrame(typ FrameType) Frame {
 func (t *Tag) FindFrames(typ FrameType) []Frame {
 	ff := []Frame{}
 	for _, f := range t.Frames {
-		if HeaderOf(f).FrameType == typ {
+		if headerOf(f).FrameType == typ {
 			ff = append(ff, f)
 		}
 	}
 	return ff
 }
 
-// RemoveFrames removes all frames of the requested type from the tag.
-func (t *Tag) RemoveFrames(typ FrameType) {
+// An EditOption modifies the behavior of the tag's editing functions.
+type EditOption uint8
+
+// All possible EditOption values.
+const (
+	// EditForce allows frames flagged with FrameFlagReadOnly to be
+	// modified or removed.
+	EditForce EditOption = iota + 1
+)
+
+// checkWritable returns a ReadOnlyError if the frame is flagged read-only
+// and the EditForce option wasn't given.
+func checkWritable(f Frame, opts []EditOption) error {
+	if (headerOf(f).Flags & FrameFlagReadOnly) == 0 {
+		return nil
+	}
+	for _, o := range opts {
+		if o == EditForce {
+			return nil
+		}
+	}
+	return &ReadOnlyError{FrameID: headerOf(f).FrameID, Frame: f}
+}
+
+// RemoveFrames removes all frames of the requested type from the tag. If
+// any of them is read-only, no frames are removed and a ReadOnlyError is
+// returned, unless the EditForce option is given.
+func (t *Tag) RemoveFrames(typ FrameType, opts ...EditOption) error {
+	for _, f := range t.Frames {
+		if headerOf(f).FrameType == typ {
+			if err := checkWritable(f, opts); err != nil {
+				return err
+			}
+		}
+	}
 	for i := 0; i < len(t.Frames); i++ {
-		if HeaderOf(t.Frames[i]).FrameType == typ {
-			t.Frames = append(t.Frames[:i], t.Frames[i+1:])
+		if headerOf(t.Frames[i]).FrameType == typ {
+			t.Frames = append(t.Frames[:i], t.Frames[i+1:]...)
 			i--
 		}
 	}
+	return nil
+}
+
+// RemoveFrame removes a single frame from the tag. It returns
+// ErrInvalidFrameStruct if f isn't a pointer to a frame struct,
+// ErrFrameNotFound if the frame isn't in the tag, or a ReadOnlyError if
+// the frame is read-only and the EditForce option isn't given.
+func (t *Tag) RemoveFrame(f Frame, opts ...EditOption) error {
+	if _, err := HeaderOfChecked(f); err != nil {
+		return err
+	}
+	i := t.frameIndex(f)
+	if i < 0 {
+		return ErrFrameNotFound
+	}
+	if err := checkWritable(f, opts); err != nil {
+		return err
+	}
+	t.Frames = append(t.Frames[:i], t.Frames[i+1:]...)
+	return nil
+}
+
+// ReplaceFrame replaces a frame of the tag with a new frame, keeping its
+// position. It returns ErrInvalidFrameStruct if old isn't a pointer to a
+// frame struct, ErrFrameNotFound if the old frame isn't in the tag, or a
+// ReadOnlyError if the old frame is read-only and the EditForce option
+// isn't given.
+func (t *Tag) ReplaceFrame(old, f Frame, opts ...EditOption) error {
+	if _, err := HeaderOfChecked(old); err != nil {
+		return err
+	}
+	i := t.frameIndex(old)
+	if i < 0 {
+		return ErrFrameNotFound
+	}
+	if err := checkWritable(old, opts); err != nil {
+		return err
+	}
+	t.Frames[i] = f
+	return nil
+}
+
+// SetText stores a string into the text frame of the requested type,
+// adding the frame if necessary. It returns a ReadOnlyError if the
+// existing frame is read-only and the EditForce option isn't given.
+func (t *Tag) SetText(typ FrameType, s string, opts ...EditOption) error {
+	return t.SetTextValues(typ, []string{s}, opts...)
+}
+
+// SetTextValues stores one or more strings into the text frame of the
+// requested type, adding the frame if necessary. If no strings are
+// provided, all frames of the requested type are removed. It returns a
+// ReadOnlyError if an affected frame is read-only and the EditForce option
+// isn't given.
+func (t *Tag) SetTextValues(typ FrameType, ss []string, opts ...EditOption) error {
+	if len(ss) == 0 {
+		return t.RemoveFrames(typ, opts...)
+	}
+	if ft := t.textFrame(typ); ft != nil {
+		if err := checkWritable(ft, opts); err != nil {
+			return err
+		}
+		ft.Text = ss
+		return nil
+	}
+	f := NewFrameText(typ, "")
+	f.Text = ss
+	t.Frames = append(t.Frames, f)
+	return nil
+}
+
+// frameIndex returns the index of a frame within the tag, or -1 if the
+// tag doesn't contain the frame. The frame must be a pointer, so that
+// comparing it with frames that aren't comparable can't panic.
+func (t *Tag) frameIndex(f Frame) int {
+	for i := range t.Frames {
+		if t.Frames[i] == f {
+			return i
+		}
+	}
+	return -1
+}
+
+// textFrame returns the first text frame of the requested type, or nil if
+// the tag contains no such frame.
+func (t *Tag) textFrame(typ FrameType) *FrameText {
+	for _, f := range t.Frames {
+		if ft, ok := f.(*FrameText); ok && ft.Header.FrameType == typ {
+			return ft
+		}
+	}
+	return nil
+}
+
+// text returns the first string of the first text frame of the requested
+// type. If there is no such frame, it returns false.
+func (t *Tag) text(typ FrameType) (string, bool) {
+	ft := t.textFrame(typ)
+	if ft == nil || len(ft.Text) == 0 {
+		return "", false
+	}
+	return ft.Text[0], true
+}
+
+// setText stores one or more strings into the text frame of the requested
+// type, adding the frame if necessary. If no strings are provided, all
+// frames of the requested type are removed. Read-only frames are never
+// modified.
+func (t *Tag) setText(typ FrameType, ss ...string) error {
+	return t.SetTextValues(typ, ss)
 }
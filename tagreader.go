@@ -0,0 +1,347 @@
+package id3
+
+import (
+	"bytes"
+	"io"
+)
+
+// A TagReader provides random access to the frames of an ID3 tag stored
+// in an io.ReaderAt, such as an open file. Creating a TagReader reads only
+// the tag's frame headers. Frame payloads are read, and decoded, only when
+// requested, so large frames like attached pictures cost nothing unless
+// they are used.
+type TagReader struct {
+	Version  Version  // ID3 codec version (2.3 or 2.4)
+	Flags    TagFlags // Flags
+	Size     int      // Size not including the header
+	Warnings []error  // Problems tolerated while decoding in lenient mode
+
+	src     io.ReaderAt // reader holding the tag
+	r       io.ReaderAt // tag data following the header, without unsync codes
+	size    int64       // size of the data in r
+	opts    DecodeOptions
+	codec   versionCodec
+	vdata   *versionData
+	entries []frameEntry
+}
+
+// A frameEntry records the location of a frame within a tag.
+type frameEntry struct {
+	header  FrameHeader
+	offset  int64 // offset of the frame header from the start of the tag
+	plain   bool  // true if the frame's size is stored as a plain integer
+	decoded bool  // true once the frame's warnings have been recorded
+}
+
+// NewTagReader creates a TagReader for the ID3 tag at the start of r.
+// To read a tag elsewhere in a file, use an io.SectionReader.
+func NewTagReader(r io.ReaderAt) (*TagReader, error) {
+	return NewTagReaderWithOptions(r, DecodeOptions{})
+}
+
+// NewTagReaderWithOptions creates a TagReader for the ID3 tag at the start
+// of r, which decodes frames using the requested decoding options.
+func NewTagReaderWithOptions(r io.ReaderAt, opts DecodeOptions) (*TagReader, error) {
+	hdr := make([]byte, 10)
+	if err := readAt(r, hdr, 0); err != nil {
+		return nil, err
+	}
+	v, size, err := PeekTag(hdr)
+	if err != nil {
+		return nil, ErrInvalidTag
+	}
+
+	codec, err := newCodec(v)
+	if err != nil {
+		return nil, err
+	}
+	vdata := versionDataOf(v)
+	if vdata == nil {
+		return nil, errUnimplemented
+	}
+
+	tr := &TagReader{
+		Version: v,
+		Flags:   TagFlags(vdata.headerFlags.Decode(uint32(hdr[5]))),
+		Size:    size - 10,
+		src:     r,
+		opts:    opts,
+		codec:   codec,
+		vdata:   vdata,
+	}
+
+	if err := tr.load(); err != nil {
+		return nil, err
+	}
+	if err := tr.index(); err != nil {
+		return nil, err
+	}
+	return tr, nil
+}
+
+// load prepares the tag data following the tag header for reading. An
+// unsynchronized tag is unsynchronized as a whole, so frame offsets are
+// known only after removing the unsync codes from the entire tag.
+func (tr *TagReader) load() error {
+	if (tr.Flags & TagFlagUnsync) == 0 {
+		tr.r, tr.size = io.NewSectionReader(tr.src, 10, int64(tr.Size)), int64(tr.Size)
+		return nil
+	}
+
+	if err := checkLimit("MaxTagSize", tr.opts.Limits.MaxTagSize, tr.Size); err != nil {
+		return err
+	}
+	b := make([]byte, tr.Size)
+	if err := readAt(tr.src, b, 10); err != nil {
+		return err
+	}
+	b = removeUnsyncCodes(b)
+	tr.r, tr.size = bytes.NewReader(b), int64(len(b))
+	return nil
+}
+
+// grow extends the tag by n bytes, for tags whose size excludes their
+// extended header. It returns false, leaving the tag unchanged, if the
+// reader doesn't hold the extra bytes.
+func (tr *TagReader) grow(n int) bool {
+	tr.Size += n
+	if err := tr.load(); err == nil && readAt(tr.r, make([]byte, 1), tr.size-1) == nil {
+		return true
+	}
+	tr.Size -= n
+	tr.load()
+	return false
+}
+
+// index records the location of each frame within the tag's body. In
+// lenient mode, it tolerates the same problems as Tag.ReadFrom: frame
+// sizes stored as plain integers, tag sizes excluding the extended
+// header, and frames that can't be located, which end the tag.
+func (tr *TagReader) index() error {
+	var pos, exSize int64
+
+	// Skip the extended header, whose size includes the size field.
+	if (tr.Flags & TagFlagExtended) != 0 {
+		b := make([]byte, 4)
+		if err := readAt(tr.r, b, 0); err == io.ErrUnexpectedEOF {
+			return ErrInvalidHeader
+		} else if err != nil {
+			return err
+		}
+		var n uint32
+		var err error
+		if tr.Version == Version2_3 {
+			n, err = decodeUint32(b)
+		} else {
+			n, err = decodeSyncSafeUint32(b)
+		}
+		if err != nil {
+			return ErrInvalidHeader
+		}
+		pos, exSize = int64(n), int64(n)
+	}
+
+	grown := false
+	hdr := make([]byte, 10)
+	for pos < tr.size {
+		b := hdr
+		if rem := tr.size - pos; rem < 10 {
+			b = hdr[:rem]
+		}
+		if err := readAt(tr.r, b, pos); err != nil {
+			return err
+		}
+
+		// A frame ID starting with a zero byte indicates padding.
+		if b[0] == 0 || (tr.opts.Lenient && (len(b) < 4 || !validFrameID(b[:4]))) {
+			return tr.padding(pos)
+		}
+
+		// Read the bytes following the frame header as needed to locate
+		// the frame's end.
+		var readErr error
+		at := func(off, n int) []byte {
+			start := pos + 10 + int64(off)
+			if start >= tr.size {
+				return nil
+			}
+			if rem := tr.size - start; int64(n) > rem {
+				n = int(rem)
+			}
+			p := make([]byte, n)
+			if err := readAt(tr.r, p, start); err != nil {
+				readErr = err
+				return nil
+			}
+			return p
+		}
+
+		var id string
+		if len(b) >= 4 {
+			id = string(b[:4])
+		}
+		var n int
+		var plain bool
+		var err error
+		if len(b) < 10 {
+			err = ErrIncompleteFrame
+		} else {
+			n, plain, err = frameSize(tr.Version, b[4:8], tr.opts.Lenient, at)
+			if readErr != nil {
+				return readErr
+			}
+			if err == nil && pos+10+int64(n) > tr.size {
+				err = ErrIncompleteFrame
+			}
+		}
+
+		// Some encoders exclude the extended header from the tag size,
+		// truncating the last frame. Extend the tag and retry.
+		if err == ErrIncompleteFrame && tr.opts.Lenient && exSize > 0 && !grown {
+			grown = true
+			if tr.grow(int(exSize)) {
+				tr.Warnings = append(tr.Warnings, ErrInvalidTagSize)
+				continue
+			}
+		}
+		if err != nil {
+			de := &DecodeError{Err: err, Offset: int(pos) + 10, FrameID: id, Version: tr.Version}
+			if tr.opts.Lenient {
+				tr.Warnings = append(tr.Warnings, de)
+				break
+			}
+			return de
+		}
+		if plain {
+			tr.Warnings = append(tr.Warnings, &DecodeError{Err: ErrInvalidFrameSize, Offset: int(pos) + 10, FrameID: id, Version: tr.Version})
+		}
+
+		if err := checkLimit("MaxFrames", tr.opts.Limits.MaxFrames, len(tr.entries)+1); err != nil {
+			return err
+		}
+
+		tr.entries = append(tr.entries, frameEntry{
+			header: FrameHeader{
+				FrameType: tr.vdata.frameTypes.LookupFrameType(id),
+				FrameID:   id,
+				Size:      n,
+				Flags:     FrameFlags(tr.vdata.frameFlags.Decode(uint32(b[8])<<8 | uint32(b[9]))),
+			},
+			offset: pos,
+			plain:  plain,
+		})
+		pos += 10 + int64(n)
+	}
+	return nil
+}
+
+// padding checks the padding starting at pos. In lenient mode, padding
+// containing non-zero bytes is recorded as a warning.
+func (tr *TagReader) padding(pos int64) error {
+	if !tr.opts.Lenient {
+		return nil
+	}
+	b := make([]byte, tr.size-pos)
+	if err := readAt(tr.r, b, pos); err != nil {
+		return err
+	}
+	if !isZero(b) {
+		tr.Warnings = append(tr.Warnings, &DecodeError{Err: ErrInvalidPadding, Offset: int(pos) + 10, Version: tr.Version})
+	}
+	return nil
+}
+
+// Frames returns the headers of all frames in the tag, in the order they
+// appear. The headers hold each frame's type, ID, size and flags.
+func (tr *TagReader) Frames() []FrameHeader {
+	hh := make([]FrameHeader, len(tr.entries))
+	for i, e := range tr.entries {
+		hh[i] = e.header
+	}
+	return hh
+}
+
+// Frame reads and decodes the i'th frame of the tag. The frame is decoded
+// each time Frame is called. It returns ErrFrameIndex if i is out of range.
+// In lenient mode, problems tolerated while decoding the frame are added
+// to the reader's Warnings the first time it is decoded.
+func (tr *TagReader) Frame(i int) (Frame, error) {
+	if i < 0 || i >= len(tr.entries) {
+		return nil, ErrFrameIndex
+	}
+	e := tr.entries[i]
+	data := make([]byte, 10+e.header.Size)
+	if err := readAt(tr.r, data, e.offset); err != nil {
+		return nil, err
+	}
+
+	// The frame's size was already located, so store it sync-safe to
+	// avoid warning about it again.
+	if e.plain {
+		encodeSyncSafeUint32(data[4:8], uint32(e.header.Size))
+	}
+
+	r := newReader(nil, &tr.opts)
+	r.ReplaceBuffer(data)
+	t := &Tag{Version: tr.Version, Flags: tr.Flags}
+
+	var f Frame
+	err := tr.codec.DecodeFrame(t, &f, r)
+	if !e.decoded {
+		for _, w := range t.Warnings {
+			if de, ok := w.(*DecodeError); ok {
+				de.Offset, de.Version = int(e.offset)+10, tr.Version
+			}
+		}
+		tr.Warnings = append(tr.Warnings, t.Warnings...)
+		tr.entries[i].decoded = true
+	}
+	if err != nil {
+		de := frameDecodeError(err, e.header.FrameID)
+		de.Offset, de.Version = int(e.offset)+10, tr.Version
+		return nil, de
+	}
+	return f, nil
+}
+
+// Raw returns the payload of the i'th frame of the tag as stored, without
+// its frame header and without decoding it. For a tag using
+// unsynchronization, the unsync codes are removed. It returns ErrFrameIndex
+// if i is out of range.
+func (tr *TagReader) Raw(i int) ([]byte, error) {
+	if i < 0 || i >= len(tr.entries) {
+		return nil, ErrFrameIndex
+	}
+	e := tr.entries[i]
+	data := make([]byte, e.header.Size)
+	if err := readAt(tr.r, data, e.offset+10); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// readAt fills b from r at offset off. Reaching the end of r before b is
+// filled is reported as io.ErrUnexpectedEOF; other errors are returned as
+// is.
+func readAt(r io.ReaderAt, b []byte, off int64) error {
+	n, err := r.ReadAt(b, off)
+	switch {
+	case n == len(b):
+		return nil
+	case err == io.EOF:
+		return io.ErrUnexpectedEOF
+	default:
+		return err
+	}
+}
+
+// FindFrame reads and decodes the first frame of the requested type. If
+// the tag has no such frame, it returns nil.
+func (tr *TagReader) FindFrame(typ FrameType) (Frame, error) {
+	for i, e := range tr.entries {
+		if e.header.FrameType == typ {
+			return tr.Frame(i)
+		}
+	}
+	return nil, nil
+}
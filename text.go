@@ -1,8 +1,13 @@
 package id3
 
 import (
+	"bytes"
+	"strings"
+	"unicode"
 	"unicode/utf16"
 	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
 )
 
 // An Encoding value describes the type of text encoding used on a frame's
@@ -26,20 +31,83 @@ var null = [4][]byte{
 	[]byte{0},    // EncodingUTF8
 }
 
+// ByteOrder describes the byte order of UTF-16 encoded text.
+type ByteOrder uint8
+
+// Possible byte orders for UTF-16 encoded text. ByteOrderDefault selects
+// big endian byte order unless another choice applies.
+const (
+	ByteOrderDefault ByteOrder = iota
+	ByteOrderBigEndian
+	ByteOrderLittleEndian
+)
+
+// UTF-16 byte order marks.
+var (
+	bomBigEndian    = []byte{0xfe, 0xff}
+	bomLittleEndian = []byte{0xff, 0xfe}
+)
+
+// bomOrder returns the byte order given by the byte order mark at the
+// start of b, or ByteOrderDefault if b doesn't start with one.
+func bomOrder(b []byte) ByteOrder {
+	switch {
+	case bytes.HasPrefix(b, bomBigEndian):
+		return ByteOrderBigEndian
+	case bytes.HasPrefix(b, bomLittleEndian):
+		return ByteOrderLittleEndian
+	default:
+		return ByteOrderDefault
+	}
+}
+
+// A textCodec encodes and decodes strings. The zero value decodes UTF-16
+// strictly and encodes UTF-16 strings with a byte order mark using big
+// endian byte order.
+type textCodec struct {
+	lenient   bool      // replace unpaired UTF-16 surrogates instead of failing
+	byteOrder ByteOrder // byte order used for UTF-16 strings with a BOM
+}
+
 // Decode an encoded string stored in a byte slice.
 func decodeString(b []byte, enc Encoding) (string, error) {
-	s, _, err := decodeNextString(b, enc)
-	return s, err
+	return textCodec{}.decodeString(b, enc)
 }
 
 // Decode zero or more null-terminated, encoded strings stored in a byte
 // slice.
 func decodeStrings(b []byte, enc Encoding) ([]string, error) {
+	return textCodec{}.decodeStrings(b, enc)
+}
+
+// Decode the next string contained in the byte slice. Stop decoding once
+// the byte slice is exhausted or when a null terminator is reached.
+// Return the decoded string and the unprocessed remainder of the byte slice.
+func decodeNextString(b []byte, enc Encoding) (s string, remain []byte, err error) {
+	return textCodec{}.decodeNextString(b, enc)
+}
+
+// Encode a string to a byte slice.
+func encodeString(s string, enc Encoding) ([]byte, error) {
+	return textCodec{}.encodeString(s, enc)
+}
+
+// Encode an array of strings into a byte slice.
+func encodeStrings(ss []string, enc Encoding) ([]byte, error) {
+	return textCodec{}.encodeStrings(ss, enc)
+}
+
+func (c textCodec) decodeString(b []byte, enc Encoding) (string, error) {
+	s, _, err := c.decodeNextString(b, enc)
+	return s, err
+}
+
+func (c textCodec) decodeStrings(b []byte, enc Encoding) ([]string, error) {
 	ss := make([]string, 0, 1)
 	for len(b) > 0 {
 		var s string
 		var err error
-		s, b, err = decodeNextString(b, enc)
+		s, b, err = c.decodeNextString(b, enc)
 		if err != nil {
 			return nil, err
 		}
@@ -49,21 +117,18 @@ func decodeStrings(b []byte, enc Encoding) ([]string, error) {
 	return ss, nil
 }
 
-// Decode the next string contained in the byte slice. Stop decoding once
-// the byte slice is exhausted or when a null terminator is reached.
-// Return the decoded string and the unprocessed remainder of the byte slice.
-func decodeNextString(b []byte, enc Encoding) (s string, remain []byte, err error) {
+func (c textCodec) decodeNextString(b []byte, enc Encoding) (s string, remain []byte, err error) {
 	consumed := len(b)
 
 	switch enc {
 	case EncodingISO88591:
 		runes := make([]rune, 0, len(b))
-		for i, c := range b {
-			if c == 0 {
+		for i, ch := range b {
+			if ch == 0 {
 				consumed = i + 1
 				break
 			}
-			runes = append(runes, rune(c))
+			runes = append(runes, rune(ch))
 		}
 		return string(runes), b[consumed:], nil
 
@@ -85,23 +150,34 @@ func decodeNextString(b []byte, enc Encoding) (s string, remain []byte, err erro
 		fallthrough
 
 	case EncodingUTF16:
-		start := 0
-		if len(b) >= 2 && b[0] == 0xfe && b[1] == 0xff {
+		// Each string may begin with its own byte order mark. Strings
+		// without one are big endian.
+		start, order := 0, bomOrder(b)
+		if order != ByteOrderDefault {
 			start = 2
 		}
-		if (len(b) & 1) != 0 {
-			return "", b, ErrInvalidText
-		}
+
 		u := make([]uint16, 0, len(b)/2)
-		j := 0
-		for i := start; i < len(b); i += 2 {
-			cp := uint16(b[i])<<8 | uint16(b[i+1])
+		terminated := false
+		for i := start; i+1 < len(b); i += 2 {
+			var cp uint16
+			if order == ByteOrderLittleEndian {
+				cp = uint16(b[i+1])<<8 | uint16(b[i])
+			} else {
+				cp = uint16(b[i])<<8 | uint16(b[i+1])
+			}
 			if cp == 0 {
 				consumed = i + 2
+				terminated = true
 				break
 			}
 			u = append(u, cp)
-			j++
+		}
+		if !terminated && ((len(b)-start)&1) != 0 {
+			return "", b, ErrInvalidText
+		}
+		if !c.lenient && !validUTF16(u) {
+			return "", b, ErrInvalidText
 		}
 		return string(utf16.Decode(u)), b[consumed:], nil
 
@@ -110,8 +186,24 @@ func decodeNextString(b []byte, enc Encoding) (s string, remain []byte, err erro
 	}
 }
 
-// Encode a string to a byte slice.
-func encodeString(s string, enc Encoding) ([]byte, error) {
+// validUTF16 returns true if the UTF-16 code units contain no unpaired
+// surrogates.
+func validUTF16(u []uint16) bool {
+	for i := 0; i < len(u); i++ {
+		switch {
+		case u[i] >= 0xd800 && u[i] < 0xdc00:
+			if i+1 >= len(u) || u[i+1] < 0xdc00 || u[i+1] >= 0xe000 {
+				return false
+			}
+			i++
+		case u[i] >= 0xdc00 && u[i] < 0xe000:
+			return false
+		}
+	}
+	return true
+}
+
+func (c textCodec) encodeString(s string, enc Encoding) ([]byte, error) {
 	var b []byte
 
 	switch enc {
@@ -129,17 +221,23 @@ func encodeString(s string, enc Encoding) ([]byte, error) {
 		return []byte(s), nil
 
 	case EncodingUTF16BOM:
-		b = make([]byte, 0, len(s)*2)
-		b = append(b, []byte{0xfe, 0xff}...)
+		b = make([]byte, 0, len(s)*2+2)
+		if c.byteOrder == ByteOrderLittleEndian {
+			b = append(b, bomLittleEndian...)
+			for _, u := range utf16.Encode([]rune(s)) {
+				b = append(b, byte(u), byte(u>>8))
+			}
+			return b, nil
+		}
+		b = append(b, bomBigEndian...)
 		fallthrough
 
 	case EncodingUTF16:
 		if b == nil {
 			b = make([]byte, 0, len(s)*2)
 		}
-		u := utf16.Encode([]rune(s))
-		for i, j := 0, 0; i < len(u); i, j = i+1, j+2 {
-			b = append(b, []byte{byte(u[i] >> 8), byte(u[i])}...)
+		for _, u := range utf16.Encode([]rune(s)) {
+			b = append(b, byte(u>>8), byte(u))
 		}
 		return b, nil
 
@@ -148,11 +246,10 @@ func encodeString(s string, enc Encoding) ([]byte, error) {
 	}
 }
 
-// Encode an array of strings into a byte slice.
-func encodeStrings(ss []string, enc Encoding) ([]byte, error) {
+func (c textCodec) encodeStrings(ss []string, enc Encoding) ([]byte, error) {
 	buf := make([]byte, 0)
 	for i, s := range ss {
-		b, err := encodeString(s, enc)
+		b, err := c.encodeString(s, enc)
 		if err != nil {
 			return nil, err
 		}
@@ -161,5 +258,87 @@ func encodeStrings(ss []string, enc Encoding) ([]byte, error) {
 		}
 		buf = append(buf, b...)
 	}
+
+	// Terminate a list whose last value is empty, so that the value isn't
+	// mistaken for a terminator when the list is decoded.
+	if len(ss) > 1 && ss[len(ss)-1] == "" {
+		buf = append(buf, null[enc]...)
+	}
 	return buf, nil
 }
+
+// isLatin1 returns true if all of a string's runes can be represented in
+// ISO-8859-1.
+func isLatin1(s string) bool {
+	for _, r := range s {
+		if r > 0xff {
+			return false
+		}
+	}
+	return true
+}
+
+// latin1Transliterations maps common characters outside ISO-8859-1 to
+// their closest ISO-8859-1 equivalents. Characters not found here are
+// transliterated by removing diacritical marks, if possible.
+var latin1Transliterations = map[rune]string{
+	'Đ': "D", 'đ': "d", 'Ħ': "H", 'ħ': "h", 'ı': "i", 'Ĳ': "IJ", 'ĳ': "ij",
+	'Ł': "L", 'ł': "l", 'Ŀ': "L", 'ŀ': "l", 'Œ': "OE", 'œ': "oe",
+	'Ŧ': "T", 'ŧ': "t", 'ƒ': "f", 'ˆ': "^", '˜': "~",
+	'\u2010': "-", '\u2011': "-", '\u2012': "-", '\u2013': "-", '\u2014': "-",
+	'\u2015': "-", '\u2018': "'", '\u2019': "'", '\u201a': "'", '\u201b': "'",
+	'\u201c': "\"", '\u201d': "\"", '\u201e': "\"", '\u201f': "\"",
+	'\u2020': "+", '\u2022': "*", '\u2026': "...", '\u2032': "'", '\u2033': "\"",
+	'\u2039': "<", '\u203a': ">", '\u20ac': "EUR", '\u2122': "TM",
+	'\u2212': "-", '\u2000': " ", '\u2001': " ", '\u2002': " ", '\u2003': " ",
+	'\u2009': " ", '\u200a': " ", '\u202f': " ",
+}
+
+// toLatin1 converts a string so that ISO-8859-1 can represent it, using the
+// requested mode. In strict mode, it returns false along with the first
+// character that can't be represented.
+func toLatin1(s string, mode Latin1Mode) (string, rune, bool) {
+	if isLatin1(s) {
+		return s, 0, true
+	}
+
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r <= 0xff:
+			b.WriteRune(r)
+		case mode == Latin1Strict:
+			return "", r, false
+		case mode == Latin1Transliterate:
+			b.WriteString(transliterate(r))
+		default:
+			b.WriteByte('.')
+		}
+	}
+	return b.String(), 0, true
+}
+
+// transliterate returns the closest ISO-8859-1 equivalent of a character
+// that ISO-8859-1 can't represent, or "." if there is none.
+func transliterate(r rune) string {
+	if t, ok := latin1Transliterations[r]; ok {
+		return t
+	}
+
+	// Decompose the character and keep it if only combining marks had
+	// to be dropped (e.g., "ő" becomes "o").
+	var b strings.Builder
+	for _, d := range norm.NFD.String(string(r)) {
+		switch {
+		case unicode.Is(unicode.Mn, d):
+		case d > 0xff:
+			return "."
+		default:
+			b.WriteRune(d)
+		}
+	}
+	if b.Len() == 0 {
+		return "."
+	}
+	return norm.NFC.String(b.String())
+}
@@ -0,0 +1,365 @@
+package id3
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Precision indicates which components of a Timestamp are present.
+type Precision uint8
+
+// All possible Precision values, from least to most precise.
+const (
+	PrecisionNone   Precision = iota // No timestamp
+	PrecisionYear                    // yyyy
+	PrecisionMonth                   // yyyy-MM
+	PrecisionDay                     // yyyy-MM-dd
+	PrecisionHour                    // yyyy-MM-ddTHH
+	PrecisionMinute                  // yyyy-MM-ddTHH:mm
+	PrecisionSecond                  // yyyy-MM-ddTHH:mm:ss
+)
+
+// A Timestamp holds the contents of an ID3 time frame (TDRC, TDOR, TDRL,
+// TDEN or TDTG). ID3 timestamps are a subset of ISO 8601 and may be
+// truncated at any component, so a Timestamp records the precision that
+// was present. Components beyond the timestamp's precision are zero.
+type Timestamp struct {
+	Year      int
+	Month     int
+	Day       int
+	Hour      int
+	Minute    int
+	Second    int
+	Precision Precision
+}
+
+// timestampLengths maps each precision to the length of its string
+// representation.
+var timestampLengths = [...]int{
+	PrecisionNone:   0,
+	PrecisionYear:   4,
+	PrecisionMonth:  7,
+	PrecisionDay:    10,
+	PrecisionHour:   13,
+	PrecisionMinute: 16,
+	PrecisionSecond: 19,
+}
+
+// NewTimestamp creates a timestamp from a time value, keeping only the
+// components allowed by the requested precision.
+func NewTimestamp(t time.Time, p Precision) Timestamp {
+	ts := Timestamp{
+		Year:      t.Year(),
+		Month:     int(t.Month()),
+		Day:       t.Day(),
+		Hour:      t.Hour(),
+		Minute:    t.Minute(),
+		Second:    t.Second(),
+		Precision: p,
+	}
+	return ts.truncate(p)
+}
+
+// ParseTimestamp parses a timestamp in any of the formats allowed by the
+// ID3v2.4 specification: yyyy, yyyy-MM, yyyy-MM-dd, yyyy-MM-ddTHH,
+// yyyy-MM-ddTHH:mm and yyyy-MM-ddTHH:mm:ss.
+func ParseTimestamp(s string) (Timestamp, error) {
+	s = strings.TrimSpace(s)
+
+	var p Precision
+	for i, l := range timestampLengths {
+		if len(s) == l {
+			p = Precision(i)
+		}
+	}
+	if p == PrecisionNone {
+		return Timestamp{}, ErrInvalidTimestamp
+	}
+
+	// Check the separators and digits against the full layout.
+	const layout = "0000-00-00T00:00:00"
+	for i := 0; i < len(s); i++ {
+		switch layout[i] {
+		case '0':
+			if s[i] < '0' || s[i] > '9' {
+				return Timestamp{}, ErrInvalidTimestamp
+			}
+		default:
+			if s[i] != layout[i] {
+				return Timestamp{}, ErrInvalidTimestamp
+			}
+		}
+	}
+
+	num := func(start, end int) int {
+		var n int
+		for i := start; i < end; i++ {
+			n = n*10 + int(s[i]-'0')
+		}
+		return n
+	}
+
+	ts := Timestamp{Precision: p}
+	ts.Year = num(0, 4)
+	if p >= PrecisionMonth {
+		ts.Month = num(5, 7)
+	}
+	if p >= PrecisionDay {
+		ts.Day = num(8, 10)
+	}
+	if p >= PrecisionHour {
+		ts.Hour = num(11, 13)
+	}
+	if p >= PrecisionMinute {
+		ts.Minute = num(14, 16)
+	}
+	if p >= PrecisionSecond {
+		ts.Second = num(17, 19)
+	}
+
+	if err := ts.Validate(); err != nil {
+		return Timestamp{}, err
+	}
+	return ts, nil
+}
+
+// IsZero returns true if the timestamp holds no value.
+func (ts Timestamp) IsZero() bool {
+	return ts.Precision == PrecisionNone
+}
+
+// Validate checks that each component of the timestamp up to its
+// precision is within range. It returns ErrInvalidTimestamp if not.
+func (ts Timestamp) Validate() error {
+	p := ts.Precision
+	switch {
+	case p > PrecisionSecond:
+		return ErrInvalidTimestamp
+	case p >= PrecisionYear && (ts.Year < 0 || ts.Year > 9999):
+		return ErrInvalidTimestamp
+	case p >= PrecisionMonth && (ts.Month < 1 || ts.Month > 12):
+		return ErrInvalidTimestamp
+	case p >= PrecisionDay && (ts.Day < 1 || ts.Day > daysIn(ts.Year, ts.Month)):
+		return ErrInvalidTimestamp
+	case p >= PrecisionHour && (ts.Hour < 0 || ts.Hour > 23):
+		return ErrInvalidTimestamp
+	case p >= PrecisionMinute && (ts.Minute < 0 || ts.Minute > 59):
+		return ErrInvalidTimestamp
+	case p >= PrecisionSecond && (ts.Second < 0 || ts.Second > 59):
+		return ErrInvalidTimestamp
+	}
+	return nil
+}
+
+// String returns the ID3v2.4 string representation of the timestamp.
+func (ts Timestamp) String() string {
+	s := fmt.Sprintf("%04d-%02d-%02dT%02d:%02d:%02d",
+		ts.Year, ts.Month, ts.Day, ts.Hour, ts.Minute, ts.Second)
+	if int(ts.Precision) >= len(timestampLengths) {
+		return s
+	}
+	return s[:timestampLengths[ts.Precision]]
+}
+
+// Time converts the timestamp to a UTC time value. Missing months and days
+// are treated as the first of the month or year.
+func (ts Timestamp) Time() time.Time {
+	month, day := ts.Month, ts.Day
+	if month == 0 {
+		month = 1
+	}
+	if day == 0 {
+		day = 1
+	}
+	return time.Date(ts.Year, time.Month(month), day,
+		ts.Hour, ts.Minute, ts.Second, 0, time.UTC)
+}
+
+// truncate returns a copy of the timestamp with all components beyond the
+// requested precision cleared.
+func (ts Timestamp) truncate(p Precision) Timestamp {
+	if p < ts.Precision {
+		ts.Precision = p
+	}
+	if ts.Precision < PrecisionSecond {
+		ts.Second = 0
+	}
+	if ts.Precision < PrecisionMinute {
+		ts.Minute = 0
+	}
+	if ts.Precision < PrecisionHour {
+		ts.Hour = 0
+	}
+	if ts.Precision < PrecisionDay {
+		ts.Day = 0
+	}
+	if ts.Precision < PrecisionMonth {
+		ts.Month = 0
+	}
+	if ts.Precision < PrecisionYear {
+		ts.Year = 0
+	}
+	return ts
+}
+
+func daysIn(year, month int) int {
+	return time.Date(year, time.Month(month)+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+// RecordingTime returns the time the audio was recorded. For v2.4 tags, it
+// is read from the TDRC frame. For earlier versions, it is assembled from
+// the TYER, TDAT and TIME frames.
+func (t *Tag) RecordingTime() (Timestamp, bool) {
+	if t.Version >= Version2_4 {
+		return t.timestamp(FrameTypeTextRecordingTime)
+	}
+
+	ts, ok := t.timestamp(FrameTypeTextRecordingTime)
+	if !ok || ts.Precision != PrecisionYear {
+		return Timestamp{}, false
+	}
+
+	// TDAT holds the day and month in DDMM format.
+	s, ok := t.text(FrameTypeTextDate)
+	if !ok || len(s) != 4 {
+		return ts, true
+	}
+	d, err := ParseTimestamp(fmt.Sprintf("%04d-%s-%s", ts.Year, s[2:], s[:2]))
+	if err != nil {
+		return ts, true
+	}
+	ts = d
+
+	// TIME holds the hour and minute in HHMM format.
+	s, ok = t.text(FrameTypeTextTime)
+	if !ok || len(s) != 4 {
+		return ts, true
+	}
+	m, err := ParseTimestamp(fmt.Sprintf("%sT%s:%s", ts, s[:2], s[2:]))
+	if err == nil {
+		ts = m
+	}
+	return ts, true
+}
+
+// SetRecordingTime stores the time the audio was recorded. For v2.4 tags,
+// it is stored in the TDRC frame. For earlier versions, it is split across
+// the TYER, TDAT and TIME frames, which cannot represent seconds or a month
+// without a day; those components are dropped. A zero timestamp removes
+// the frames.
+func (t *Tag) SetRecordingTime(ts Timestamp) error {
+	if t.Version >= Version2_4 {
+		return t.setTimestamp(FrameTypeTextRecordingTime, ts)
+	}
+
+	if err := ts.Validate(); err != nil {
+		return err
+	}
+
+	// Leave all three frames untouched if any of them is read-only.
+	for _, typ := range []FrameType{FrameTypeTextRecordingTime, FrameTypeTextDate, FrameTypeTextTime} {
+		for _, f := range t.FindFrames(typ) {
+			if err := checkWritable(f, nil); err != nil {
+				return err
+			}
+		}
+	}
+
+	t.setText(FrameTypeTextDate)
+	t.setText(FrameTypeTextTime)
+	if ts.IsZero() {
+		return t.setText(FrameTypeTextRecordingTime)
+	}
+
+	t.setText(FrameTypeTextRecordingTime, fmt.Sprintf("%04d", ts.Year))
+	if ts.Precision >= PrecisionDay {
+		t.setText(FrameTypeTextDate, fmt.Sprintf("%02d%02d", ts.Day, ts.Month))
+	}
+	if ts.Precision >= PrecisionMinute {
+		t.setText(FrameTypeTextTime, fmt.Sprintf("%02d%02d", ts.Hour, ts.Minute))
+	}
+	return nil
+}
+
+// OriginalReleaseTime returns the time the original recording was
+// released. For v2.4 tags, it is read from the TDOR frame. For earlier
+// versions, it is read from the year-only TORY frame.
+func (t *Tag) OriginalReleaseTime() (Timestamp, bool) {
+	return t.timestamp(FrameTypeTextOriginalReleaseTime)
+}
+
+// SetOriginalReleaseTime stores the time the original recording was
+// released. For v2.4 tags, it is stored in the TDOR frame. For earlier
+// versions, only the year is stored, in the TORY frame. A zero timestamp
+// removes the frame.
+func (t *Tag) SetOriginalReleaseTime(ts Timestamp) error {
+	if t.Version < Version2_4 {
+		ts = ts.truncate(PrecisionYear)
+	}
+	return t.setTimestamp(FrameTypeTextOriginalReleaseTime, ts)
+}
+
+// ReleaseTime returns the time the audio was first released, as stored in
+// the TDRL frame.
+func (t *Tag) ReleaseTime() (Timestamp, bool) {
+	return t.timestamp(FrameTypeTextReleaseTime)
+}
+
+// SetReleaseTime stores the time the audio was first released into the
+// TDRL frame. It returns ErrUnsupportedFrame for tags prior to v2.4.
+func (t *Tag) SetReleaseTime(ts Timestamp) error {
+	return t.setTimestamp(FrameTypeTextReleaseTime, ts)
+}
+
+// EncodingTime returns the time the audio was encoded, as stored in the
+// TDEN frame.
+func (t *Tag) EncodingTime() (Timestamp, bool) {
+	return t.timestamp(FrameTypeTextEncodingTime)
+}
+
+// SetEncodingTime stores the time the audio was encoded into the TDEN
+// frame. It returns ErrUnsupportedFrame for tags prior to v2.4.
+func (t *Tag) SetEncodingTime(ts Timestamp) error {
+	return t.setTimestamp(FrameTypeTextEncodingTime, ts)
+}
+
+// TaggingTime returns the time the tag was written, as stored in the TDTG
+// frame.
+func (t *Tag) TaggingTime() (Timestamp, bool) {
+	return t.timestamp(FrameTypeTextTaggingTime)
+}
+
+// SetTaggingTime stores the time the tag was written into the TDTG frame.
+// It returns ErrUnsupportedFrame for tags prior to v2.4.
+func (t *Tag) SetTaggingTime(ts Timestamp) error {
+	return t.setTimestamp(FrameTypeTextTaggingTime, ts)
+}
+
+func (t *Tag) timestamp(typ FrameType) (Timestamp, bool) {
+	s, ok := t.text(typ)
+	if !ok {
+		return Timestamp{}, false
+	}
+	ts, err := ParseTimestamp(s)
+	if err != nil {
+		return Timestamp{}, false
+	}
+	return ts, true
+}
+
+func (t *Tag) setTimestamp(typ FrameType, ts Timestamp) error {
+	if t.Version < Version2_4 {
+		switch typ {
+		case FrameTypeTextReleaseTime, FrameTypeTextEncodingTime, FrameTypeTextTaggingTime:
+			return ErrUnsupportedFrame
+		}
+	}
+	if err := ts.Validate(); err != nil {
+		return err
+	}
+	if ts.IsZero() {
+		return t.setText(typ)
+	}
+	return t.setText(typ, ts.String())
+}
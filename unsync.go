@@ -2,6 +2,7 @@ package id3
 
 import (
 	"bytes"
+	"io"
 )
 
 func addUnsyncCodes(buf []byte) []byte {
@@ -17,7 +18,7 @@ func addUnsyncCodes(buf []byte) []byte {
 		if prev == 0xff && (buf[i] == 0 || (buf[i]&0xe0) == 0xe0) {
 			out.WriteByte(0)
 			out.WriteByte(buf[i])
-			prev = 0
+			prev = buf[i]
 		} else {
 			out.WriteByte(buf[i])
 			prev = buf[i]
@@ -43,3 +44,26 @@ func removeUnsyncCodes(buf []byte) []byte {
 	}
 	return out.Bytes()
 }
+
+// An unsyncReader removes unsync codes from the stream it reads.
+type unsyncReader struct {
+	r    io.Reader
+	prev byte
+}
+
+func (u *unsyncReader) Read(p []byte) (int, error) {
+	for {
+		n, err := u.r.Read(p)
+		j := 0
+		for _, b := range p[:n] {
+			if u.prev != 0xff || b != 0 {
+				p[j] = b
+				j++
+			}
+			u.prev = b
+		}
+		if j > 0 || n == 0 || err != nil {
+			return j, err
+		}
+	}
+}
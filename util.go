@@ -6,11 +6,12 @@ import (
 	"reflect"
 )
 
-func decodeUint32(b []byte) uint32 {
+// Decode a uint32 from a byte slice containing 4 bytes.
+func decodeUint32(b []byte) (value uint32, err error) {
 	if len(b) != 4 {
-		panic("invalid uint32 size")
+		return 0, errInvalidUint32Size
 	}
-	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3]), nil
 }
 
 // Decode a sync-safe uint32 from a byte slice containing 4 or 5 bytes.
@@ -30,14 +31,16 @@ func decodeSyncSafeUint32(b []byte) (value uint32, err error) {
 	return uint32(tmp), nil
 }
 
-func encodeUint32(b []byte, value uint32) {
+// Encode a uint32 into a byte slice containing 4 bytes.
+func encodeUint32(b []byte, value uint32) error {
 	if len(b) != 4 {
-		panic("invalid uint32 size")
+		return errInvalidUint32Size
 	}
 	b[0] = byte(value >> 24)
 	b[1] = byte(value >> 16)
 	b[2] = byte(value >> 8)
 	b[3] = byte(value)
+	return nil
 }
 
 // Encode a sync-safe uint32 into a byte slice containing 4 or 5 bytes.
@@ -11,6 +11,10 @@ func (c *codec22) Decode(t *Tag, r *reader) error {
 	return errUnimplemented
 }
 
+func (c *codec22) DecodeFrame(t *Tag, f *Frame, r *reader) error {
+	return errUnimplemented
+}
+
 func (c *codec22) Encode(t *Tag, w *writer) error {
 	return errUnimplemented
 }
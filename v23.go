@@ -41,6 +41,12 @@ func newCodec23() *codec23 {
 				"PictureType":      {0, 20, ErrInvalidPictureType},
 				"TimeStampFormat":  {1, 2, ErrInvalidTimeStampFormat},
 			},
+			// v2.3 only defines ISO-8859-1 and UTF-16 text, but UTF-16BE
+			// and UTF-8 frames are common in real-world v2.3 tags, so they
+			// are decoded but never encoded.
+			encodeBounds: boundsMap{
+				"Encoding": {0, 1, ErrInvalidEncoding},
+			},
 			frameTypes: newFrameTypeMap(map[FrameType]string{
 				FrameTypeAttachedPicture:              "APIC",
 				FrameTypeAudioEncryption:              "AENC",
@@ -138,6 +144,9 @@ func (c *codec23) Decode(t *Tag, r *reader) error {
 	t.Size = int(size)
 
 	// Load the rest of the tag into the reader's buffer.
+	if err := checkLimit("MaxTagSize", r.limits().MaxTagSize, t.Size); err != nil {
+		return err
+	}
 	if r.Load(t.Size); r.err != nil {
 		return r.err
 	}
@@ -149,8 +158,9 @@ func (c *codec23) Decode(t *Tag, r *reader) error {
 	}
 
 	// Decode the extended header.
+	var exSize int
 	if (t.Flags & TagFlagExtended) != 0 {
-		exSize := decodeUint32(r.ConsumeBytes(4))
+		exSize = int(r.ConsumeUint32())
 
 		// Decode the extended header flags.
 		exFlags := r.ConsumeBytes(2)
@@ -160,13 +170,16 @@ func (c *codec23) Decode(t *Tag, r *reader) error {
 		exBytesConsumed := 6
 
 		if (t.Flags & TagFlagHasCRC) != 0 {
-			t.CRC = decodeUint32(r.ConsumeBytes(4))
+			t.CRC = r.ConsumeUint32()
 			exBytesConsumed += 4
 		}
 
 		// Consume and ignore any remaining bytes in the extended header.
-		if exBytesConsumed < int(exSize) {
-			r.ConsumeBytes(int(exSize) - exBytesConsumed)
+		if exBytesConsumed < exSize {
+			if exSize-exBytesConsumed > r.Len() {
+				return ErrInvalidHeader
+			}
+			r.ConsumeBytes(exSize - exBytesConsumed)
 		}
 
 		if r.err != nil {
@@ -177,34 +190,23 @@ func (c *codec23) Decode(t *Tag, r *reader) error {
 	// Validate the CRC.
 	if (t.Flags & TagFlagHasCRC) != 0 {
 		crc := crc32.ChecksumIEEE(r.Bytes())
-		if crc != t.CRC {
+		switch {
+		case crc == t.CRC:
+		case r.lenient():
+			t.warn(ErrFailedCRC)
+		default:
 			return ErrFailedCRC
 		}
 	}
 
 	// Decode the tag's frames until tag data is exhausted or padding is
 	// encountered.
-	for r.Len() > 0 {
-		var f Frame
-		err = c.decodeFrame(t, &f, r)
-
-		if err == errPaddingEncountered {
-			t.Padding = r.Len() + 4
-			r.ConsumeAll()
-			break
-		}
-
-		if err != nil {
-			return err
-		}
-
-		t.Frames = append(t.Frames, f)
-	}
-
-	return nil
+	return decodeFrames(t, r, exSize, c.DecodeFrame)
 }
 
-func (c *codec23) decodeFrame(t *Tag, f *Frame, r *reader) error {
+// DecodeFrame decodes a single frame, including its header, from the
+// reader. It returns errPaddingEncountered if the reader holds padding.
+func (c *codec23) DecodeFrame(t *Tag, f *Frame, r *reader) error {
 	// Read the first four bytes of the frame header data to see if it's
 	// padding.
 	id := r.ConsumeBytes(4)
@@ -214,6 +216,9 @@ func (c *codec23) decodeFrame(t *Tag, f *Frame, r *reader) error {
 	if id[0] == 0 && id[1] == 0 && id[2] == 0 && id[3] == 0 {
 		return errPaddingEncountered
 	}
+	if r.lenient() && !validFrameID(id) {
+		return errPaddingEncountered // non-zero padding
+	}
 
 	// Read the remaining 6 bytes of the header data into a buffer.
 	hd := r.ConsumeBytes(6)
@@ -222,9 +227,15 @@ func (c *codec23) decodeFrame(t *Tag, f *Frame, r *reader) error {
 	}
 
 	// Decode the frame's payload size.
-	size := decodeUint32(hd[0:4])
-	if size < 1 {
-		return ErrInvalidFrameHeader
+	size, _, err := frameSize(Version2_3, hd[0:4], r.lenient(), nil)
+	if err != nil {
+		return err
+	}
+	if err := checkLimit("MaxFrameSize", r.limits().MaxFrameSize, size); err != nil {
+		return err
+	}
+	if size > r.Len() {
+		return ErrIncompleteFrame
 	}
 
 	// Decode the frame flags.
@@ -233,17 +244,36 @@ func (c *codec23) decodeFrame(t *Tag, f *Frame, r *reader) error {
 	// Start bulding the frame header.
 	h := FrameHeader{
 		FrameID: string(id),
-		Size:    int(size),
+		Size:    size,
 		Flags:   FrameFlags(flags),
 	}
 
 	// Consume the rest of the frame into a new reader.
 	r = r.ConsumeIntoNewReader(h.Size)
 
+	// In lenient mode, keep frames that can't be decoded as unknown frames.
+	if r.lenient() {
+		raw := r.Bytes()
+		if err := c.decodeFramePayload(t, f, r, h); err != nil {
+			if isLimitError(err) {
+				return err
+			}
+			h.Flags, h.GroupID, h.EncryptMethod, h.DataLength = 0, 0, 0, 0
+			*f = unknownFrame(h, raw)
+			t.warn(frameDecodeError(err, h.FrameID))
+		}
+		return nil
+	}
+	return c.decodeFramePayload(t, f, r, h)
+}
+
+// decodeFramePayload decodes the extra header data and the payload of a
+// frame whose header has been decoded.
+func (c *codec23) decodeFramePayload(t *Tag, f *Frame, r *reader, h FrameHeader) error {
 	// Decode extra header data.
 	if h.Flags != 0 {
 		if (h.Flags & FrameFlagCompressed) != 0 {
-			h.DataLength = decodeUint32(r.ConsumeBytes(4))
+			h.DataLength = r.ConsumeUint32()
 		}
 
 		if (h.Flags & FrameFlagEncrypted) != 0 {
@@ -267,6 +297,15 @@ func (c *codec23) decodeFrame(t *Tag, f *Frame, r *reader) error {
 		}
 	}
 
+	// Decompress the payload. Encrypted payloads are left as is.
+	if (h.Flags&FrameFlagCompressed) != 0 && (h.Flags&FrameFlagEncrypted) == 0 {
+		b, err := decompress(r.ConsumeAll(), h.DataLength, r.limits().MaxDecompressedSize)
+		if err != nil {
+			return err
+		}
+		r.ReplaceBuffer(b)
+	}
+
 	// Use a reflector to scan the frame's fields.
 	rf := newReflector(Version2_3, c.vdata)
 	var err error
@@ -274,10 +313,19 @@ func (c *codec23) decodeFrame(t *Tag, f *Frame, r *reader) error {
 	if err != nil {
 		return err
 	}
+	if err := checkFrameLimits(*f, r.limits()); err != nil {
+		return err
+	}
+
+	// Update the frame type, and remember little-endian UTF-16 text so
+	// that it is encoded the same way.
+	h.FrameType = rf.vdata.frameTypes.LookupFrameType(h.FrameID)
+	if r.byteOrder == ByteOrderLittleEndian {
+		h.ByteOrder = ByteOrderLittleEndian
+	}
 
 	// Copy the header into the frame.
-	rf.SetFrameHeader(*f, &h)
-	return nil
+	return rf.SetFrameHeader(*f, &h)
 }
 
 func (c *codec23) Encode(t *Tag, w *writer) error {
@@ -308,14 +356,15 @@ func (c *codec23) Encode(t *Tag, w *writer) error {
 
 		// Update the extended header size.
 		exSize := w.Len() - exHdrOffset
-		encodeUint32(w.SliceBuffer(exHdrOffset, 4), uint32(exSize))
+		w.StoreUint32At(exHdrOffset, uint32(exSize))
 	}
 
 	// Encode the frames.
 	framesOffset := w.Len()
 	for _, f := range t.Frames {
+		offset := w.Len()
 		if err := c.encodeFrame(t, f, w); err != nil {
-			return err
+			return frameEncodeError(err, f, offset, t.Version)
 		}
 	}
 
@@ -332,8 +381,7 @@ func (c *codec23) Encode(t *Tag, w *writer) error {
 	if crcOffset > -1 {
 		framesBuf := w.SliceBuffer(framesOffset, w.Len()-framesOffset)
 		t.CRC = uint32(crc32.ChecksumIEEE(framesBuf))
-		crcBuf := w.SliceBuffer(crcOffset, 4)
-		encodeUint32(crcBuf, t.CRC)
+		w.StoreUint32At(crcOffset, t.CRC)
 	}
 
 	// Unsynchronize.
@@ -362,7 +410,10 @@ func (c *codec23) encodeFrame(t *Tag, f Frame, w *writer) error {
 	w.StoreBytes([]byte{0, 0, 0, 0})
 
 	// Retrieve the frame's header.
-	h := HeaderOf(f)
+	h, err := HeaderOfChecked(f)
+	if err != nil {
+		return err
+	}
 
 	// Encode the frame header flags.
 	flags := c.vdata.frameFlags.Encode(uint32(h.Flags))
@@ -401,15 +452,20 @@ func (c *codec23) encodeFrame(t *Tag, f Frame, w *writer) error {
 
 	// Use a reflector to output the frame's fields.
 	rf := newReflector(Version2_3, c.vdata)
+	w.byteOrder = h.ByteOrder
 	frameID, err := rf.OutputFrame(w, f)
+	w.byteOrder = ByteOrderDefault
 	if err != nil {
 		return err
 	}
 
-	// Update data length.
+	// Update data length and compress the payload.
 	if dataLengthOffset > -1 {
 		dl := w.Len() - payloadOffset
-		encodeUint32(w.SliceBuffer(dataLengthOffset, 4), uint32(dl))
+		w.StoreUint32At(dataLengthOffset, uint32(dl))
+		if (h.Flags & FrameFlagEncrypted) == 0 {
+			w.StoreBytes(compress(w.ConsumeBytesFromOffset(payloadOffset)))
+		}
 	}
 
 	// Update the header frame ID.
@@ -418,7 +474,7 @@ func (c *codec23) encodeFrame(t *Tag, f Frame, w *writer) error {
 
 	// Update the header frame size.
 	h.Size = w.Len() - startOffset
-	encodeSyncSafeUint32(w.SliceBuffer(sizeOffset, 4), uint32(h.Size))
+	w.StoreUint32At(sizeOffset, uint32(h.Size))
 
 	return w.err
 }
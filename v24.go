@@ -152,6 +152,9 @@ func (c *codec24) Decode(t *Tag, r *reader) error {
 	t.Size = int(size)
 
 	// Load the rest of the tag into the reader's buffer.
+	if err := checkLimit("MaxTagSize", r.limits().MaxTagSize, t.Size); err != nil {
+		return err
+	}
 	if r.Load(t.Size); r.err != nil {
 		return r.err
 	}
@@ -163,11 +166,13 @@ func (c *codec24) Decode(t *Tag, r *reader) error {
 	}
 
 	// Decode the extended header.
+	var exSize int
 	if (t.Flags & TagFlagExtended) != 0 {
-		exSize, err := decodeSyncSafeUint32(r.ConsumeBytes(4))
+		size, err := decodeSyncSafeUint32(r.ConsumeBytes(4))
 		if err != nil {
 			return err
 		}
+		exSize = int(size)
 
 		if exFlagsSize := r.ConsumeByte(); exFlagsSize != 1 {
 			return ErrInvalidHeader
@@ -201,13 +206,16 @@ func (c *codec24) Decode(t *Tag, r *reader) error {
 			if r.ConsumeByte() != 1 {
 				return ErrInvalidHeader
 			}
-			t.Restrictions = r.ConsumeByte()
+			t.Restrictions = decodeRestrictions(r.ConsumeByte())
 			exBytesConsumed += 2
 		}
 
 		// Consume and ignore any remaining bytes in the extended header.
-		if exBytesConsumed < int(exSize) {
-			r.ConsumeBytes(int(exSize) - exBytesConsumed)
+		if exBytesConsumed < exSize {
+			if exSize-exBytesConsumed > r.Len() {
+				return ErrInvalidHeader
+			}
+			r.ConsumeBytes(exSize - exBytesConsumed)
 		}
 
 		if r.err != nil {
@@ -218,34 +226,23 @@ func (c *codec24) Decode(t *Tag, r *reader) error {
 	// Validate the CRC.
 	if (t.Flags & TagFlagHasCRC) != 0 {
 		crc := crc32.ChecksumIEEE(r.Bytes())
-		if crc != t.CRC {
+		switch {
+		case crc == t.CRC:
+		case r.lenient():
+			t.warn(ErrFailedCRC)
+		default:
 			return ErrFailedCRC
 		}
 	}
 
 	// Decode the tag's frames until tag data is exhausted or padding is
 	// encountered.
-	for r.Len() > 0 {
-		var f Frame
-		err = c.decodeFrame(t, &f, r)
-
-		if err == errPaddingEncountered {
-			t.Padding = r.Len() + 4
-			r.ConsumeAll()
-			break
-		}
-
-		if err != nil {
-			return err
-		}
-
-		t.Frames = append(t.Frames, f)
-	}
-
-	return nil
+	return decodeFrames(t, r, exSize, c.DecodeFrame)
 }
 
-func (c *codec24) decodeFrame(t *Tag, f *Frame, r *reader) error {
+// DecodeFrame decodes a single frame, including its header, from the
+// reader. It returns errPaddingEncountered if the reader holds padding.
+func (c *codec24) DecodeFrame(t *Tag, f *Frame, r *reader) error {
 	// Read the first four bytes of the frame header data to see if it's
 	// padding.
 	id := r.ConsumeBytes(4)
@@ -255,6 +252,9 @@ func (c *codec24) decodeFrame(t *Tag, f *Frame, r *reader) error {
 	if id[0] == 0 && id[1] == 0 && id[2] == 0 && id[3] == 0 {
 		return errPaddingEncountered
 	}
+	if r.lenient() && !validFrameID(id) {
+		return errPaddingEncountered // non-zero padding
+	}
 
 	// Read the remaining 6 bytes of the header data into a buffer.
 	hd := r.ConsumeBytes(6)
@@ -263,12 +263,20 @@ func (c *codec24) decodeFrame(t *Tag, f *Frame, r *reader) error {
 	}
 
 	// Decode the frame's payload size.
-	size, err := decodeSyncSafeUint32(hd[0:4])
+	size, plain, err := frameSize(Version2_4, hd[0:4], r.lenient(), func(off, n int) []byte {
+		return window(r.Bytes(), off, n)
+	})
 	if err != nil {
 		return err
 	}
-	if size < 1 {
-		return ErrInvalidFrameHeader
+	if plain {
+		t.warn(&DecodeError{Err: ErrInvalidFrameSize, FrameID: string(id)})
+	}
+	if err := checkLimit("MaxFrameSize", r.limits().MaxFrameSize, size); err != nil {
+		return err
+	}
+	if size > r.Len() {
+		return ErrIncompleteFrame
 	}
 
 	// Decode the frame flags.
@@ -277,13 +285,34 @@ func (c *codec24) decodeFrame(t *Tag, f *Frame, r *reader) error {
 	// Start bulding the frame header.
 	h := FrameHeader{
 		FrameID: string(id),
-		Size:    int(size),
+		Size:    size,
 		Flags:   FrameFlags(flags),
 	}
 
 	// Consume the rest of the frame into a new reader.
 	r = r.ConsumeIntoNewReader(h.Size)
 
+	// In lenient mode, keep frames that can't be decoded as unknown frames.
+	if r.lenient() {
+		raw := r.Bytes()
+		if err := c.decodeFramePayload(t, f, r, h); err != nil {
+			if isLimitError(err) {
+				return err
+			}
+			h.Flags, h.GroupID, h.EncryptMethod, h.DataLength = 0, 0, 0, 0
+			*f = unknownFrame(h, raw)
+			t.warn(frameDecodeError(err, h.FrameID))
+		}
+		return nil
+	}
+	return c.decodeFramePayload(t, f, r, h)
+}
+
+// decodeFramePayload decodes the extra header data and the payload of a
+// frame whose header has been decoded.
+func (c *codec24) decodeFramePayload(t *Tag, f *Frame, r *reader, h FrameHeader) error {
+	var err error
+
 	// Strip unsync codes if the frame is unsynchronized but the tag isn't.
 	if (h.Flags&FrameFlagUnsynchronized) != 0 && (t.Flags&TagFlagUnsync) == 0 {
 		b := removeUnsyncCodes(r.ConsumeAll())
@@ -332,19 +361,34 @@ func (c *codec24) decodeFrame(t *Tag, f *Frame, r *reader) error {
 		}
 	}
 
+	// Decompress the payload. Encrypted payloads are left as is.
+	if (h.Flags&FrameFlagCompressed) != 0 && (h.Flags&FrameFlagEncrypted) == 0 {
+		b, err := decompress(r.ConsumeAll(), h.DataLength, r.limits().MaxDecompressedSize)
+		if err != nil {
+			return err
+		}
+		r.ReplaceBuffer(b)
+	}
+
 	// Use a reflector to scan the frame's fields.
 	rf := newReflector(Version2_4, c.vdata)
 	*f, err = rf.ScanFrame(r, h.FrameID)
 	if err != nil {
 		return err
 	}
+	if err := checkFrameLimits(*f, r.limits()); err != nil {
+		return err
+	}
 
-	// Update the frame type.
+	// Update the frame type, and remember little-endian UTF-16 text so
+	// that it is encoded the same way.
 	h.FrameType = rf.vdata.frameTypes.LookupFrameType(h.FrameID)
+	if r.byteOrder == ByteOrderLittleEndian {
+		h.ByteOrder = ByteOrderLittleEndian
+	}
 
 	// Copy the header into the frame.
-	rf.SetFrameHeader(*f, &h)
-	return nil
+	return rf.SetFrameHeader(*f, &h)
 }
 
 func (c *codec24) Encode(t *Tag, w *writer) error {
@@ -378,7 +422,7 @@ func (c *codec24) Encode(t *Tag, w *writer) error {
 		}
 
 		if (t.Flags & TagFlagHasRestrictions) != 0 {
-			w.StoreBytes([]byte{1, t.Restrictions})
+			w.StoreBytes([]byte{1, t.Restrictions.encode()})
 		}
 
 		// Update the extended header size.
@@ -386,20 +430,44 @@ func (c *codec24) Encode(t *Tag, w *writer) error {
 		encodeSyncSafeUint32(w.SliceBuffer(exHdrOffset, 4), uint32(exSize))
 	}
 
+	// Apply the tag's restrictions if requested.
+	if w.opts != nil && w.opts.ApplyRestrictions && (t.Flags&TagFlagHasRestrictions) != 0 {
+		w.restrict = &t.Restrictions
+		if len(t.Frames) > t.Restrictions.TagSize.MaxFrames() {
+			return ErrRestrictedTagSize
+		}
+	}
+
 	// Encode the frames.
 	framesOffset := w.Len()
 	for _, f := range t.Frames {
+		offset := w.Len()
+		if pic, ok := f.(*FrameAttachedPicture); ok && w.restrict != nil {
+			if err := w.restrict.checkPicture(pic); err != nil {
+				return frameEncodeError(err, f, offset, t.Version)
+			}
+		}
 		if err := c.encodeFrame(t, f, w); err != nil {
-			return err
+			return frameEncodeError(err, f, offset, t.Version)
 		}
 	}
 
-	// Add padding.
-	if t.Padding > 0 {
-		if t.Padding < 4 {
-			t.Padding = 4 // must be at least 4 bytes.
+	// Add padding, reduced if necessary to respect the tag size
+	// restriction.
+	if t.Padding > 0 && t.Padding < 4 {
+		t.Padding = 4 // must be at least 4 bytes.
+	}
+	padding := t.Padding
+	if w.restrict != nil {
+		if avail := w.restrict.TagSize.MaxSize() - w.Len(); padding > avail {
+			padding = avail
+			if padding < 4 {
+				padding = 0
+			}
 		}
-		w.StoreBytes(make([]byte, t.Padding))
+	}
+	if padding > 0 {
+		w.StoreBytes(make([]byte, padding))
 	}
 
 	// Calculate a CRC covering only the frames and padding, and store it into
@@ -417,6 +485,10 @@ func (c *codec24) Encode(t *Tag, w *writer) error {
 		w.StoreBytes(b)
 	}
 
+	if w.restrict != nil && w.Len() > w.restrict.TagSize.MaxSize() {
+		return ErrRestrictedTagSize
+	}
+
 	// Update the tag header's size.
 	t.Size = w.Len() - len(hdr)
 	sizeBuf := w.SliceBuffer(sizeOffset, 4)
@@ -437,7 +509,10 @@ func (c *codec24) encodeFrame(t *Tag, f Frame, w *writer) error {
 	w.StoreBytes([]byte{0, 0, 0, 0})
 
 	// Retrieve the frame's header.
-	h := HeaderOf(f)
+	h, err := HeaderOfChecked(f)
+	if err != nil {
+		return err
+	}
 
 	// Encode the frame header flags.
 	if (h.Flags & FrameFlagCompressed) != 0 {
@@ -479,27 +554,34 @@ func (c *codec24) encodeFrame(t *Tag, f Frame, w *writer) error {
 
 	// Use a reflector to output the frame's fields.
 	rf := newReflector(Version2_4, c.vdata)
+	w.byteOrder = h.ByteOrder
 	frameID, err := rf.OutputFrame(w, f)
+	w.byteOrder = ByteOrderDefault
 	if err != nil {
 		return err
 	}
 
-	// Update data length.
+	// Update data length and compress the payload.
 	if dataLengthOffset > -1 {
 		dl := w.Len() - payloadOffset
 		encodeSyncSafeUint32(w.SliceBuffer(dataLengthOffset, 4), uint32(dl))
+		if (h.Flags&FrameFlagCompressed) != 0 && (h.Flags&FrameFlagEncrypted) == 0 {
+			w.StoreBytes(compress(w.ConsumeBytesFromOffset(payloadOffset)))
+		}
 	}
 
 	// Perform frame-only unsync on everything in the buffer except
 	// for the 10-byte frame header.
 	if (h.Flags&FrameFlagUnsynchronized) != 0 && (t.Flags&TagFlagUnsync) == 0 {
-		b := removeUnsyncCodes(w.ConsumeBytesFromOffset(startOffset))
+		b := addUnsyncCodes(w.ConsumeBytesFromOffset(startOffset))
 		w.StoreBytes(b)
 	}
 
 	// Update the header frame ID and type.
 	h.FrameID = frameID
-	h.FrameType = rf.vdata.frameTypes.LookupFrameType(frameID)
+	if h.FrameType != FrameTypeUnknown {
+		h.FrameType = rf.vdata.frameTypes.LookupFrameType(frameID)
+	}
 	copy(w.SliceBuffer(idOffset, 4), []byte(h.FrameID))
 
 	// Update the header frame size.
@@ -0,0 +1,341 @@
+package id3
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+)
+
+// Severity describes how serious a validation issue is.
+type Severity uint8
+
+// All possible Severity values.
+const (
+	SeverityWarning Severity = iota // Allowed, but likely to cause problems
+	SeverityError                   // Forbidden by the ID3 specification
+)
+
+// String returns the name of the severity level.
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// Rule IDs identifying each check performed by Tag.Validate.
+const (
+	RuleDuplicateTextFrame     = "duplicate-text-frame"     // More than one text frame of a type
+	RuleDuplicateURLFrame      = "duplicate-url-frame"      // More than one URL frame of a type (with the same URL for WCOM and WOAR)
+	RuleDuplicatePicture       = "duplicate-picture"        // APIC frames with the same description
+	RuleDuplicateFileIcon      = "duplicate-file-icon"      // More than one APIC frame of picture type 1 or 2
+	RuleDuplicateComment       = "duplicate-comment"        // COMM frames with the same language and description
+	RuleDuplicateLyrics        = "duplicate-lyrics"         // USLT frames with the same language and description
+	RuleDuplicateUserText      = "duplicate-user-text"      // TXXX frames with the same description
+	RuleDuplicateUserURL       = "duplicate-user-url"       // WXXX frames with the same description
+	RuleDuplicatePopularimeter = "duplicate-popularimeter"  // POPM frames with the same email
+	RuleDuplicatePlayCount     = "duplicate-play-count"     // More than one PCNT frame
+	RuleDuplicateUniqueFileID  = "duplicate-unique-file-id" // UFID frames with the same owner
+	RuleInvalidFrame           = "invalid-frame"            // Frame isn't a pointer to a frame struct
+	RuleInvalidLanguage        = "invalid-language"         // Language code isn't three lowercase letters
+	RuleUnknownLanguage        = "unknown-language"         // Language code isn't an ISO-639-2 code
+	RuleUnsupportedFrame       = "unsupported-frame"        // Frame type not supported by the tag's version
+	RuleUniqueFileIDOwner      = "ufid-owner"               // UFID frame with an empty owner
+	RuleUniqueFileIDLength     = "ufid-identifier-length"   // UFID identifier longer than 64 bytes
+	RuleEncodingFailed         = "encoding-failed"          // Tag that can't be encoded to check its size
+	RuleRestrictedFrameCount   = "restricted-frame-count"   // More frames than the tag's restrictions allow
+	RuleRestrictedTagSize      = "restricted-tag-size"      // Tag larger than its restrictions allow
+	RuleRestrictedTextEncoding = "restricted-text-encoding" // UTF-16 text in a tag restricted to ISO-8859-1 and UTF-8
+	RuleRestrictedTextSize     = "restricted-text-size"     // Text longer than the tag's restrictions allow
+	RuleRestrictedImageFormat  = "restricted-image-format"  // Picture that isn't a PNG or JPEG image
+	RuleRestrictedImageSize    = "restricted-image-size"    // Picture larger than the tag's restrictions allow
+)
+
+// An Issue describes a problem found by Tag.Validate.
+type Issue struct {
+	Rule     string   // ID of the rule that failed (e.g., RuleDuplicateTextFrame)
+	Severity Severity // Severity of the issue
+	Frame    Frame    // Frame with the issue, or nil if it concerns the whole tag
+	Message  string   // Human-readable description of the issue
+}
+
+// String returns a human-readable description of the issue.
+func (i Issue) String() string {
+	return fmt.Sprintf("%s: %s: %s", i.Severity, i.Rule, i.Message)
+}
+
+// Validate checks the tag against the rules of the ID3 specification for
+// the tag's version and returns a list of issues found. Issues with
+// SeverityError describe tags the specification forbids; issues with
+// SeverityWarning describe tags that are allowed but likely to be
+// misinterpreted by other software. An empty list indicates a valid tag.
+//
+// If the tag is a v2.4 tag with the TagFlagHasRestrictions flag, it is
+// also checked against its Restrictions.
+func (t *Tag) Validate() []Issue {
+	vdata := versionDataOf(t.Version)
+	v := validator{vdata: vdata}
+
+	for _, f := range t.Frames {
+		h, err := HeaderOfChecked(f)
+		if err != nil {
+			v.add(RuleInvalidFrame, SeverityError, f, "%T is not a valid frame", f)
+			continue
+		}
+		typ := h.FrameType
+		if _, ok := f.(*FrameUnknown); ok {
+			continue
+		}
+
+		if vdata != nil {
+			if _, ok := vdata.frameTypes.FrameTypeToFrameID[typ]; !ok {
+				v.add(RuleUnsupportedFrame, SeverityError, f,
+					"%s frames are not supported by v2.%d tags", v.name(f), t.Version)
+				continue
+			}
+		}
+
+		switch ff := f.(type) {
+		case *FrameText:
+			if typ != FrameTypeTextCustom {
+				v.unique(RuleDuplicateTextFrame, f, typ, "")
+			}
+
+		case *FrameURL:
+			// Only WCOM and WOAR frames may repeat, with different URLs.
+			switch typ {
+			case FrameTypeURLCommercial, FrameTypeURLArtist:
+				v.unique(RuleDuplicateURLFrame, f, typ, string(ff.URL))
+			default:
+				v.unique(RuleDuplicateURLFrame, f, typ, "")
+			}
+
+		case *FrameAttachedPicture:
+			v.unique(RuleDuplicatePicture, f, typ, ff.Description)
+			if ff.PictureType == PictureTypeIcon || ff.PictureType == PictureTypeIconOther {
+				v.unique(RuleDuplicateFileIcon, f, typ, fmt.Sprintf("icon %d", ff.PictureType))
+			}
+
+		case *FrameComment:
+			v.language(f, ff.Language)
+			v.unique(RuleDuplicateComment, f, typ, ff.Language+"\x00"+ff.Description)
+
+		case *FrameLyricsUnsync:
+			v.language(f, ff.Language)
+			v.unique(RuleDuplicateLyrics, f, typ, ff.Language+"\x00"+ff.Descriptor)
+
+		case *FrameLyricsSync:
+			v.language(f, ff.Language)
+
+		case *FrameTermsOfUse:
+			v.language(f, ff.Language)
+
+		case *FrameTextCustom:
+			v.unique(RuleDuplicateUserText, f, typ, ff.Description)
+
+		case *FrameURLCustom:
+			v.unique(RuleDuplicateUserURL, f, typ, ff.Description)
+
+		case *FramePopularimeter:
+			v.unique(RuleDuplicatePopularimeter, f, typ, string(ff.Email))
+
+		case *FramePlayCount:
+			v.unique(RuleDuplicatePlayCount, f, typ, "")
+
+		case *FrameUniqueFileID:
+			v.unique(RuleDuplicateUniqueFileID, f, typ, string(ff.Owner))
+			if ff.Owner == "" {
+				v.add(RuleUniqueFileIDOwner, SeverityError, f,
+					"unique file identifier has no owner")
+			}
+			if len(ff.Identifier) > 64 {
+				v.add(RuleUniqueFileIDLength, SeverityError, f,
+					"unique file identifier is %d bytes long, the maximum is 64", len(ff.Identifier))
+			}
+		}
+	}
+
+	if t.Version == Version2_4 && (t.Flags&TagFlagHasRestrictions) != 0 {
+		v.restrictions(t)
+	}
+
+	return v.issues
+}
+
+// A validator accumulates the issues found while validating a tag.
+type validator struct {
+	vdata  *versionData
+	issues []Issue
+	seen   map[string]bool
+}
+
+func (v *validator) add(rule string, sev Severity, f Frame, format string, args ...interface{}) {
+	v.issues = append(v.issues, Issue{
+		Rule:     rule,
+		Severity: sev,
+		Frame:    f,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// unique reports an issue if a frame of the same type with the same key
+// has already been seen.
+func (v *validator) unique(rule string, f Frame, typ FrameType, key string) {
+	if v.seen == nil {
+		v.seen = make(map[string]bool)
+	}
+	k := fmt.Sprintf("%s\x00%d\x00%s", rule, typ, key)
+	if v.seen[k] {
+		v.add(rule, SeverityError, f, "duplicate %s frame", v.name(f))
+		return
+	}
+	v.seen[k] = true
+}
+
+// language reports an issue if a language code isn't a valid ISO-639-2
+// code.
+func (v *validator) language(f Frame, lang string) {
+	switch {
+	case len(lang) != 3 || !isLowerLetters(lang):
+		v.add(RuleInvalidLanguage, SeverityError, f,
+			"%s frame language %q is not a three-letter lowercase code", v.name(f), lang)
+	case !iso6392Codes[lang]:
+		v.add(RuleUnknownLanguage, SeverityWarning, f,
+			"%s frame language %q is not an ISO-639-2 code", v.name(f), lang)
+	}
+}
+
+// restrictions reports issues for each violation of a tag's restrictions.
+func (v *validator) restrictions(t *Tag) {
+	r := &t.Restrictions
+
+	if n, max := len(t.Frames), r.TagSize.MaxFrames(); n > max {
+		v.add(RuleRestrictedFrameCount, SeverityError, nil,
+			"tag has %d frames, restrictions allow %d", n, max)
+	}
+
+	if n, err := t.encodedSize(); err != nil {
+		v.add(RuleEncodingFailed, SeverityError, nil,
+			"tag can't be encoded to check its size: %v", err)
+	} else if max := r.TagSize.MaxSize(); n > max {
+		v.add(RuleRestrictedTagSize, SeverityError, nil,
+			"tag is %d bytes long, restrictions allow %d", n, max)
+	}
+
+	for _, f := range t.Frames {
+		if _, err := HeaderOfChecked(f); err != nil {
+			continue
+		}
+		fv := reflect.ValueOf(f).Elem()
+
+		if enc := fv.FieldByName("Encoding"); r.TextEncoding && enc.Kind() == reflect.Uint8 {
+			if e := Encoding(enc.Uint()); r.textEncoding(e) != e {
+				v.add(RuleRestrictedTextEncoding, SeverityError, f,
+					"%s frame uses UTF-16, restrictions allow only ISO-8859-1 and UTF-8", v.name(f))
+			}
+		}
+
+		if max := r.TextSize.MaxChars(); max > 0 {
+			visitTextFields(fv, "", func(name string, s reflect.Value) {
+				if n := utf8.RuneCountInString(s.String()); n > max {
+					v.add(RuleRestrictedTextSize, SeverityError, f,
+						"%s frame field %s has %d characters, restrictions allow %d", v.name(f), name, n, max)
+				}
+			})
+		}
+
+		if pic, ok := f.(*FrameAttachedPicture); ok {
+			switch r.checkPicture(pic) {
+			case ErrRestrictedImageFormat:
+				v.add(RuleRestrictedImageFormat, SeverityError, f,
+					"%s frame image is not a PNG or JPEG image", v.name(f))
+			case ErrRestrictedImageSize:
+				v.add(RuleRestrictedImageSize, SeverityError, f,
+					"%s frame image dimensions are not allowed by restrictions", v.name(f))
+			}
+		}
+	}
+}
+
+// name returns the ID of a frame, as used in issue messages. Frames not
+// supported by the tag's version are named by their v2.4 frame ID.
+func (v *validator) name(f Frame) string {
+	typ := headerOf(f).FrameType
+	for _, vdata := range []*versionData{v.vdata, newCodec24().vdata} {
+		if vdata == nil {
+			continue
+		}
+		if id, ok := vdata.frameTypes.FrameTypeToFrameID[typ]; ok {
+			return id
+		}
+	}
+	return headerOf(f).FrameID
+}
+
+// versionDataOf returns the codec data for an ID3 version, or nil if the
+// version has none.
+func versionDataOf(v Version) *versionData {
+	switch v {
+	case Version2_3:
+		return newCodec23().vdata
+	case Version2_4:
+		return newCodec24().vdata
+	default:
+		return nil
+	}
+}
+
+func isLowerLetters(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 'a' || s[i] > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+// iso6392Codes holds all ISO-639-2 language codes, including both
+// bibliographic and terminology codes and the special codes "mis", "mul",
+// "und" and "zxx".
+var iso6392Codes = func() map[string]bool {
+	m := make(map[string]bool)
+	for _, code := range strings.Fields(`
+aar abk ace ach ada ady afa afh afr ain aka akk alb ale alg alt amh ang
+anp apa ara arc arg arm arn arp art arw asm ast ath aus ava ave awa aym
+aze bad bai bak bal bam ban baq bas bat bej bel bem ben ber bho bih bik
+bin bis bla bnt bod bos bra bre btk bua bug bul bur byn cad cai car cat
+cau ceb cel ces cha chb che chg chi chk chm chn cho chp chr chu chv chy
+cmc cnr cop cor cos cpe cpf cpp cre crh crp csb cus cym cze dak dan dar
+day del den deu dgr din div doi dra dsb dua dum dut dyu dzo efi egy eka
+ell elx eng enm epo est eus ewe ewo fan fao fas fat fij fil fin fiu fon
+fra fre frm fro frr frs fry ful fur gaa gay gba gem geo ger gez gil gla
+gle glg glv gmh goh gon gor got grb grc gre grn gsw guj gwi hai hat hau
+haw heb her hil him hin hit hmn hmo hrv hsb hun hup hye iba ibo ice ido
+iii ijo iku ile ilo ina inc ind ine inh ipk ira iro isl ita jav jbo jpn
+jpr jrb kaa kab kac kal kam kan kar kas kat kau kaw kaz kbd kha khi khm
+kho kik kin kir kmb kok kom kon kor kos kpe krc krl kro kru kua kum kur
+kut lad lah lam lao lat lav lez lim lin lit lol loz ltz lua lub lug lui
+lun luo lus mac mad mag mah mai mak mal man mao map mar mas may mdf mdr
+men mga mic min mis mkd mkh mlg mlt mnc mni mno moh mon mos mri msa mul
+mun mus mwl mwr mya myn myv nah nai nap nau nav nbl nde ndo nds nep new
+nia nic niu nld nno nob nog non nor nqo nso nub nwc nya nym nyn nyo nzi
+oci oji ori orm osa oss ota oto paa pag pal pam pan pap pau peo per phi
+phn pli pol pon por pra pro pus que raj rap rar roa roh rom ron rum run
+rup rus sad sag sah sai sal sam san sas sat scn sco sel sem sga sgn shn
+sid sin sio sit sla slk slo slv sma sme smi smj smn smo sms sna snd snk
+sog som son sot spa sqi srd srn srp srr ssa ssw suk sun sus sux swa swe
+syc syr tah tai tam tat tel tem ter tet tgk tgl tha tib tig tir tiv tkl
+tlh tli tmh tog ton tpi tsi tsn tso tuk tum tup tur tut tvl twi tyv udm
+uga uig ukr umb und urd uzb vai ven vie vol vot wak wal war was wel wen
+wln wol xal xho yao yap yid yor ypk zap zbl zen zgh zha zho znd zul zun
+zxx zza
+`) {
+		m[code] = true
+	}
+	return m
+}()
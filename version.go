@@ -12,6 +12,7 @@ const (
 
 type versionCodec interface {
 	Decode(t *Tag, r *reader) error
+	DecodeFrame(t *Tag, f *Frame, r *reader) error
 	Encode(t *Tag, w *writer) error
 }
 
@@ -20,5 +21,6 @@ type versionData struct {
 	headerExFlags flagMap
 	frameFlags    flagMap
 	bounds        boundsMap
+	encodeBounds  boundsMap // stricter bounds applied only when encoding
 	frameTypes    *frameTypeMap
 }
@@ -7,14 +7,23 @@ import (
 // A writer represents a buffer to which data is added. After adding
 // data to the writer, it may be stored to a stream.
 type writer struct {
-	w   io.Writer
-	buf []byte
-	n   int
-	err error
+	w    io.Writer
+	buf  []byte
+	n    int
+	err  error
+	opts *EncodeOptions
+
+	// restrict holds the restrictions applied while encoding, or nil if
+	// restrictions are not being applied.
+	restrict *Restrictions
+
+	// byteOrder is the byte order of UTF-16 strings with a byte order
+	// mark, unless the encoding options select one.
+	byteOrder ByteOrder
 }
 
-func newWriter(w io.Writer) *writer {
-	return &writer{w: w, buf: make([]byte, 0, 64)}
+func newWriter(w io.Writer, opts *EncodeOptions) *writer {
+	return &writer{w: w, buf: make([]byte, 0, 64), opts: opts}
 }
 
 // Len returns the number of unsaved bytes in the writer's buffer.
@@ -42,6 +51,14 @@ func (w *writer) ConsumeBytesFromOffset(offset int) []byte {
 	return b
 }
 
+// text returns the codec used to encode the writer's strings.
+func (w *writer) text() textCodec {
+	if w.opts != nil && w.opts.UTF16ByteOrder != ByteOrderDefault {
+		return textCodec{byteOrder: w.opts.UTF16ByteOrder}
+	}
+	return textCodec{byteOrder: w.byteOrder}
+}
+
 // SaveTo writes all unsaved bytes in the writer's buffer to the stream.
 func (w *writer) Save() (int, error) {
 	if w.err != nil {
@@ -72,6 +89,20 @@ func (w *writer) StoreBytes(b []byte) {
 	w.buf = append(w.buf, b...)
 }
 
+// StoreUint32At stores a 4-byte big-endian integer into the writer's buffer
+// at an offset previously filled with a placeholder.
+func (w *writer) StoreUint32At(offset int, value uint32) {
+	if w.err != nil {
+		return
+	}
+	if offset < 0 || offset+4 > len(w.buf) {
+		w.err = errInsufficientBuffer
+		return
+	}
+
+	w.err = encodeUint32(w.buf[offset:offset+4], value)
+}
+
 // StoreStrings adds a series of encoded, null-terminated strings to the
 // writer's buffer.
 func (w *writer) StoreStrings(ss []string, enc Encoding) {
@@ -79,7 +110,7 @@ func (w *writer) StoreStrings(ss []string, enc Encoding) {
 		return
 	}
 
-	b, err := encodeStrings(ss, enc)
+	b, err := w.text().encodeStrings(ss, enc)
 	if err != nil {
 		w.err = err
 		return
@@ -95,16 +126,15 @@ func (w *writer) StoreFixedLengthString(s string, n int, enc Encoding) {
 		return
 	}
 
-	if len(s) != n {
-		w.err = ErrInvalidFixedLenString
-		return
-	}
-
-	b, err := encodeString(s, enc)
+	b, err := w.text().encodeString(s, enc)
 	if err != nil {
 		w.err = err
 		return
 	}
+	if len(b) != n {
+		w.err = ErrInvalidFixedLenString
+		return
+	}
 
 	w.buf = append(w.buf, b...)
 }
@@ -116,7 +146,7 @@ func (w *writer) StoreString(s string, enc Encoding, term bool) {
 		return
 	}
 
-	b, err := encodeString(s, enc)
+	b, err := w.text().encodeString(s, enc)
 	if err != nil {
 		w.err = err
 		return